@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/disqus"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/transfer"
+	"github.com/Pacahar/graphql-comments/internal/wxr"
+)
+
+// runCommand runs an admin subcommand against the configured storage
+// instead of starting the server.
+func runCommand(ctx context.Context, st *storage.Storage, cfg *config.Config, args []string, log *slog.Logger) error {
+	switch args[0] {
+	case "export":
+		return runExport(ctx, st, args[1:], log)
+	case "import":
+		return runImport(ctx, st, args[1:], log)
+	case "import-disqus":
+		return runImportDisqus(ctx, st, args[1:], log)
+	case "export-wxr":
+		return runExportWXR(ctx, st, cfg.WXR, args[1:], log)
+	default:
+		return fmt.Errorf("unknown command %q, expected export, import, import-disqus or export-wxr", args[0])
+	}
+}
+
+func runExport(ctx context.Context, st *storage.Storage, args []string, log *slog.Logger) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("output", "-", "file to write the NDJSON dump to, - for stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	report, err := transfer.Export(ctx, st, w)
+	if err != nil {
+		return err
+	}
+
+	log.Info("export finished", slog.Int("posts", report.Posts), slog.Int("comments", report.Comments))
+
+	return nil
+}
+
+func runImport(ctx context.Context, st *storage.Storage, args []string, log *slog.Logger) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	input := flags.String("input", "-", "NDJSON dump to read, - for stdin")
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without writing")
+	onConflict := flags.String("on-conflict", transfer.ConflictSkip, "what to do with records that already exist: skip or overwrite")
+	batchSize := flags.Int("batch-size", transfer.DefaultBatchSize, "records written per transaction")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		r = file
+	}
+
+	report, err := transfer.Import(ctx, st, r, transfer.ImportOptions{
+		DryRun:     *dryRun,
+		OnConflict: *onConflict,
+		BatchSize:  *batchSize,
+	})
+
+	log.Info("import finished",
+		slog.Bool("dry run", *dryRun),
+		slog.Int("posts created", report.PostsCreated),
+		slog.Int("posts skipped", report.PostsSkipped),
+		slog.Int("posts overwritten", report.PostsOverwritten),
+		slog.Int("comments created", report.CommentsCreated),
+		slog.Int("comments skipped", report.CommentsSkipped),
+		slog.Int("comments overwritten", report.CommentsOverwritten),
+	)
+
+	return err
+}
+
+func runImportDisqus(ctx context.Context, st *storage.Storage, args []string, log *slog.Logger) error {
+	flags := flag.NewFlagSet("import-disqus", flag.ContinueOnError)
+	input := flags.String("input", "-", "Disqus XML export to read, - for stdin")
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without writing")
+	batchSize := flags.Int("batch-size", transfer.DefaultBatchSize, "records written per transaction")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		r = file
+	}
+
+	report, err := disqus.Import(ctx, st, r, transfer.ImportOptions{
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+	})
+
+	for _, issue := range report.Skipped {
+		fmt.Fprintf(os.Stdout, "skipped %s\n", issue)
+	}
+
+	for _, issue := range report.Orphaned {
+		fmt.Fprintf(os.Stdout, "orphaned %s\n", issue)
+	}
+
+	log.Info("disqus import finished",
+		slog.Bool("dry run", *dryRun),
+		slog.Int("posts created", report.PostsCreated),
+		slog.Int("posts skipped", report.PostsSkipped),
+		slog.Int("comments created", report.CommentsCreated),
+		slog.Int("comments skipped", report.CommentsSkipped),
+		slog.Int("records skipped", len(report.Skipped)),
+		slog.Int("comments orphaned", len(report.Orphaned)),
+	)
+
+	return err
+}
+
+func runExportWXR(ctx context.Context, st *storage.Storage, cfg config.WXR, args []string, log *slog.Logger) error {
+	flags := flag.NewFlagSet("export-wxr", flag.ContinueOnError)
+	output := flags.String("output", "-", "file to write the WXR document to, - for stdout")
+	flags.StringVar(&cfg.Title, "title", cfg.Title, "site title")
+	flags.StringVar(&cfg.Link, "link", cfg.Link, "site URL")
+	flags.StringVar(&cfg.Timezone, "timezone", cfg.Timezone, "site time zone for local dates")
+
+	var postIDs []int64
+	flags.Func("post", "export only this post, may be repeated", func(value string) error {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		postIDs = append(postIDs, id)
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts, err := wxrExportOptions(cfg)
+	if err != nil {
+		return err
+	}
+	opts.PostIDs = postIDs
+
+	var w io.Writer = os.Stdout
+
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	report, err := wxr.Export(ctx, st, w, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Info("wxr export finished", slog.Int("posts", report.Posts), slog.Int("comments", report.Comments))
+
+	return nil
+}
+
+func wxrExportOptions(cfg config.WXR) (wxr.ExportOptions, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return wxr.ExportOptions{}, fmt.Errorf("timezone: %w", err)
+	}
+
+	return wxr.ExportOptions{Title: cfg.Title, Link: cfg.Link, Location: location}, nil
+}
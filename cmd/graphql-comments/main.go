@@ -1,18 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/auth"
 	"github.com/Pacahar/graphql-comments/internal/config"
 	"github.com/Pacahar/graphql-comments/internal/constants"
 	"github.com/Pacahar/graphql-comments/internal/graphql"
 	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/health"
+	"github.com/Pacahar/graphql-comments/internal/idempotency"
+	"github.com/Pacahar/graphql-comments/internal/logging"
+	"github.com/Pacahar/graphql-comments/internal/metrics"
+	"github.com/Pacahar/graphql-comments/internal/notification"
+	"github.com/Pacahar/graphql-comments/internal/scheduler"
 	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/storage/cache"
 	"github.com/Pacahar/graphql-comments/internal/storage/memory"
 	"github.com/Pacahar/graphql-comments/internal/storage/postgres"
+	"github.com/Pacahar/graphql-comments/internal/storage/sqlite"
+	"github.com/Pacahar/graphql-comments/internal/tracing"
+	"github.com/Pacahar/graphql-comments/internal/webhook"
+	"github.com/Pacahar/graphql-comments/internal/wxr"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
@@ -22,12 +43,37 @@ func main() {
 
 	cfg := config.MustLoad()
 
-	log := setupLogger(cfg.Environment)
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	// Subcommands may write their output to stdout, so they log to stderr.
+	command := flag.Args()
+
+	var logOutput io.Writer = os.Stdout
+	if len(command) > 0 {
+		logOutput = os.Stderr
+	}
+
+	log := setupLogger(cfg.Environment, logOutput)
 
 	log.Info("Starting service", slog.String("env", cfg.Environment))
 	log.Debug("Debug messages enabled")
 
-	storage, err := setupStorage(&cfg.Storage)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// migrate has to run before setupStorage, which may refuse a schema
+	// that is behind.
+	if len(command) > 0 && command[0] == "migrate" {
+		if err := runMigrate(ctx, &cfg.Storage, command[1:], log); err != nil {
+			log.Error("command failed", slog.String("command", command[0]), slog.Any("error", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	storage, err := setupStorage(ctx, &cfg.Storage)
 
 	if err != nil {
 		log.Error("failed to setup storage", slog.Any("error", err))
@@ -36,57 +82,239 @@ func main() {
 
 	log.Info("storage set", slog.String("storage type", cfg.Storage.Type))
 
+	if len(command) > 0 {
+		err := runCommand(ctx, storage, cfg, command, log)
+		closeStorage(storage, log)
+
+		if err != nil {
+			log.Error("command failed", slog.String("command", command[0]), slog.Any("error", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.Storage.Cache != nil {
+		storage = cache.NewStorage(storage, cache.Caches{
+			Posts:    cache.NewLRU(cfg.Storage.Cache.Posts, cfg.Storage.Cache.TTL),
+			Comments: cache.NewLRU(cfg.Storage.Cache.Comments, cfg.Storage.Cache.TTL),
+			Pages:    cache.NewLRU(cfg.Storage.Cache.Pages, cfg.Storage.Cache.TTL),
+		})
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, os.Stdout)
+	if err != nil {
+		log.Error("failed to setup tracing", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	log.Info("tracing set", slog.String("exporter", cfg.Tracing.Exporter))
+
+	storage = tracing.InstrumentStorage(storage)
+
+	appMetrics := metrics.New()
+
+	storage, err = appMetrics.InstrumentStorage(storage)
+	if err != nil {
+		log.Error("failed to instrument storage", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Workers outlive the signal: they keep running while in-flight requests
+	// drain and are stopped once the server is down.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	webhooks := webhook.NewDispatcher(cfg.Webhooks, storage.Webhook, log)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		webhooks.Run(workerCtx)
+	}()
+
+	log.Info("webhook dispatcher started", slog.Int("endpoints", len(cfg.Webhooks.Endpoints)))
+
+	publisher := scheduler.NewPublisher(storage.Post, cfg.Scheduler.Interval, log)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		publisher.Run(workerCtx)
+	}()
+
+	log.Info("post scheduler started", slog.Duration("interval", cfg.Scheduler.Interval))
+
+	keyCleaner := idempotency.NewCleaner(storage.Idempotency, cfg.Idempotency.CleanupInterval, log)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		keyCleaner.Run(workerCtx)
+	}()
+
+	broker := notification.NewBroker()
+
 	resolver := &graphql.Resolver{
-		Storage: storage,
-		Logger:  log,
+		Storage:     storage,
+		Logger:      log,
+		Broker:      broker,
+		Webhooks:    webhooks,
+		Threads:     cfg.Threads,
+		Idempotency: cfg.Idempotency,
+		Admins:      cfg.Admins,
 	}
 
 	srv := handler.NewDefaultServer(
 		generated.NewExecutableSchema(generated.Config{Resolvers: resolver}),
 	)
+	srv.Use(appMetrics.Extension())
+	srv.Use(tracing.Extension())
+	srv.Use(logging.Extension())
 
-	http.Handle("/playground", playground.Handler("GraphQL playground", "/query"))
+	checker := health.NewChecker(cfg.HTTPServer.ReadinessTimeout, log)
+	checker.Add("storage", storage.Ping)
 
-	http.Handle("/query", srv)
+	wxrOptions, err := wxrExportOptions(cfg.WXR)
+	if err != nil {
+		log.Error("invalid wxr config", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/healthz", checker.LiveHandler())
+	mux.Handle("/readyz", checker.ReadyHandler())
+	mux.Handle("/metrics", appMetrics.Handler())
+
+	mux.Handle("/playground", playground.Handler("GraphQL playground", "/query"))
+
+	mux.Handle("/query", tracing.Middleware(auth.Middleware(storageClient(logging.Middleware(log, srv)))))
+
+	mux.Handle("/admin/export.wxr", auth.Middleware(logging.Middleware(log, wxr.Handler(storage, cfg.Admins, wxrOptions, log))))
 
 	address := fmt.Sprintf(":%d", cfg.HTTPServer.Port)
 	log.Info("Starting GraphQL server", slog.Int("addr", cfg.HTTPServer.Port))
 
-	if err := http.ListenAndServe(address, nil); err != nil {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadTimeout:       cfg.HTTPServer.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPServer.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPServer.WriteTimeout,
+		IdleTimeout:       cfg.HTTPServer.IdleTimeout,
+	}
+
+	// Shutdown does not track hijacked websocket connections, so open
+	// subscriptions are completed when it starts.
+	server.RegisterOnShutdown(broker.Close)
+
+	shutdownDone := make(chan struct{})
+
+	go func() {
+		defer close(shutdownDone)
+
+		<-ctx.Done()
+		// A second signal kills the process right away.
+		stop()
+
+		log.Info("shutting down, draining", slog.Duration("drain delay", cfg.HTTPServer.DrainDelay))
+
+		// Fail readiness first and keep serving until the orchestrator has
+		// stopped routing new requests here.
+		checker.Drain()
+		time.Sleep(cfg.HTTPServer.DrainDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error("failed to shut down server gracefully", slog.Any("error", err))
+			server.Close()
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Error("failed to start server", slog.Any("error", err))
 		os.Exit(1)
 	}
+
+	<-shutdownDone
+
+	log.Info("server stopped, stopping workers")
+
+	stopWorkers()
+	workers.Wait()
+
+	closeStorage(storage, log)
+
+	tracingCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+	defer cancel()
+
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Error("failed to flush traces", slog.Any("error", err))
+	}
+
+	log.Info("service stopped")
+}
+
+// storageClient tells the storage who a request is for, so that replicas
+// do not hide a client's own writes from it. Anonymous requests are told
+// apart by address only, which behind a proxy lumps them together.
+func storageClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			client, _, _ = net.SplitHostPort(r.RemoteAddr)
+		}
+
+		next.ServeHTTP(w, r.WithContext(storage.WithClient(r.Context(), client)))
+	})
+}
+
+func closeStorage(st *storage.Storage, log *slog.Logger) {
+	if err := st.Close(); err != nil {
+		log.Error("failed to close storage", slog.Any("error", err))
+	}
 }
 
-func setupLogger(env string) *slog.Logger {
+func setupLogger(env string, w io.Writer) *slog.Logger {
 	var log *slog.Logger
 
 	switch env {
 	case constants.EnvLocal:
 		log = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}),
 		)
 	case constants.EnvDev:
 		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}),
 		)
 	case constants.EnvProd:
 		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
+			slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelInfo}),
 		)
 	default:
-		return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelInfo}))
 	}
 
 	return log
 }
 
-func setupStorage(storageCfg *config.Storage) (*storage.Storage, error) {
+func setupStorage(ctx context.Context, storageCfg *config.Storage) (*storage.Storage, error) {
 	switch storageCfg.Type {
 	case constants.StorageMemory:
+		if storageCfg.Memory != nil && storageCfg.Memory.Dir != "" {
+			return memory.NewPersistentMemoryStorage(storageCfg.Memory.Dir, storageCfg.Memory.SnapshotInterval)
+		}
 		return memory.NewMemoryStorage()
 	case constants.StoragePostgres:
-		return postgres.NewPostgresStorage(storageCfg.Postgres.DSN())
+		return postgres.NewPostgresStorage(ctx, storageCfg.Postgres.DSN(), storageCfg.Postgres.Migrations, postgres.Replicas{
+			DSNs:           storageCfg.Postgres.Replicas,
+			ReadYourWrites: storageCfg.Postgres.ReadYourWrites,
+			CheckInterval:  storageCfg.Postgres.ReplicaCheckInterval,
+		})
+	case constants.StorageSQLite:
+		if storageCfg.SQLite == nil {
+			return nil, fmt.Errorf("storage type %s requires the sqlite section", constants.StorageSQLite)
+		}
+		return sqlite.NewSQLiteStorage(ctx, storageCfg.SQLite.Path)
 	default:
 		return nil, fmt.Errorf("unknown storage type: %s", storageCfg.Type)
 	}
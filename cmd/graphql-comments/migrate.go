@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/storage/postgres"
+)
+
+// runMigrate handles migrate up|down|status against the configured
+// Postgres database.
+func runMigrate(ctx context.Context, storageCfg *config.Storage, args []string, log *slog.Logger) error {
+	if storageCfg.Type != constants.StoragePostgres {
+		return fmt.Errorf("migrations only apply to %s storage, configured storage is %s", constants.StoragePostgres, storageCfg.Type)
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("expected migrate up, down or status")
+	}
+
+	db, err := sql.Open("postgres", storageCfg.Postgres.DSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			log.Info("migration applied", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+		}
+
+		if err != nil {
+			return err
+		}
+
+		log.Info("schema is up to date", slog.Int("applied", len(applied)))
+
+		return nil
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if *steps < 1 {
+			return fmt.Errorf("migrate down --steps must be at least 1, got %d", *steps)
+		}
+
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, migration := range reverted {
+			log.Info("migration reverted", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+		}
+
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
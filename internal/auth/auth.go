@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// UserHeader carries the username of the caller. It is expected to be set by
+// a trusted gateway in front of the service.
+const UserHeader = "X-User"
+
+type userKey struct{}
+
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+func UserFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(userKey{}).(string)
+	return user, ok && user != ""
+}
+
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := strings.TrimSpace(r.Header.Get(UserHeader))
+		if user != "" {
+			r = r.WithContext(WithUser(r.Context(), user))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func IsAdmin(ctx context.Context, admins []string) bool {
+	user, ok := UserFromContext(ctx)
+	return ok && slices.Contains(admins, user)
+}
@@ -5,24 +5,117 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Environment string     `yaml:"environment" env-required:"true"` // local, dev, production
-	HTTPServer  HTTPServer `yaml:"http_server"`
-	Storage     Storage    `yaml:"storage"`
+	Environment string      `yaml:"environment" env-required:"true"` // local, dev, production
+	HTTPServer  HTTPServer  `yaml:"http_server"`
+	Storage     Storage     `yaml:"storage"`
+	Threads     Threads     `yaml:"threads"`
+	Scheduler   Scheduler   `yaml:"scheduler"`
+	Admins      []string    `yaml:"admins"`
+	Webhooks    Webhooks    `yaml:"webhooks"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	WXR         WXR         `yaml:"wxr"`
+	Tracing     Tracing     `yaml:"tracing"`
 }
 
 type HTTPServer struct {
 	Address string `yaml:"address" env-default:"0.0.0.0"`
 	Port    int    `yaml:"port" env-default:"4000"`
+	// ReadinessTimeout bounds each dependency check of /readyz.
+	ReadinessTimeout  time.Duration `yaml:"readiness_timeout" env-default:"2s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env-default:"15s"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env-default:"5s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env-default:"30s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env-default:"120s"`
+	// DrainDelay is how long the server keeps serving after a shutdown
+	// signal while /readyz already fails, so that load balancers stop
+	// sending traffic first.
+	DrainDelay time.Duration `yaml:"drain_delay" env-default:"5s"`
+	// ShutdownTimeout bounds the wait for in-flight requests afterwards.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"30s"`
 }
 
 type Storage struct {
-	Type     string `yaml:"type" env-required:"true"` // memory, postgres
-	Postgres *DB    `yaml:"postgres,omitempty"`
+	Type     string  `yaml:"type" env-required:"true"` // memory, postgres, sqlite
+	Memory   *Memory `yaml:"memory,omitempty"`
+	Postgres *DB     `yaml:"postgres,omitempty"`
+	SQLite   *SQLite `yaml:"sqlite,omitempty"`
+	Cache    *Cache  `yaml:"cache,omitempty"`
+}
+
+// Cache keeps recently read posts, comments and comment pages in process
+// for at most TTL. Each size is a number of entries. Without this section
+// nothing is cached.
+type Cache struct {
+	Posts    int           `yaml:"posts" env-default:"10000"`
+	Comments int           `yaml:"comments" env-default:"50000"`
+	Pages    int           `yaml:"pages" env-default:"10000"`
+	TTL      time.Duration `yaml:"ttl" env-default:"1m"`
+}
+
+// Memory keeps posts and comments in Dir across restarts. Without Dir the
+// memory storage starts empty every time.
+type Memory struct {
+	Dir              string        `yaml:"dir"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval" env-default:"5m"`
+}
+
+type Threads struct {
+	MaxDepth int    `yaml:"max_depth" env-default:"0"`     // 0 means unlimited
+	Overflow string `yaml:"overflow" env-default:"reject"` // reject, flatten
+	MaxPins  int    `yaml:"max_pins" env-default:"3"`
+	// MaxThreadComments bounds the comments one thread query returns.
+	MaxThreadComments int `yaml:"max_thread_comments" env-default:"500"`
+}
+
+type Scheduler struct {
+	Interval time.Duration `yaml:"interval" env-default:"30s"`
+}
+
+type Idempotency struct {
+	TTL time.Duration `yaml:"ttl" env-default:"24h"`
+	// InFlightTTL is how long a key is held by a request that has not
+	// finished, so that a crash between reserving and completing the key
+	// blocks retries only that long.
+	InFlightTTL     time.Duration `yaml:"in_flight_ttl" env-default:"2m"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"10m"`
+}
+
+// WXR describes the site in WordPress exports.
+type WXR struct {
+	Title    string `yaml:"title" env-default:"Comments"`
+	Link     string `yaml:"link"`
+	Timezone string `yaml:"timezone" env-default:"UTC"` // IANA name, used for the local WordPress dates
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" env-default:"off"` // otlp, stdout, off
+	// Endpoint is the OTLP/HTTP collector URL. When empty the standard
+	// OTEL_EXPORTER_OTLP_* environment variables apply.
+	Endpoint    string  `yaml:"endpoint"`
+	ServiceName string  `yaml:"service_name" env-default:"graphql-comments"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+type Webhooks struct {
+	Endpoints      []WebhookEndpoint `yaml:"endpoints"`
+	MaxAttempts    int               `yaml:"max_attempts" env-default:"8"`
+	InitialBackoff time.Duration     `yaml:"initial_backoff" env-default:"1s"`
+	MaxBackoff     time.Duration     `yaml:"max_backoff" env-default:"10m"`
+	PollInterval   time.Duration     `yaml:"poll_interval" env-default:"1s"`
+	Timeout        time.Duration     `yaml:"timeout" env-default:"10s"`
+	BatchSize      int               `yaml:"batch_size" env-default:"50"`
+}
+
+type WebhookEndpoint struct {
+	URL    string   `yaml:"url" env-required:"true"`
+	Secret string   `yaml:"secret" env-required:"true"`
+	Events []string `yaml:"events"` // empty means all events
 }
 
 type DB struct {
@@ -31,6 +124,22 @@ type DB struct {
 	Username string `yaml:"username" env-required:"true"`
 	Password string `yaml:"password" env-required:"true"`
 	DBName   string `yaml:"db_name" env-default:"comments"`
+	// Migrations decides what happens to a schema that is behind at
+	// startup: auto applies pending migrations, require refuses to start,
+	// off does nothing.
+	Migrations string `yaml:"migrations" env-default:"auto"`
+	// Replicas are DSNs of read replicas. Reads of posts and comments are
+	// spread over the healthy ones, everything else stays on the primary.
+	Replicas []string `yaml:"replicas"`
+	// ReadYourWrites is how long a client keeps reading from the primary
+	// after it writes.
+	ReadYourWrites       time.Duration `yaml:"read_your_writes" env-default:"5s"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" env-default:"5s"`
+}
+
+// SQLite keeps the whole database in a single file, created on first start.
+type SQLite struct {
+	Path string `yaml:"path" env-default:"comments.db"`
 }
 
 func (db DB) DSN() string {
@@ -59,5 +168,38 @@ func MustLoad() *Config {
 		log.Fatalf("Error while read config: %s", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+
 	return &config
 }
+
+// Validate rejects settings that would only fail once the service runs.
+func (c *Config) Validate() error {
+	if c.Scheduler.Interval <= 0 {
+		return fmt.Errorf("scheduler.interval must be positive, got %s", c.Scheduler.Interval)
+	}
+
+	if c.Webhooks.PollInterval <= 0 {
+		return fmt.Errorf("webhooks.poll_interval must be positive, got %s", c.Webhooks.PollInterval)
+	}
+
+	if c.Webhooks.BatchSize <= 0 {
+		return fmt.Errorf("webhooks.batch_size must be positive, got %d", c.Webhooks.BatchSize)
+	}
+
+	if c.Threads.MaxThreadComments <= 0 {
+		return fmt.Errorf("threads.max_thread_comments must be positive, got %d", c.Threads.MaxThreadComments)
+	}
+
+	if c.Idempotency.InFlightTTL <= 0 {
+		return fmt.Errorf("idempotency.in_flight_ttl must be positive, got %s", c.Idempotency.InFlightTTL)
+	}
+
+	if c.Idempotency.CleanupInterval <= 0 {
+		return fmt.Errorf("idempotency.cleanup_interval must be positive, got %s", c.Idempotency.CleanupInterval)
+	}
+
+	return nil
+}
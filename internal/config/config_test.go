@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validConfig() Config {
+	return Config{
+		Scheduler:   Scheduler{Interval: time.Second},
+		Threads:     Threads{MaxThreadComments: 500},
+		Webhooks:    Webhooks{PollInterval: time.Second, BatchSize: 50},
+		Idempotency: Idempotency{InFlightTTL: time.Minute, CleanupInterval: time.Minute},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{"zero scheduler interval", func(c *Config) { c.Scheduler.Interval = 0 }},
+		{"negative scheduler interval", func(c *Config) { c.Scheduler.Interval = -time.Second }},
+		{"zero webhook poll interval", func(c *Config) { c.Webhooks.PollInterval = 0 }},
+		{"negative webhook poll interval", func(c *Config) { c.Webhooks.PollInterval = -time.Second }},
+		{"zero webhook batch size", func(c *Config) { c.Webhooks.BatchSize = 0 }},
+		{"zero max thread comments", func(c *Config) { c.Threads.MaxThreadComments = 0 }},
+		{"zero idempotency in-flight ttl", func(c *Config) { c.Idempotency.InFlightTTL = 0 }},
+		{"zero idempotency cleanup interval", func(c *Config) { c.Idempotency.CleanupInterval = 0 }},
+	}
+
+	cfg := validConfig()
+	assert.NoError(t, cfg.Validate())
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := validConfig()
+			test.modify(&cfg)
+			assert.Error(t, cfg.Validate())
+		})
+	}
+}
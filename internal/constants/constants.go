@@ -7,4 +7,39 @@ const (
 
 	StorageMemory   string = "memory"
 	StoragePostgres string = "postgres"
+	StorageSQLite   string = "sqlite"
+
+	MigrationsAuto    string = "auto"
+	MigrationsRequire string = "require"
+	MigrationsOff     string = "off"
+
+	TracingOTLP   string = "otlp"
+	TracingStdout string = "stdout"
+	TracingOff    string = "off"
+
+	PostDraft     string = "DRAFT"
+	PostScheduled string = "SCHEDULED"
+	PostPublished string = "PUBLISHED"
+	PostArchived  string = "ARCHIVED"
+
+	CommentVisible string = "VISIBLE"
+	CommentDeleted string = "DELETED"
+	CommentSpam    string = "SPAM"
+
+	OverflowReject  string = "reject"
+	OverflowFlatten string = "flatten"
+
+	NotificationReply   string = "REPLY"
+	NotificationMention string = "MENTION"
+
+	WebhookDeliveryPending   string = "PENDING"
+	WebhookDeliveryDelivered string = "DELIVERED"
+	WebhookDeliveryFailed    string = "FAILED"
+
+	EventPostCreated    string = "post.created"
+	EventPostUpdated    string = "post.updated"
+	EventPostDeleted    string = "post.deleted"
+	EventCommentCreated string = "comment.created"
+	EventCommentUpdated string = "comment.updated"
+	EventCommentDeleted string = "comment.deleted"
 )
@@ -0,0 +1,382 @@
+// Package disqus imports comment threads from a Disqus XML export.
+//
+// Every <thread> becomes a post and every <post> a comment of the post made
+// from its thread. Comments keep their parent, creation time and deleted and
+// spam flags; they are written through transfer.ImportRecords, so importing
+// the same export twice does not duplicate anything.
+package disqus
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/transfer"
+)
+
+type ref struct {
+	ID string `xml:"http://disqus.com/disqus-internals id,attr"`
+}
+
+type author struct {
+	Name        string `xml:"name"`
+	Username    string `xml:"username"`
+	IsAnonymous bool   `xml:"isAnonymous"`
+}
+
+type thread struct {
+	ID        string `xml:"http://disqus.com/disqus-internals id,attr"`
+	Link      string `xml:"link"`
+	Title     string `xml:"title"`
+	Message   string `xml:"message"`
+	CreatedAt string `xml:"createdAt"`
+	Author    author `xml:"author"`
+	IsClosed  bool   `xml:"isClosed"`
+	IsDeleted bool   `xml:"isDeleted"`
+}
+
+type post struct {
+	ID        string `xml:"http://disqus.com/disqus-internals id,attr"`
+	Message   string `xml:"message"`
+	CreatedAt string `xml:"createdAt"`
+	IsDeleted bool   `xml:"isDeleted"`
+	IsSpam    bool   `xml:"isSpam"`
+	Author    author `xml:"author"`
+	Thread    ref    `xml:"thread"`
+	Parent    *ref   `xml:"parent"`
+}
+
+// Issue is a record of the export that was not imported as it is.
+type Issue struct {
+	// Kind is "thread" or "post", ID its dsq:id.
+	Kind   string
+	ID     string
+	Reason string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s %s: %s", i.Kind, i.ID, i.Reason)
+}
+
+type Report struct {
+	transfer.ImportReport
+
+	// Skipped records were not imported at all.
+	Skipped []Issue
+	// Orphaned comments reply to a post missing from the export and were
+	// imported as top-level comments.
+	Orphaned []Issue
+}
+
+// Import parses a Disqus export from r and stores its threads and posts in
+// st. Records that cannot be imported are listed in the report rather than
+// failing the import.
+func Import(ctx context.Context, st *storage.Storage, r io.Reader, opts transfer.ImportOptions) (Report, error) {
+	const op = "disqus.Import"
+
+	threads, posts, err := parse(r)
+	if err != nil {
+		return Report{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	records, report := convert(threads, posts)
+
+	imported, err := transfer.ImportRecords(ctx, st, records, opts)
+	report.ImportReport = imported
+
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+// parse decodes the top-level threads and posts one at a time, so the
+// export never has to fit in memory as a DOM.
+func parse(r io.Reader) ([]thread, []post, error) {
+	decoder := xml.NewDecoder(r)
+
+	var (
+		threads []thread
+		posts   []post
+		depth   int
+	)
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+
+			if depth != 2 {
+				continue
+			}
+
+			switch t.Name.Local {
+			case "thread":
+				var th thread
+				if err := decoder.DecodeElement(&th, &t); err != nil {
+					return nil, nil, err
+				}
+				threads = append(threads, th)
+				depth--
+			case "post":
+				var p post
+				if err := decoder.DecodeElement(&p, &t); err != nil {
+					return nil, nil, err
+				}
+				posts = append(posts, p)
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	return threads, posts, nil
+}
+
+// convert turns the export into transfer records: every post followed by
+// its comments, parents before replies. Record IDs are only used to link
+// records together, the storage assigns its own.
+func convert(threads []thread, posts []post) ([]transfer.Record, Report) {
+	var report Report
+
+	threadIDs := make(map[string]int64, len(threads))
+	records := make([]transfer.Record, 0, len(threads)+len(posts))
+	byThread := make(map[string][]post)
+	order := make([]string, 0, len(threads))
+
+	for _, th := range threads {
+		if th.ID == "" {
+			report.Skipped = append(report.Skipped, Issue{Kind: "thread", Reason: "no dsq:id"})
+			continue
+		}
+
+		if _, exists := threadIDs[th.ID]; exists {
+			report.Skipped = append(report.Skipped, Issue{Kind: "thread", ID: th.ID, Reason: "duplicate dsq:id"})
+			continue
+		}
+
+		createdAt, err := parseTime(th.CreatedAt)
+		if err != nil {
+			report.Skipped = append(report.Skipped, Issue{Kind: "thread", ID: th.ID, Reason: err.Error()})
+			continue
+		}
+
+		threadIDs[th.ID] = int64(len(threadIDs) + 1)
+		order = append(order, th.ID)
+
+		records = append(records, transfer.Record{
+			Type: transfer.RecordPost,
+			Post: &models.Post{
+				ID:               threadIDs[th.ID],
+				Title:            threadTitle(th),
+				Content:          threadContent(th),
+				Author:           authorName(th.Author),
+				Status:           threadStatus(th),
+				CommentsDisabled: th.IsClosed,
+				CreatedAt:        createdAt,
+			},
+		})
+	}
+
+	seen := make(map[string]bool, len(posts))
+
+	for _, p := range posts {
+		switch {
+		case p.ID == "":
+			report.Skipped = append(report.Skipped, Issue{Kind: "post", Reason: "no dsq:id"})
+		case seen[p.ID]:
+			report.Skipped = append(report.Skipped, Issue{Kind: "post", ID: p.ID, Reason: "duplicate dsq:id"})
+		case threadIDs[p.Thread.ID] == 0:
+			report.Skipped = append(report.Skipped, Issue{Kind: "post", ID: p.ID, Reason: fmt.Sprintf("thread %q is not in the export", p.Thread.ID)})
+		default:
+			seen[p.ID] = true
+			byThread[p.Thread.ID] = append(byThread[p.Thread.ID], p)
+		}
+	}
+
+	// transfer.ImportRecords needs every post before its comments and every
+	// parent before its replies.
+	commentIDs := make(map[string]int64, len(posts))
+
+	for _, threadID := range order {
+		for _, p := range threadComments(byThread[threadID], &report) {
+			createdAt, err := parseTime(p.CreatedAt)
+			if err != nil {
+				report.Skipped = append(report.Skipped, Issue{Kind: "post", ID: p.ID, Reason: err.Error()})
+				continue
+			}
+
+			var parentID *int64
+			if p.Parent != nil {
+				// Replies to a skipped comment become top-level comments.
+				if id, exists := commentIDs[p.Parent.ID]; exists {
+					parentID = &id
+				} else {
+					report.Orphaned = append(report.Orphaned, Issue{Kind: "post", ID: p.ID, Reason: fmt.Sprintf("parent %q was skipped", p.Parent.ID)})
+				}
+			}
+
+			id := int64(len(commentIDs) + 1)
+			commentIDs[p.ID] = id
+
+			records = append(records, transfer.Record{
+				Type: transfer.RecordComment,
+				Comment: &models.Comment{
+					ID:        id,
+					PostID:    threadIDs[threadID],
+					ParentID:  parentID,
+					Author:    authorName(p.Author),
+					Content:   strings.TrimSpace(p.Message),
+					Status:    postStatus(p),
+					CreatedAt: createdAt,
+				},
+			})
+		}
+	}
+
+	return records, report
+}
+
+// threadComments orders the posts of a thread parents first, oldest first
+// among siblings. Posts whose parent is missing from the thread, or that
+// are caught in a parent cycle, lose their parent and are reported as
+// orphaned.
+func threadComments(posts []post, report *Report) []post {
+	// Disqus writes createdAt in UTC, so the strings sort chronologically.
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].CreatedAt < posts[j].CreatedAt
+	})
+
+	inThread := make(map[string]bool, len(posts))
+	for _, p := range posts {
+		inThread[p.ID] = true
+	}
+
+	children := make(map[string][]post)
+	queue := make([]post, 0, len(posts))
+
+	for _, p := range posts {
+		switch {
+		case p.Parent == nil || p.Parent.ID == "":
+			p.Parent = nil
+			queue = append(queue, p)
+		case !inThread[p.Parent.ID]:
+			report.Orphaned = append(report.Orphaned, Issue{Kind: "post", ID: p.ID, Reason: fmt.Sprintf("parent %q is not in the thread", p.Parent.ID)})
+			p.Parent = nil
+			queue = append(queue, p)
+		default:
+			children[p.Parent.ID] = append(children[p.Parent.ID], p)
+		}
+	}
+
+	ordered := make([]post, 0, len(posts))
+	visited := make(map[string]bool, len(posts))
+
+	for len(ordered) < len(posts) {
+		if len(queue) == 0 {
+			// Everything left hangs off a cycle; break it at the oldest post.
+			for _, p := range posts {
+				if !visited[p.ID] {
+					report.Orphaned = append(report.Orphaned, Issue{Kind: "post", ID: p.ID, Reason: "parent cycle"})
+					p.Parent = nil
+					queue = append(queue, p)
+					break
+				}
+			}
+		}
+
+		p := queue[0]
+		queue = queue[1:]
+
+		if visited[p.ID] {
+			continue
+		}
+
+		visited[p.ID] = true
+		ordered = append(ordered, p)
+
+		for _, child := range children[p.ID] {
+			if !visited[child.ID] {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	return ordered
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid createdAt %q", value)
+	}
+
+	return t.UTC(), nil
+}
+
+func threadTitle(th thread) string {
+	if title := strings.TrimSpace(th.Title); title != "" {
+		return title
+	}
+
+	return strings.TrimSpace(th.Link)
+}
+
+// threadContent falls back to the page link, as most threads have no
+// message of their own.
+func threadContent(th thread) string {
+	if message := strings.TrimSpace(th.Message); message != "" {
+		return message
+	}
+
+	return strings.TrimSpace(th.Link)
+}
+
+func threadStatus(th thread) string {
+	if th.IsDeleted {
+		return constants.PostArchived
+	}
+
+	return constants.PostPublished
+}
+
+func postStatus(p post) string {
+	switch {
+	case p.IsSpam:
+		return constants.CommentSpam
+	case p.IsDeleted:
+		return constants.CommentDeleted
+	default:
+		return constants.CommentVisible
+	}
+}
+
+// authorName prefers the Disqus username, which is what X-User carries for
+// migrated accounts. Anonymous guests keep their display name.
+func authorName(a author) string {
+	if !a.IsAnonymous {
+		if username := strings.TrimSpace(a.Username); username != "" {
+			return username
+		}
+	}
+
+	return strings.TrimSpace(a.Name)
+}
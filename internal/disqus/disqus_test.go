@@ -0,0 +1,123 @@
+package disqus
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/Pacahar/graphql-comments/internal/transfer"
+	"github.com/stretchr/testify/assert"
+)
+
+func importFixture(t *testing.T, st *storage.Storage, opts transfer.ImportOptions) Report {
+	file, err := os.Open("testdata/export.xml")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	report, err := Import(context.Background(), st, file, opts)
+	assert.NoError(t, err)
+
+	return report
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	report := importFixture(t, st, transfer.ImportOptions{})
+	assert.Equal(t, transfer.ImportReport{PostsCreated: 2, CommentsCreated: 5}, report.ImportReport)
+	assert.Equal(t, []Issue{{Kind: "post", ID: "306", Reason: `thread "404" is not in the export`}}, report.Skipped)
+	assert.Equal(t, []Issue{{Kind: "post", ID: "305", Reason: `parent "999" is not in the thread`}}, report.Orphaned)
+
+	posts, err := st.Post.GetAllPosts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+
+	var hello, old models.Post
+	for _, post := range posts {
+		if post.Title == "Hello, world" {
+			hello = post
+		} else {
+			old = post
+		}
+	}
+
+	assert.Equal(t, "alice", hello.Author)
+	assert.Equal(t, "https://example.com/hello-world", hello.Content)
+	assert.True(t, hello.CommentsDisabled)
+	assert.Equal(t, constants.PostPublished, hello.Status)
+	assert.True(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC).Equal(hello.CreatedAt))
+
+	assert.Equal(t, "https://example.com/old-page", old.Title)
+	assert.Equal(t, "<p>An old page</p>", old.Content)
+	assert.Equal(t, constants.PostArchived, old.Status)
+
+	comments, err := transfer.PostComments(ctx, st.Comment, hello.ID)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 4)
+
+	byAuthor := make(map[string]models.Comment, len(comments))
+	for _, comment := range comments {
+		byAuthor[comment.Author] = comment
+	}
+
+	assert.Nil(t, byAuthor["bob"].ParentID)
+	assert.Equal(t, byAuthor["bob"].ID, *byAuthor["alice"].ParentID)
+	assert.Equal(t, byAuthor["alice"].ID, *byAuthor["carol"].ParentID)
+	assert.Equal(t, 2, byAuthor["carol"].Depth)
+	assert.Equal(t, constants.CommentVisible, byAuthor["bob"].Status)
+	assert.Equal(t, constants.CommentDeleted, byAuthor["carol"].Status)
+	assert.Equal(t, constants.CommentSpam, byAuthor["Guest"].Status)
+	assert.Equal(t, "<p>Great post</p>", byAuthor["bob"].Content)
+	assert.True(t, time.Date(2020, 1, 2, 11, 0, 0, 0, time.UTC).Equal(byAuthor["bob"].CreatedAt))
+
+	orphans, err := transfer.PostComments(ctx, st.Comment, old.ID)
+	assert.NoError(t, err)
+	assert.Len(t, orphans, 1)
+	assert.Nil(t, orphans[0].ParentID)
+
+	// A second run finds everything already imported.
+	report = importFixture(t, st, transfer.ImportOptions{})
+	assert.Equal(t, transfer.ImportReport{PostsSkipped: 2, CommentsSkipped: 5}, report.ImportReport)
+}
+
+func TestImportDryRun(t *testing.T) {
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	report := importFixture(t, st, transfer.ImportOptions{DryRun: true})
+	assert.Equal(t, transfer.ImportReport{PostsCreated: 2, CommentsCreated: 5}, report.ImportReport)
+
+	posts, err := st.Post.GetAllPosts(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+}
+
+func TestConvertBreaksParentCycles(t *testing.T) {
+	const export = `<disqus xmlns="http://disqus.com" xmlns:dsq="http://disqus.com/disqus-internals">
+  <thread dsq:id="1"><title>Thread</title><createdAt>2020-01-01T00:00:00Z</createdAt></thread>
+  <post dsq:id="10"><message>A</message><createdAt>2020-01-01T01:00:00Z</createdAt><thread dsq:id="1"/><parent dsq:id="11"/></post>
+  <post dsq:id="11"><message>B</message><createdAt>2020-01-01T02:00:00Z</createdAt><thread dsq:id="1"/><parent dsq:id="10"/></post>
+  <post dsq:id="12"><message>C</message><createdAt>not a time</createdAt><thread dsq:id="1"/></post>
+</disqus>`
+
+	threads, posts, err := parse(strings.NewReader(export))
+	assert.NoError(t, err)
+
+	records, report := convert(threads, posts)
+	assert.Len(t, records, 3)
+	assert.Equal(t, []Issue{{Kind: "post", ID: "10", Reason: "parent cycle"}}, report.Orphaned)
+	assert.Equal(t, []Issue{{Kind: "post", ID: "12", Reason: `invalid createdAt "not a time"`}}, report.Skipped)
+
+	assert.Nil(t, records[1].Comment.ParentID)
+	assert.Equal(t, "A", records[1].Comment.Content)
+	assert.Equal(t, records[1].Comment.ID, *records[2].Comment.ParentID)
+}
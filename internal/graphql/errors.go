@@ -0,0 +1,52 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// CodeConflict is set as the "code" extension of errors caused by a request
+// that conflicts with the current state, so clients can tell them apart from
+// validation failures.
+const CodeConflict = "CONFLICT"
+
+func conflictError(message string, extensions map[string]any) *gqlerror.Error {
+	if extensions == nil {
+		extensions = make(map[string]any)
+	}
+	extensions["code"] = CodeConflict
+
+	return &gqlerror.Error{
+		Message:    message,
+		Extensions: extensions,
+	}
+}
+
+// postVersionConflict reports a failed expectedVersion check on the post
+// along with the version the client should refetch.
+func (r *Resolver) postVersionConflict(ctx context.Context, id int64) error {
+	post, err := r.Storage.Post.GetPostByID(storage.WithPrimary(ctx), id)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch conflicting post", slog.String("err", err.Error()))
+		return fmt.Errorf("failed to fetch post")
+	}
+
+	return conflictError("post was modified concurrently", map[string]any{"currentVersion": post.Version})
+}
+
+// commentVersionConflict is postVersionConflict for comments.
+func (r *Resolver) commentVersionConflict(ctx context.Context, id int64) error {
+	comment, err := r.Storage.Comment.GetCommentByID(storage.WithPrimary(ctx), id)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch conflicting comment", slog.String("err", err.Error()))
+		return fmt.Errorf("failed to fetch comment")
+	}
+
+	return conflictError("comment was modified concurrently", map[string]any{"currentVersion": comment.Version})
+}
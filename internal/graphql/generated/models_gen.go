@@ -2,26 +2,304 @@
 
 package generated
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
 type Comment struct {
-	ID        string     `json:"id"`
-	PostID    string     `json:"postID"`
-	ParentID  *string    `json:"parentID,omitempty"`
-	Content   string     `json:"content"`
-	CreatedAt string     `json:"createdAt"`
-	Replies   []*Comment `json:"replies"`
+	ID        string        `json:"id"`
+	PostID    string        `json:"postID"`
+	ParentID  *string       `json:"parentID,omitempty"`
+	ReplyToID *string       `json:"replyToID,omitempty"`
+	Depth     int32         `json:"depth"`
+	Author    *string       `json:"author,omitempty"`
+	Content   string        `json:"content"`
+	Status    CommentStatus `json:"status"`
+	Pinned    bool          `json:"pinned"`
+	CreatedAt string        `json:"createdAt"`
+	Version   int32         `json:"version"`
+	Replies   []*Comment    `json:"replies"`
+}
+
+type CommentLock struct {
+	CommentID string  `json:"commentID"`
+	Reason    string  `json:"reason"`
+	LockedBy  *string `json:"lockedBy,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	ExpiresAt *string `json:"expiresAt,omitempty"`
 }
 
 type Mutation struct {
 }
 
+type Notification struct {
+	ID        string           `json:"id"`
+	Type      NotificationType `json:"type"`
+	PostID    string           `json:"postID"`
+	CommentID string           `json:"commentID"`
+	Read      bool             `json:"read"`
+	CreatedAt string           `json:"createdAt"`
+}
+
 type Post struct {
 	ID               string     `json:"id"`
 	Title            string     `json:"title"`
 	Content          string     `json:"content"`
+	Author           *string    `json:"author,omitempty"`
+	Status           PostStatus `json:"status"`
+	PublishAt        *string    `json:"publishAt,omitempty"`
 	CommentsDisabled bool       `json:"commentsDisabled"`
 	CreatedAt        string     `json:"createdAt"`
+	Version          int32      `json:"version"`
 	Comments         []*Comment `json:"comments"`
+	PinnedComments   []*Comment `json:"pinnedComments"`
 }
 
 type Query struct {
 }
+
+type Subscription struct {
+}
+
+type WebhookDelivery struct {
+	ID            string                `json:"id"`
+	Event         string                `json:"event"`
+	Endpoint      string                `json:"endpoint"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int32                 `json:"attempts"`
+	LastError     *string               `json:"lastError,omitempty"`
+	NextAttemptAt string                `json:"nextAttemptAt"`
+	CreatedAt     string                `json:"createdAt"`
+	DeliveredAt   *string               `json:"deliveredAt,omitempty"`
+}
+
+type CommentStatus string
+
+const (
+	CommentStatusVisible CommentStatus = "VISIBLE"
+	CommentStatusDeleted CommentStatus = "DELETED"
+	CommentStatusSpam    CommentStatus = "SPAM"
+)
+
+var AllCommentStatus = []CommentStatus{
+	CommentStatusVisible,
+	CommentStatusDeleted,
+	CommentStatusSpam,
+}
+
+func (e CommentStatus) IsValid() bool {
+	switch e {
+	case CommentStatusVisible, CommentStatusDeleted, CommentStatusSpam:
+		return true
+	}
+	return false
+}
+
+func (e CommentStatus) String() string {
+	return string(e)
+}
+
+func (e *CommentStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CommentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CommentStatus", str)
+	}
+	return nil
+}
+
+func (e CommentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *CommentStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e CommentStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type NotificationType string
+
+const (
+	NotificationTypeReply   NotificationType = "REPLY"
+	NotificationTypeMention NotificationType = "MENTION"
+)
+
+var AllNotificationType = []NotificationType{
+	NotificationTypeReply,
+	NotificationTypeMention,
+}
+
+func (e NotificationType) IsValid() bool {
+	switch e {
+	case NotificationTypeReply, NotificationTypeMention:
+		return true
+	}
+	return false
+}
+
+func (e NotificationType) String() string {
+	return string(e)
+}
+
+func (e *NotificationType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = NotificationType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid NotificationType", str)
+	}
+	return nil
+}
+
+func (e NotificationType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *NotificationType) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e NotificationType) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type PostStatus string
+
+const (
+	PostStatusDraft     PostStatus = "DRAFT"
+	PostStatusScheduled PostStatus = "SCHEDULED"
+	PostStatusPublished PostStatus = "PUBLISHED"
+	PostStatusArchived  PostStatus = "ARCHIVED"
+)
+
+var AllPostStatus = []PostStatus{
+	PostStatusDraft,
+	PostStatusScheduled,
+	PostStatusPublished,
+	PostStatusArchived,
+}
+
+func (e PostStatus) IsValid() bool {
+	switch e {
+	case PostStatusDraft, PostStatusScheduled, PostStatusPublished, PostStatusArchived:
+		return true
+	}
+	return false
+}
+
+func (e PostStatus) String() string {
+	return string(e)
+}
+
+func (e *PostStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PostStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PostStatus", str)
+	}
+	return nil
+}
+
+func (e PostStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *PostStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e PostStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "PENDING"
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "DELIVERED"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "FAILED"
+)
+
+var AllWebhookDeliveryStatus = []WebhookDeliveryStatus{
+	WebhookDeliveryStatusPending,
+	WebhookDeliveryStatusDelivered,
+	WebhookDeliveryStatusFailed,
+}
+
+func (e WebhookDeliveryStatus) IsValid() bool {
+	switch e {
+	case WebhookDeliveryStatusPending, WebhookDeliveryStatusDelivered, WebhookDeliveryStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e WebhookDeliveryStatus) String() string {
+	return string(e)
+}
+
+func (e *WebhookDeliveryStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WebhookDeliveryStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WebhookDeliveryStatus", str)
+	}
+	return nil
+}
+
+func (e WebhookDeliveryStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *WebhookDeliveryStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e WebhookDeliveryStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -34,6 +34,7 @@ type Config struct {
 type ResolverRoot interface {
 	Mutation() MutationResolver
 	Query() QueryResolver
+	Subscription() SubscriptionResolver
 }
 
 type DirectiveRoot struct {
@@ -41,35 +42,93 @@ type DirectiveRoot struct {
 
 type ComplexityRoot struct {
 	Comment struct {
+		Author    func(childComplexity int) int
 		Content   func(childComplexity int) int
 		CreatedAt func(childComplexity int) int
+		Depth     func(childComplexity int) int
 		ID        func(childComplexity int) int
 		ParentID  func(childComplexity int) int
+		Pinned    func(childComplexity int) int
 		PostID    func(childComplexity int) int
 		Replies   func(childComplexity int) int
+		ReplyToID func(childComplexity int) int
+		Status    func(childComplexity int) int
+		Version   func(childComplexity int) int
+	}
+
+	CommentLock struct {
+		CommentID func(childComplexity int) int
+		CreatedAt func(childComplexity int) int
+		ExpiresAt func(childComplexity int) int
+		LockedBy  func(childComplexity int) int
+		Reason    func(childComplexity int) int
 	}
 
 	Mutation struct {
-		CreateComment func(childComplexity int, postID string, content string, parentID *string) int
-		CreatePost    func(childComplexity int, title string, content string, commentsDisabled bool) int
-		DeleteComment func(childComplexity int, id string) int
-		DeletePost    func(childComplexity int, id string) int
+		ArchivePost           func(childComplexity int, id string, expectedVersion *int32) int
+		CreateComment         func(childComplexity int, postID string, content string, parentID *string, idempotencyKey *string) int
+		CreatePost            func(childComplexity int, title string, content string, commentsDisabled bool, status *PostStatus, idempotencyKey *string) int
+		DeleteComment         func(childComplexity int, id string, expectedVersion *int32) int
+		DeletePost            func(childComplexity int, id string, expectedVersion *int32) int
+		LockComment           func(childComplexity int, id string, reason string, expiresAt *string) int
+		MarkNotificationsRead func(childComplexity int, ids []string) int
+		PinComment            func(childComplexity int, postID string, commentID string) int
+		PublishPost           func(childComplexity int, id string, expectedVersion *int32) int
+		SchedulePost          func(childComplexity int, id string, publishAt string, expectedVersion *int32) int
+		SetCommentsDisabled   func(childComplexity int, postID string, disabled bool, expectedVersion *int32) int
+		UnlockComment         func(childComplexity int, id string) int
+		UnpinComment          func(childComplexity int, postID string, commentID string) int
+		UpdateComment         func(childComplexity int, id string, content string, expectedVersion *int32) int
+		UpdatePost            func(childComplexity int, id string, title string, content string, expectedVersion *int32) int
+	}
+
+	Notification struct {
+		CommentID func(childComplexity int) int
+		CreatedAt func(childComplexity int) int
+		ID        func(childComplexity int) int
+		PostID    func(childComplexity int) int
+		Read      func(childComplexity int) int
+		Type      func(childComplexity int) int
 	}
 
 	Post struct {
+		Author           func(childComplexity int) int
 		Comments         func(childComplexity int) int
 		CommentsDisabled func(childComplexity int) int
 		Content          func(childComplexity int) int
 		CreatedAt        func(childComplexity int) int
 		ID               func(childComplexity int) int
+		PinnedComments   func(childComplexity int) int
+		PublishAt        func(childComplexity int) int
+		Status           func(childComplexity int) int
 		Title            func(childComplexity int) int
+		Version          func(childComplexity int) int
 	}
 
 	Query struct {
-		Comment  func(childComplexity int, id string) int
-		Comments func(childComplexity int, postID string, limit *int32, offset *int32) int
-		Post     func(childComplexity int, id string) int
-		Posts    func(childComplexity int, limit *int32, offset *int32) int
+		Comment           func(childComplexity int, id string) int
+		Comments          func(childComplexity int, postID string, limit *int32, offset *int32) int
+		Notifications     func(childComplexity int, unreadOnly *bool, first *int32, after *string) int
+		Post              func(childComplexity int, id string) int
+		Posts             func(childComplexity int, limit *int32, offset *int32) int
+		Thread            func(childComplexity int, postID string, rootID *string, maxDepth *int32) int
+		WebhookDeliveries func(childComplexity int, status *WebhookDeliveryStatus, limit *int32, offset *int32) int
+	}
+
+	Subscription struct {
+		NotificationAdded func(childComplexity int) int
+	}
+
+	WebhookDelivery struct {
+		Attempts      func(childComplexity int) int
+		CreatedAt     func(childComplexity int) int
+		DeliveredAt   func(childComplexity int) int
+		Endpoint      func(childComplexity int) int
+		Event         func(childComplexity int) int
+		ID            func(childComplexity int) int
+		LastError     func(childComplexity int) int
+		NextAttemptAt func(childComplexity int) int
+		Status        func(childComplexity int) int
 	}
 }
 
@@ -92,6 +151,13 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 	_ = ec
 	switch typeName + "." + field {
 
+	case "Comment.author":
+		if e.complexity.Comment.Author == nil {
+			break
+		}
+
+		return e.complexity.Comment.Author(childComplexity), true
+
 	case "Comment.content":
 		if e.complexity.Comment.Content == nil {
 			break
@@ -106,6 +172,13 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Comment.CreatedAt(childComplexity), true
 
+	case "Comment.depth":
+		if e.complexity.Comment.Depth == nil {
+			break
+		}
+
+		return e.complexity.Comment.Depth(childComplexity), true
+
 	case "Comment.id":
 		if e.complexity.Comment.ID == nil {
 			break
@@ -120,6 +193,13 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Comment.ParentID(childComplexity), true
 
+	case "Comment.pinned":
+		if e.complexity.Comment.Pinned == nil {
+			break
+		}
+
+		return e.complexity.Comment.Pinned(childComplexity), true
+
 	case "Comment.postID":
 		if e.complexity.Comment.PostID == nil {
 			break
@@ -134,6 +214,74 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Comment.Replies(childComplexity), true
 
+	case "Comment.replyToID":
+		if e.complexity.Comment.ReplyToID == nil {
+			break
+		}
+
+		return e.complexity.Comment.ReplyToID(childComplexity), true
+
+	case "Comment.status":
+		if e.complexity.Comment.Status == nil {
+			break
+		}
+
+		return e.complexity.Comment.Status(childComplexity), true
+
+	case "Comment.version":
+		if e.complexity.Comment.Version == nil {
+			break
+		}
+
+		return e.complexity.Comment.Version(childComplexity), true
+
+	case "CommentLock.commentID":
+		if e.complexity.CommentLock.CommentID == nil {
+			break
+		}
+
+		return e.complexity.CommentLock.CommentID(childComplexity), true
+
+	case "CommentLock.createdAt":
+		if e.complexity.CommentLock.CreatedAt == nil {
+			break
+		}
+
+		return e.complexity.CommentLock.CreatedAt(childComplexity), true
+
+	case "CommentLock.expiresAt":
+		if e.complexity.CommentLock.ExpiresAt == nil {
+			break
+		}
+
+		return e.complexity.CommentLock.ExpiresAt(childComplexity), true
+
+	case "CommentLock.lockedBy":
+		if e.complexity.CommentLock.LockedBy == nil {
+			break
+		}
+
+		return e.complexity.CommentLock.LockedBy(childComplexity), true
+
+	case "CommentLock.reason":
+		if e.complexity.CommentLock.Reason == nil {
+			break
+		}
+
+		return e.complexity.CommentLock.Reason(childComplexity), true
+
+	case "Mutation.archivePost":
+		if e.complexity.Mutation.ArchivePost == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_archivePost_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.ArchivePost(childComplexity, args["id"].(string), args["expectedVersion"].(*int32)), true
+
 	case "Mutation.createComment":
 		if e.complexity.Mutation.CreateComment == nil {
 			break
@@ -144,7 +292,7 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 			return 0, false
 		}
 
-		return e.complexity.Mutation.CreateComment(childComplexity, args["postID"].(string), args["content"].(string), args["parentID"].(*string)), true
+		return e.complexity.Mutation.CreateComment(childComplexity, args["postID"].(string), args["content"].(string), args["parentID"].(*string), args["idempotencyKey"].(*string)), true
 
 	case "Mutation.createPost":
 		if e.complexity.Mutation.CreatePost == nil {
@@ -156,7 +304,7 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 			return 0, false
 		}
 
-		return e.complexity.Mutation.CreatePost(childComplexity, args["title"].(string), args["content"].(string), args["commentsDisabled"].(bool)), true
+		return e.complexity.Mutation.CreatePost(childComplexity, args["title"].(string), args["content"].(string), args["commentsDisabled"].(bool), args["status"].(*PostStatus), args["idempotencyKey"].(*string)), true
 
 	case "Mutation.deleteComment":
 		if e.complexity.Mutation.DeleteComment == nil {
@@ -168,7 +316,7 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 			return 0, false
 		}
 
-		return e.complexity.Mutation.DeleteComment(childComplexity, args["id"].(string)), true
+		return e.complexity.Mutation.DeleteComment(childComplexity, args["id"].(string), args["expectedVersion"].(*int32)), true
 
 	case "Mutation.deletePost":
 		if e.complexity.Mutation.DeletePost == nil {
@@ -180,7 +328,176 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 			return 0, false
 		}
 
-		return e.complexity.Mutation.DeletePost(childComplexity, args["id"].(string)), true
+		return e.complexity.Mutation.DeletePost(childComplexity, args["id"].(string), args["expectedVersion"].(*int32)), true
+
+	case "Mutation.lockComment":
+		if e.complexity.Mutation.LockComment == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_lockComment_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.LockComment(childComplexity, args["id"].(string), args["reason"].(string), args["expiresAt"].(*string)), true
+
+	case "Mutation.markNotificationsRead":
+		if e.complexity.Mutation.MarkNotificationsRead == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_markNotificationsRead_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.MarkNotificationsRead(childComplexity, args["ids"].([]string)), true
+
+	case "Mutation.pinComment":
+		if e.complexity.Mutation.PinComment == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_pinComment_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.PinComment(childComplexity, args["postID"].(string), args["commentID"].(string)), true
+
+	case "Mutation.publishPost":
+		if e.complexity.Mutation.PublishPost == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_publishPost_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.PublishPost(childComplexity, args["id"].(string), args["expectedVersion"].(*int32)), true
+
+	case "Mutation.schedulePost":
+		if e.complexity.Mutation.SchedulePost == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_schedulePost_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.SchedulePost(childComplexity, args["id"].(string), args["publishAt"].(string), args["expectedVersion"].(*int32)), true
+
+	case "Mutation.setCommentsDisabled":
+		if e.complexity.Mutation.SetCommentsDisabled == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_setCommentsDisabled_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.SetCommentsDisabled(childComplexity, args["postID"].(string), args["disabled"].(bool), args["expectedVersion"].(*int32)), true
+
+	case "Mutation.unlockComment":
+		if e.complexity.Mutation.UnlockComment == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_unlockComment_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.UnlockComment(childComplexity, args["id"].(string)), true
+
+	case "Mutation.unpinComment":
+		if e.complexity.Mutation.UnpinComment == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_unpinComment_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.UnpinComment(childComplexity, args["postID"].(string), args["commentID"].(string)), true
+
+	case "Mutation.updateComment":
+		if e.complexity.Mutation.UpdateComment == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_updateComment_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.UpdateComment(childComplexity, args["id"].(string), args["content"].(string), args["expectedVersion"].(*int32)), true
+
+	case "Mutation.updatePost":
+		if e.complexity.Mutation.UpdatePost == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_updatePost_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.UpdatePost(childComplexity, args["id"].(string), args["title"].(string), args["content"].(string), args["expectedVersion"].(*int32)), true
+
+	case "Notification.commentID":
+		if e.complexity.Notification.CommentID == nil {
+			break
+		}
+
+		return e.complexity.Notification.CommentID(childComplexity), true
+
+	case "Notification.createdAt":
+		if e.complexity.Notification.CreatedAt == nil {
+			break
+		}
+
+		return e.complexity.Notification.CreatedAt(childComplexity), true
+
+	case "Notification.id":
+		if e.complexity.Notification.ID == nil {
+			break
+		}
+
+		return e.complexity.Notification.ID(childComplexity), true
+
+	case "Notification.postID":
+		if e.complexity.Notification.PostID == nil {
+			break
+		}
+
+		return e.complexity.Notification.PostID(childComplexity), true
+
+	case "Notification.read":
+		if e.complexity.Notification.Read == nil {
+			break
+		}
+
+		return e.complexity.Notification.Read(childComplexity), true
+
+	case "Notification.type":
+		if e.complexity.Notification.Type == nil {
+			break
+		}
+
+		return e.complexity.Notification.Type(childComplexity), true
+
+	case "Post.author":
+		if e.complexity.Post.Author == nil {
+			break
+		}
+
+		return e.complexity.Post.Author(childComplexity), true
 
 	case "Post.comments":
 		if e.complexity.Post.Comments == nil {
@@ -217,6 +534,27 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Post.ID(childComplexity), true
 
+	case "Post.pinnedComments":
+		if e.complexity.Post.PinnedComments == nil {
+			break
+		}
+
+		return e.complexity.Post.PinnedComments(childComplexity), true
+
+	case "Post.publishAt":
+		if e.complexity.Post.PublishAt == nil {
+			break
+		}
+
+		return e.complexity.Post.PublishAt(childComplexity), true
+
+	case "Post.status":
+		if e.complexity.Post.Status == nil {
+			break
+		}
+
+		return e.complexity.Post.Status(childComplexity), true
+
 	case "Post.title":
 		if e.complexity.Post.Title == nil {
 			break
@@ -224,6 +562,13 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Post.Title(childComplexity), true
 
+	case "Post.version":
+		if e.complexity.Post.Version == nil {
+			break
+		}
+
+		return e.complexity.Post.Version(childComplexity), true
+
 	case "Query.comment":
 		if e.complexity.Query.Comment == nil {
 			break
@@ -248,6 +593,18 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Query.Comments(childComplexity, args["postID"].(string), args["limit"].(*int32), args["offset"].(*int32)), true
 
+	case "Query.notifications":
+		if e.complexity.Query.Notifications == nil {
+			break
+		}
+
+		args, err := ec.field_Query_notifications_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Query.Notifications(childComplexity, args["unreadOnly"].(*bool), args["first"].(*int32), args["after"].(*string)), true
+
 	case "Query.post":
 		if e.complexity.Query.Post == nil {
 			break
@@ -272,6 +629,100 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Query.Posts(childComplexity, args["limit"].(*int32), args["offset"].(*int32)), true
 
+	case "Query.thread":
+		if e.complexity.Query.Thread == nil {
+			break
+		}
+
+		args, err := ec.field_Query_thread_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Query.Thread(childComplexity, args["postID"].(string), args["rootID"].(*string), args["maxDepth"].(*int32)), true
+
+	case "Query.webhookDeliveries":
+		if e.complexity.Query.WebhookDeliveries == nil {
+			break
+		}
+
+		args, err := ec.field_Query_webhookDeliveries_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Query.WebhookDeliveries(childComplexity, args["status"].(*WebhookDeliveryStatus), args["limit"].(*int32), args["offset"].(*int32)), true
+
+	case "Subscription.notificationAdded":
+		if e.complexity.Subscription.NotificationAdded == nil {
+			break
+		}
+
+		return e.complexity.Subscription.NotificationAdded(childComplexity), true
+
+	case "WebhookDelivery.attempts":
+		if e.complexity.WebhookDelivery.Attempts == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.Attempts(childComplexity), true
+
+	case "WebhookDelivery.createdAt":
+		if e.complexity.WebhookDelivery.CreatedAt == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.CreatedAt(childComplexity), true
+
+	case "WebhookDelivery.deliveredAt":
+		if e.complexity.WebhookDelivery.DeliveredAt == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.DeliveredAt(childComplexity), true
+
+	case "WebhookDelivery.endpoint":
+		if e.complexity.WebhookDelivery.Endpoint == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.Endpoint(childComplexity), true
+
+	case "WebhookDelivery.event":
+		if e.complexity.WebhookDelivery.Event == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.Event(childComplexity), true
+
+	case "WebhookDelivery.id":
+		if e.complexity.WebhookDelivery.ID == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.ID(childComplexity), true
+
+	case "WebhookDelivery.lastError":
+		if e.complexity.WebhookDelivery.LastError == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.LastError(childComplexity), true
+
+	case "WebhookDelivery.nextAttemptAt":
+		if e.complexity.WebhookDelivery.NextAttemptAt == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.NextAttemptAt(childComplexity), true
+
+	case "WebhookDelivery.status":
+		if e.complexity.WebhookDelivery.Status == nil {
+			break
+		}
+
+		return e.complexity.WebhookDelivery.Status(childComplexity), true
+
 	}
 	return 0, false
 }
@@ -324,6 +775,23 @@ func (e *executableSchema) Exec(ctx context.Context) graphql.ResponseHandler {
 			var buf bytes.Buffer
 			data.MarshalGQL(&buf)
 
+			return &graphql.Response{
+				Data: buf.Bytes(),
+			}
+		}
+	case ast.Subscription:
+		next := ec._Subscription(ctx, opCtx.Operation.SelectionSet)
+
+		var buf bytes.Buffer
+		return func(ctx context.Context) *graphql.Response {
+			buf.Reset()
+			data := next(ctx)
+
+			if data == nil {
+				return nil
+			}
+			data.MarshalGQL(&buf)
+
 			return &graphql.Response{
 				Data: buf.Bytes(),
 			}
@@ -376,36 +844,120 @@ func (ec *executionContext) introspectType(name string) (*introspection.Type, er
 }
 
 var sources = []*ast.Source{
-	{Name: "../../../graph/schema.graphqls", Input: `type Post {
+	{Name: "../../../graph/schema.graphqls", Input: `enum PostStatus {
+    DRAFT
+    SCHEDULED
+    PUBLISHED
+    ARCHIVED
+}
+
+enum CommentStatus {
+    VISIBLE
+    DELETED
+    SPAM
+}
+
+type Post {
     id: ID!
     title: String!
     content: String!
+    author: String
+    status: PostStatus!
+    publishAt: String
     commentsDisabled: Boolean!
     createdAt: String!
+    version: Int!
     comments: [Comment!]!
+    pinnedComments: [Comment!]!
 }
 
 type Comment {
     id: ID!
     postID: ID!
     parentID: ID
+    replyToID: ID
+    depth: Int!
+    author: String
     content: String!
+    status: CommentStatus!
+    pinned: Boolean!
     createdAt: String!
+    version: Int!
     replies: [Comment!]!
 }
 
+type CommentLock {
+    commentID: ID!
+    reason: String!
+    lockedBy: String
+    createdAt: String!
+    expiresAt: String
+}
+
+enum NotificationType {
+    REPLY
+    MENTION
+}
+
+type Notification {
+    id: ID!
+    type: NotificationType!
+    postID: ID!
+    commentID: ID!
+    read: Boolean!
+    createdAt: String!
+}
+
+enum WebhookDeliveryStatus {
+    PENDING
+    DELIVERED
+    FAILED
+}
+
+type WebhookDelivery {
+    id: ID!
+    event: String!
+    endpoint: String!
+    status: WebhookDeliveryStatus!
+    attempts: Int!
+    lastError: String
+    nextAttemptAt: String!
+    createdAt: String!
+    deliveredAt: String
+}
+
 type Query {
     post(id: ID!): Post
     posts(limit: Int = 10, offset: Int = 0): [Post!]!
     comment(id: ID!): Comment
     comments(postID: ID!, limit: Int = 10, offset: Int = 0): [Comment!]!
+    # thread returns at most threads.max_thread_comments comments, level by
+    # level. Replies cut off can be fetched with one of their ancestors as rootID.
+    thread(postID: ID!, rootID: ID, maxDepth: Int = 0): [Comment!]!
+    notifications(unreadOnly: Boolean = false, first: Int = 20, after: ID): [Notification!]!
+    webhookDeliveries(status: WebhookDeliveryStatus, limit: Int = 10, offset: Int = 0): [WebhookDelivery!]!
 }
 
 type Mutation {
-    createPost(title: String!, content: String!, commentsDisabled: Boolean!): Post!
-    createComment(postID: ID!, content: String!, parentID: ID): Comment!
-    deletePost(id: ID!): Boolean!
-    deleteComment(id: ID!): Boolean!
+    createPost(title: String!, content: String!, commentsDisabled: Boolean!, status: PostStatus = PUBLISHED, idempotencyKey: String): Post!
+    createComment(postID: ID!, content: String!, parentID: ID, idempotencyKey: String): Comment!
+    updatePost(id: ID!, title: String!, content: String!, expectedVersion: Int): Post!
+    updateComment(id: ID!, content: String!, expectedVersion: Int): Comment!
+    deletePost(id: ID!, expectedVersion: Int): Boolean!
+    publishPost(id: ID!, expectedVersion: Int): Post!
+    schedulePost(id: ID!, publishAt: String!, expectedVersion: Int): Post!
+    archivePost(id: ID!, expectedVersion: Int): Post!
+    deleteComment(id: ID!, expectedVersion: Int): Boolean!
+    markNotificationsRead(ids: [ID!]): Int!
+    setCommentsDisabled(postID: ID!, disabled: Boolean!, expectedVersion: Int): Post!
+    lockComment(id: ID!, reason: String!, expiresAt: String): CommentLock!
+    unlockComment(id: ID!): Boolean!
+    pinComment(postID: ID!, commentID: ID!): Post!
+    unpinComment(postID: ID!, commentID: ID!): Post!
+}
+
+type Subscription {
+    notificationAdded: Notification!
 }
 `, BuiltIn: false},
 }
@@ -3,28 +3,40 @@ package graphql
 import (
 	"context"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"log/slog"
 
-	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/notification"
 	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/Pacahar/graphql-comments/internal/webhook"
 	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 func setupResolver(t *testing.T) *Resolver {
-	postStorage, err := memory.NewPostMemoryStorage()
+	st, err := memory.NewMemoryStorage()
 	assert.NoError(t, err)
 
-	commentStorage, err := memory.NewCommentMemoryStorage()
-	assert.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(&testWriter{}, &slog.HandlerOptions{}))
+	webhooks := webhook.NewDispatcher(config.Webhooks{
+		Endpoints: []config.WebhookEndpoint{{URL: "http://127.0.0.1:9/hooks", Secret: "secret"}},
+	}, st.Webhook, logger)
 
 	resolver := &Resolver{
-		Storage: &storage.Storage{
-			Post:    postStorage,
-			Comment: commentStorage,
-		},
-		Logger: slog.New(slog.NewTextHandler(&testWriter{}, &slog.HandlerOptions{})),
+		Storage:     st,
+		Logger:      logger,
+		Broker:      notification.NewBroker(),
+		Webhooks:    webhooks,
+		Idempotency: config.Idempotency{TTL: time.Hour, InFlightTTL: time.Minute},
+		Admins:      []string{"admin"},
 	}
 
 	return resolver
@@ -35,7 +47,7 @@ func TestCreateAndFetchPost(t *testing.T) {
 	ctx := context.Background()
 	mutation := &mutationResolver{resolver}
 
-	post, err := mutation.CreatePost(ctx, "Title", "Content", false)
+	post, err := mutation.CreatePost(ctx, "Title", "Content", false, nil, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "Title", post.Title)
 	assert.Equal(t, "Content", post.Content)
@@ -53,41 +65,51 @@ func TestCreateComment(t *testing.T) {
 	ctx := context.Background()
 	mutation := &mutationResolver{resolver}
 
-	post, _ := mutation.CreatePost(ctx, "Title", "Content", false)
+	post, _ := mutation.CreatePost(ctx, "Title", "Content", false, nil, nil)
 
-	comment, err := mutation.CreateComment(ctx, post.ID, "comment", nil)
+	comment, err := mutation.CreateComment(ctx, post.ID, "comment", nil, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "comment", comment.Content)
 	assert.Equal(t, post.ID, comment.PostID)
 	assert.Nil(t, comment.ParentID)
 
-	childComment, err := mutation.CreateComment(ctx, post.ID, "Child comment", &comment.ID)
+	childComment, err := mutation.CreateComment(ctx, post.ID, "Child comment", &comment.ID, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, comment.ID, *childComment.ParentID)
 
 	query := &queryResolver{resolver}
 	fetchedComments, err := query.Comments(ctx, post.ID, nil, nil)
 	assert.NoError(t, err)
-	assert.Len(t, fetchedComments, 2)
+	assert.Len(t, fetchedComments, 1)
 
-	var foundChild bool
-	for _, c := range fetchedComments {
-		if c.ParentID != nil && *c.ParentID == comment.ID {
-			foundChild = true
-		}
+	// Replies are nested under their root rather than listed alongside it.
+	if assert.Len(t, fetchedComments[0].Replies, 1) {
+		assert.Equal(t, childComment.ID, fetchedComments[0].Replies[0].ID)
 	}
-	assert.True(t, foundChild)
 }
 
-func TestDeletePostAndComments(t *testing.T) {
+func TestReplyToCommentOnOtherPost(t *testing.T) {
 	resolver := setupResolver(t)
 	ctx := context.Background()
 	mutation := &mutationResolver{resolver}
 
-	post, _ := mutation.CreatePost(ctx, "Post", "Content", false)
-	comment, _ := mutation.CreateComment(ctx, post.ID, "Comment", nil)
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	otherPost, _ := mutation.CreatePost(ctx, "Other post", "Content", false, nil, nil)
+	parent, _ := mutation.CreateComment(ctx, otherPost.ID, "Parent", nil, nil)
 
-	ok, err := mutation.DeletePost(ctx, post.ID)
+	_, err := mutation.CreateComment(ctx, post.ID, "Reply", &parent.ID, nil)
+	assert.EqualError(t, err, "parent comment belongs to another post")
+}
+
+func TestDeletePostAndComments(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := auth.WithUser(context.Background(), "alice")
+	mutation := &mutationResolver{resolver}
+
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	comment, _ := mutation.CreateComment(ctx, post.ID, "Comment", nil, nil)
+
+	ok, err := mutation.DeletePost(ctx, post.ID, nil)
 	assert.NoError(t, err)
 	assert.True(t, ok)
 
@@ -102,13 +124,13 @@ func TestDeletePostAndComments(t *testing.T) {
 
 func TestDeleteComment(t *testing.T) {
 	resolver := setupResolver(t)
-	ctx := context.Background()
+	ctx := auth.WithUser(context.Background(), "alice")
 	mutation := &mutationResolver{resolver}
 
-	post, _ := mutation.CreatePost(ctx, "Post", "Content", false)
-	comment, _ := mutation.CreateComment(ctx, post.ID, "Comment", nil)
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	comment, _ := mutation.CreateComment(ctx, post.ID, "Comment", nil, nil)
 
-	ok, err := mutation.DeleteComment(ctx, comment.ID)
+	ok, err := mutation.DeleteComment(ctx, comment.ID, nil)
 	assert.NoError(t, err)
 	assert.True(t, ok)
 
@@ -117,6 +139,45 @@ func TestDeleteComment(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDeleteRequiresOwnership(t *testing.T) {
+	resolver := setupResolver(t)
+	aliceCtx := auth.WithUser(context.Background(), "alice")
+	bobCtx := auth.WithUser(context.Background(), "bob")
+	mutation := &mutationResolver{resolver}
+
+	post, err := mutation.CreatePost(aliceCtx, "Post", "Content", false, nil, nil)
+	assert.NoError(t, err)
+
+	comment, err := mutation.CreateComment(aliceCtx, post.ID, "Comment", nil, nil)
+	assert.NoError(t, err)
+
+	for name, ctx := range map[string]context.Context{"anonymous": context.Background(), "other user": bobCtx} {
+		_, err = mutation.DeletePost(ctx, post.ID, nil)
+		assert.EqualError(t, err, "forbidden", name)
+
+		_, err = mutation.DeleteComment(ctx, comment.ID, nil)
+		assert.EqualError(t, err, "forbidden", name)
+	}
+
+	_, err = resolver.Storage.Comment.GetCommentByID(aliceCtx, mustParseID(t, comment.ID))
+	assert.NoError(t, err)
+
+	// Nothing was deleted, so nothing was announced.
+	deliveries, err := resolver.Storage.Webhook.GetDeliveries(aliceCtx, nil, nil, nil)
+	assert.NoError(t, err)
+	for _, delivery := range deliveries {
+		assert.NotContains(t, []string{"post.deleted", "comment.deleted"}, delivery.Event)
+	}
+
+	deleted, err := mutation.DeleteComment(auth.WithUser(context.Background(), "admin"), comment.ID, nil)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = mutation.DeletePost(aliceCtx, post.ID, nil)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+}
+
 func TestFetchPostsWithPagination(t *testing.T) {
 	resolver := setupResolver(t)
 	ctx := context.Background()
@@ -124,7 +185,7 @@ func TestFetchPostsWithPagination(t *testing.T) {
 	query := &queryResolver{resolver}
 
 	for i := 1; i <= 5; i++ {
-		_, _ = mutation.CreatePost(ctx, "Post "+strconv.Itoa(i), "Content", false)
+		_, _ = mutation.CreatePost(ctx, "Post "+strconv.Itoa(i), "Content", false, nil, nil)
 	}
 
 	posts, err := query.Posts(ctx, nil, nil)
@@ -138,8 +199,610 @@ func TestFetchPostsWithPagination(t *testing.T) {
 	assert.Len(t, paged, 2)
 }
 
+func TestReplyAndMentionNotifications(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := context.Background()
+	mutation := &mutationResolver{resolver}
+	query := &queryResolver{resolver}
+	subscription := &subscriptionResolver{resolver}
+
+	aliceCtx := auth.WithUser(ctx, "alice")
+	bobCtx := auth.WithUser(ctx, "bob")
+
+	subCtx, cancel := context.WithCancel(aliceCtx)
+	defer cancel()
+
+	added, err := subscription.NotificationAdded(subCtx)
+	assert.NoError(t, err)
+
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	comment, err := mutation.CreateComment(aliceCtx, post.ID, "Comment", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", *comment.Author)
+
+	_, err = mutation.CreateComment(bobCtx, post.ID, "Agreed @alice, cc @carol and @bob", &comment.ID, nil)
+	assert.NoError(t, err)
+
+	pushed := <-added
+	assert.Equal(t, "REPLY", pushed.Type.String())
+
+	notifications, err := query.Notifications(aliceCtx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 1)
+	assert.False(t, notifications[0].Read)
+
+	carolCtx := auth.WithUser(ctx, "carol")
+	mentions, err := query.Notifications(carolCtx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, mentions, 1)
+	assert.Equal(t, "MENTION", mentions[0].Type.String())
+
+	bobNotifications, err := query.Notifications(bobCtx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, bobNotifications, 0)
+
+	marked, err := mutation.MarkNotificationsRead(aliceCtx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), marked)
+
+	unreadOnly := true
+	unread, err := query.Notifications(aliceCtx, &unreadOnly, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, unread, 0)
+
+	_, err = query.Notifications(ctx, nil, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestSubscriptionsEndWhenBrokerCloses(t *testing.T) {
+	resolver := setupResolver(t)
+	subscription := &subscriptionResolver{resolver}
+	aliceCtx := auth.WithUser(context.Background(), "alice")
+
+	added, err := subscription.NotificationAdded(aliceCtx)
+	assert.NoError(t, err)
+
+	resolver.Broker.Close()
+
+	_, open := <-added
+	assert.False(t, open)
+
+	// Subscriptions made while shutting down end right away.
+	late, err := subscription.NotificationAdded(aliceCtx)
+	assert.NoError(t, err)
+
+	_, open = <-late
+	assert.False(t, open)
+}
+
+func TestWebhookDeliveriesQuery(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := auth.WithUser(context.Background(), "alice")
+	mutation := &mutationResolver{resolver}
+	query := &queryResolver{resolver}
+
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	comment, _ := mutation.CreateComment(ctx, post.ID, "Comment", nil, nil)
+	_, _ = mutation.DeleteComment(ctx, comment.ID, nil)
+
+	_, err := query.WebhookDeliveries(ctx, nil, nil, nil)
+	assert.Error(t, err)
+
+	adminCtx := auth.WithUser(ctx, "admin")
+	deliveries, err := query.WebhookDeliveries(adminCtx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 3)
+	assert.Equal(t, "comment.deleted", deliveries[0].Event)
+	assert.Equal(t, "post.created", deliveries[2].Event)
+
+	delivered := generated.WebhookDeliveryStatusDelivered
+	deliveries, err = query.WebhookDeliveries(adminCtx, &delivered, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 0)
+}
+
+func TestSetCommentsDisabled(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := context.Background()
+	adminCtx := auth.WithUser(ctx, "admin")
+	mutation := &mutationResolver{resolver}
+
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+
+	_, err := mutation.SetCommentsDisabled(ctx, post.ID, true, nil)
+	assert.Error(t, err)
+
+	updated, err := mutation.SetCommentsDisabled(adminCtx, post.ID, true, nil)
+	assert.NoError(t, err)
+	assert.True(t, updated.CommentsDisabled)
+
+	_, err = mutation.CreateComment(ctx, post.ID, "Comment", nil, nil)
+	assert.Error(t, err)
+
+	_, err = mutation.SetCommentsDisabled(adminCtx, post.ID, false, nil)
+	assert.NoError(t, err)
+
+	_, err = mutation.CreateComment(ctx, post.ID, "Comment", nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestLockCommentBlocksSubtree(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := context.Background()
+	adminCtx := auth.WithUser(ctx, "admin")
+	mutation := &mutationResolver{resolver}
+
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	root, _ := mutation.CreateComment(ctx, post.ID, "Root", nil, nil)
+	child, _ := mutation.CreateComment(ctx, post.ID, "Child", &root.ID, nil)
+	other, _ := mutation.CreateComment(ctx, post.ID, "Other", nil, nil)
+
+	_, err := mutation.LockComment(ctx, root.ID, "heated", nil)
+	assert.Error(t, err)
+
+	lock, err := mutation.LockComment(adminCtx, root.ID, "heated", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "heated", lock.Reason)
+	assert.Equal(t, "admin", *lock.LockedBy)
+	assert.Nil(t, lock.ExpiresAt)
+
+	_, err = mutation.CreateComment(ctx, post.ID, "Reply", &child.ID, nil)
+	assert.ErrorContains(t, err, "heated")
+
+	_, err = mutation.CreateComment(ctx, post.ID, "Reply", &other.ID, nil)
+	assert.NoError(t, err)
+
+	_, err = mutation.LockComment(adminCtx, root.ID, "heated", strPtr("2000-01-01T00:00:00Z"))
+	assert.Error(t, err)
+
+	ok, err := mutation.UnlockComment(adminCtx, root.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = mutation.CreateComment(ctx, post.ID, "Reply", &child.ID, nil)
+	assert.NoError(t, err)
+}
+
+func TestMaxThreadDepthReject(t *testing.T) {
+	resolver := setupResolver(t)
+	resolver.Threads = config.Threads{MaxDepth: 1, Overflow: constants.OverflowReject}
+	ctx := context.Background()
+	mutation := &mutationResolver{resolver}
+
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	root, _ := mutation.CreateComment(ctx, post.ID, "Root", nil, nil)
+
+	child, err := mutation.CreateComment(ctx, post.ID, "Child", &root.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), child.Depth)
+
+	_, err = mutation.CreateComment(ctx, post.ID, "Too deep", &child.ID, nil)
+	assert.ErrorContains(t, err, "maximum thread depth")
+}
+
+func TestMaxThreadDepthFlatten(t *testing.T) {
+	resolver := setupResolver(t)
+	resolver.Threads = config.Threads{MaxDepth: 2, Overflow: constants.OverflowFlatten}
+	ctx := context.Background()
+	mutation := &mutationResolver{resolver}
+
+	post, _ := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	root, _ := mutation.CreateComment(ctx, post.ID, "Root", nil, nil)
+	child, _ := mutation.CreateComment(ctx, post.ID, "Child", &root.ID, nil)
+	grandchild, _ := mutation.CreateComment(ctx, post.ID, "Grandchild", &child.ID, nil)
+	assert.Equal(t, int32(2), grandchild.Depth)
+	assert.Nil(t, grandchild.ReplyToID)
+
+	flattened, err := mutation.CreateComment(ctx, post.ID, "Flattened", &grandchild.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), flattened.Depth)
+	assert.Equal(t, child.ID, *flattened.ParentID)
+	assert.Equal(t, grandchild.ID, *flattened.ReplyToID)
+}
+
+func TestPinComments(t *testing.T) {
+	resolver := setupResolver(t)
+	resolver.Threads = config.Threads{MaxPins: 2}
+	ctx := context.Background()
+	aliceCtx := auth.WithUser(ctx, "alice")
+	mutation := &mutationResolver{resolver}
+	query := &queryResolver{resolver}
+
+	post, _ := mutation.CreatePost(aliceCtx, "Post", "Content", false, nil, nil)
+	assert.Equal(t, "alice", *post.Author)
+
+	first, _ := mutation.CreateComment(ctx, post.ID, "First", nil, nil)
+	second, _ := mutation.CreateComment(ctx, post.ID, "Second", nil, nil)
+	third, _ := mutation.CreateComment(ctx, post.ID, "Third", nil, nil)
+
+	_, err := mutation.PinComment(auth.WithUser(ctx, "bob"), post.ID, first.ID)
+	assert.Error(t, err)
+
+	_, err = mutation.PinComment(aliceCtx, post.ID, third.ID)
+	assert.NoError(t, err)
+
+	pinned, err := mutation.PinComment(auth.WithUser(ctx, "admin"), post.ID, first.ID)
+	assert.NoError(t, err)
+	assert.Len(t, pinned.PinnedComments, 2)
+	assert.Equal(t, third.ID, pinned.PinnedComments[0].ID)
+	assert.Equal(t, first.ID, pinned.PinnedComments[1].ID)
+
+	_, err = mutation.PinComment(aliceCtx, post.ID, second.ID)
+	assert.ErrorContains(t, err, "at most 2")
+
+	comments, err := query.Comments(ctx, post.ID, nil, nil)
+	assert.NoError(t, err)
+	for _, comment := range comments {
+		assert.Equal(t, comment.ID != second.ID, comment.Pinned)
+	}
+
+	unpinned, err := mutation.UnpinComment(aliceCtx, post.ID, third.ID)
+	assert.NoError(t, err)
+	assert.Len(t, unpinned.PinnedComments, 1)
+	assert.Equal(t, first.ID, unpinned.PinnedComments[0].ID)
+}
+
+func TestDraftsAndScheduledPosts(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := context.Background()
+	aliceCtx := auth.WithUser(ctx, "alice")
+	mutation := &mutationResolver{resolver}
+	query := &queryResolver{resolver}
+
+	draftStatus := generated.PostStatusDraft
+	draft, err := mutation.CreatePost(aliceCtx, "Draft", "Content", false, &draftStatus, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.PostStatusDraft, draft.Status)
+	assert.Nil(t, draft.PublishAt)
+
+	_, err = mutation.CreatePost(ctx, "Draft", "Content", false, &draftStatus, nil)
+	assert.Error(t, err)
+
+	_, _ = mutation.CreatePost(ctx, "Published", "Content", false, nil, nil)
+
+	public, err := query.Posts(ctx, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, public, 1)
+
+	own, err := query.Posts(aliceCtx, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, own, 2)
+
+	_, err = query.Post(ctx, draft.ID)
+	assert.Error(t, err)
+
+	_, err = mutation.CreateComment(aliceCtx, draft.ID, "Comment", nil, nil)
+	assert.Error(t, err)
+
+	_, err = mutation.SchedulePost(aliceCtx, draft.ID, "2000-01-01T00:00:00Z", nil)
+	assert.Error(t, err)
+
+	publishAt := time.Now().Add(time.Hour)
+	_, err = mutation.SchedulePost(auth.WithUser(ctx, "bob"), draft.ID, publishAt.Format(time.RFC3339), nil)
+	assert.Error(t, err)
+
+	scheduled, err := mutation.SchedulePost(aliceCtx, draft.ID, publishAt.Format(time.RFC3339), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.PostStatusScheduled, scheduled.Status)
+
+	published, err := resolver.Storage.Post.PublishDuePosts(ctx, publishAt.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Len(t, published, 1)
+
+	fetched, err := query.Post(ctx, draft.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.PostStatusPublished, fetched.Status)
+
+	archived, err := mutation.ArchivePost(aliceCtx, draft.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.PostStatusArchived, archived.Status)
+
+	_, err = mutation.PublishPost(aliceCtx, draft.ID, nil)
+	assert.Error(t, err)
+}
+
+func TestIdempotentCreate(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := auth.WithUser(context.Background(), "alice")
+	mutation := &mutationResolver{resolver}
+	query := &queryResolver{resolver}
+
+	post, err := mutation.CreatePost(ctx, "Post", "Content", false, nil, strPtr("post-1"))
+	assert.NoError(t, err)
+
+	retried, err := mutation.CreatePost(ctx, "Post", "Content", false, nil, strPtr("post-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, post.ID, retried.ID)
+
+	posts, err := query.Posts(ctx, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+
+	_, err = mutation.CreatePost(ctx, "Other", "Content", false, nil, strPtr("post-1"))
+	var gqlErr *gqlerror.Error
+	assert.ErrorAs(t, err, &gqlErr)
+	assert.Equal(t, CodeConflict, gqlErr.Extensions["code"])
+
+	// Keys are scoped per user.
+	other, err := mutation.CreatePost(auth.WithUser(ctx, "bob"), "Post", "Content", false, nil, strPtr("post-1"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, post.ID, other.ID)
+
+	comment, err := mutation.CreateComment(ctx, post.ID, "Comment", nil, strPtr("comment-1"))
+	assert.NoError(t, err)
+
+	retriedComment, err := mutation.CreateComment(ctx, post.ID, "Comment", nil, strPtr("comment-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, comment.ID, retriedComment.ID)
+
+	// A failed request releases its key so it can be retried.
+	_, err = mutation.CreateComment(ctx, "999", "Comment", nil, strPtr("comment-2"))
+	assert.Error(t, err)
+
+	_, err = mutation.CreateComment(ctx, post.ID, "Comment", nil, strPtr("comment-2"))
+	assert.NoError(t, err)
+
+	comments, err := query.Comments(ctx, post.ID, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 2)
+
+	// Anonymous callers can not tell each other apart, so they get no keys.
+	_, err = mutation.CreatePost(context.Background(), "Post", "Content", false, nil, strPtr("post-1"))
+	assert.Error(t, err)
+}
+
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := auth.WithUser(context.Background(), "alice")
+	mutation := &mutationResolver{resolver}
+
+	expiresIn := func(key string) time.Duration {
+		record, created, err := resolver.Storage.Idempotency.ReserveKey(ctx, idempotencyScope("alice"), key, "probe", time.Now())
+		assert.NoError(t, err)
+		assert.False(t, created)
+
+		return time.Until(record.ExpiresAt)
+	}
+
+	// A request that never finishes, as after a crash, holds its key only
+	// for the in-flight TTL.
+	_, _, err := resolver.reserveIdempotencyKey(ctx, strPtr("crashed"), "createPost")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, expiresIn("crashed"), float64(5*time.Second))
+
+	_, err = mutation.CreatePost(ctx, "Post", "Content", false, nil, strPtr("done"))
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, expiresIn("done"), float64(5*time.Second))
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	resolver := setupResolver(t)
+	aliceCtx := auth.WithUser(context.Background(), "alice")
+	mutation := &mutationResolver{resolver}
+
+	post, err := mutation.CreatePost(aliceCtx, "Post", "Content", false, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), post.Version)
+
+	version := post.Version
+	updated, err := mutation.UpdatePost(aliceCtx, post.ID, "Edited", "Content", &version)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited", updated.Title)
+	assert.Equal(t, int32(2), updated.Version)
+
+	_, err = mutation.UpdatePost(aliceCtx, post.ID, "Stale", "Content", &version)
+	var gqlErr *gqlerror.Error
+	assert.ErrorAs(t, err, &gqlErr)
+	assert.Equal(t, CodeConflict, gqlErr.Extensions["code"])
+	assert.Equal(t, int64(2), gqlErr.Extensions["currentVersion"])
+
+	_, err = mutation.UpdatePost(auth.WithUser(aliceCtx, "bob"), post.ID, "Bob", "Content", nil)
+	assert.Error(t, err)
+
+	comment, err := mutation.CreateComment(aliceCtx, post.ID, "Comment", nil, nil)
+	assert.NoError(t, err)
+
+	_, err = mutation.DeletePost(aliceCtx, post.ID, &version)
+	assert.ErrorAs(t, err, &gqlErr)
+
+	// The stale delete must not have removed the comments.
+	_, err = resolver.Storage.Comment.GetCommentByID(aliceCtx, mustParseID(t, comment.ID))
+	assert.NoError(t, err)
+
+	commentVersion := comment.Version
+	editedComment, err := mutation.UpdateComment(aliceCtx, comment.ID, "Edited", &commentVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), editedComment.Version)
+
+	_, err = mutation.DeleteComment(aliceCtx, comment.ID, &commentVersion)
+	assert.ErrorAs(t, err, &gqlErr)
+	assert.Equal(t, int64(2), gqlErr.Extensions["currentVersion"])
+
+	ok, err := mutation.DeleteComment(aliceCtx, comment.ID, &editedComment.Version)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	archived, err := mutation.ArchivePost(aliceCtx, post.ID, &updated.Version)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), archived.Version)
+}
+
+func TestHiddenCommentsVisibleToAdmins(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := context.Background()
+	mutation := &mutationResolver{resolver}
+	query := &queryResolver{resolver}
+
+	post, err := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	assert.NoError(t, err)
+
+	visible, err := mutation.CreateComment(ctx, post.ID, "Visible", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.CommentStatusVisible, visible.Status)
+
+	spamID, err := resolver.Storage.Comment.ImportComment(ctx, models.Comment{
+		PostID:    mustParseID(t, post.ID),
+		Content:   "Spam",
+		Status:    constants.CommentSpam,
+		CreatedAt: time.Now(),
+	})
+	assert.NoError(t, err)
+
+	comments, err := query.Comments(ctx, post.ID, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 1)
+	assert.Equal(t, visible.ID, comments[0].ID)
+
+	_, err = query.Comment(ctx, strconv.FormatInt(spamID, 10))
+	assert.Error(t, err)
+
+	adminCtx := auth.WithUser(ctx, "admin")
+
+	comments, err = query.Comments(adminCtx, post.ID, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 2)
+
+	spam, err := query.Comment(adminCtx, strconv.FormatInt(spamID, 10))
+	assert.NoError(t, err)
+	assert.Equal(t, generated.CommentStatusSpam, spam.Status)
+}
+
+func TestDeletePostRacingWithReplies(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := auth.WithUser(context.Background(), "alice")
+	mutation := &mutationResolver{resolver}
+
+	post, err := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	assert.NoError(t, err)
+
+	root, err := mutation.CreateComment(ctx, post.ID, "Root", nil, nil)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := mutation.CreateComment(ctx, post.ID, "Reply", &root.ID, nil)
+			errs <- err
+		}()
+	}
+
+	deleted, err := mutation.DeletePost(ctx, post.ID, nil)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	wg.Wait()
+	close(errs)
+
+	// A reply that lost the race finds the post gone; anything else, such
+	// as a deadlock, is a bug.
+	for err := range errs {
+		if err != nil {
+			assert.EqualError(t, err, "failed to fetch post")
+		}
+	}
+
+	// Replies either landed before the delete and went with it, or were
+	// refused; none may outlive the post.
+	comments, err := resolver.Storage.Comment.GetCommentsByPostID(ctx, mustParseID(t, post.ID), nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func mustParseID(t *testing.T, id string) int64 {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	assert.NoError(t, err)
+
+	return intID
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
 type testWriter struct{}
 
 func (tw *testWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
+
+func TestThread(t *testing.T) {
+	resolver := setupResolver(t)
+	ctx := context.Background()
+	mutation := &mutationResolver{resolver}
+	query := &queryResolver{resolver}
+
+	post, err := mutation.CreatePost(ctx, "Post", "Content", false, nil, nil)
+	assert.NoError(t, err)
+
+	root, err := mutation.CreateComment(ctx, post.ID, "Root", nil, nil)
+	assert.NoError(t, err)
+	reply, err := mutation.CreateComment(ctx, post.ID, "Reply", &root.ID, nil)
+	assert.NoError(t, err)
+	nested, err := mutation.CreateComment(ctx, post.ID, "Nested", &reply.ID, nil)
+	assert.NoError(t, err)
+
+	rootID := mustParseID(t, root.ID)
+	spamID, err := resolver.Storage.Comment.ImportComment(ctx, models.Comment{
+		PostID:    mustParseID(t, post.ID),
+		ParentID:  &rootID,
+		Content:   "Spam",
+		Status:    constants.CommentSpam,
+		CreatedAt: time.Now(),
+	})
+	assert.NoError(t, err)
+
+	spam := strconv.FormatInt(spamID, 10)
+	_, err = mutation.CreateComment(ctx, post.ID, "Under spam", &spam, nil)
+	assert.NoError(t, err)
+
+	// Hidden comments are left out with their replies.
+	thread, err := query.Thread(ctx, post.ID, nil, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, thread, 1) && assert.Len(t, thread[0].Replies, 1) {
+		assert.Equal(t, reply.ID, thread[0].Replies[0].ID)
+		if assert.Len(t, thread[0].Replies[0].Replies, 1) {
+			assert.Equal(t, nested.ID, thread[0].Replies[0].Replies[0].ID)
+		}
+	}
+
+	thread, err = query.Thread(auth.WithUser(ctx, "admin"), post.ID, nil, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, thread, 1) && assert.Len(t, thread[0].Replies, 2) {
+		assert.Len(t, thread[0].Replies[1].Replies, 1)
+	}
+
+	maxDepth := int32(1)
+	thread, err = query.Thread(ctx, post.ID, nil, &maxDepth)
+	assert.NoError(t, err)
+	if assert.Len(t, thread, 1) && assert.Len(t, thread[0].Replies, 1) {
+		assert.Empty(t, thread[0].Replies[0].Replies)
+	}
+
+	thread, err = query.Thread(ctx, post.ID, &reply.ID, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, thread, 1) {
+		assert.Equal(t, reply.ID, thread[0].ID)
+		assert.Len(t, thread[0].Replies, 1)
+	}
+
+	missing := "42"
+	_, err = query.Thread(ctx, post.ID, &missing, nil)
+	assert.Error(t, err)
+
+	maxDepth = -1
+	_, err = query.Thread(ctx, post.ID, nil, &maxDepth)
+	assert.Error(t, err)
+
+	// The limit cuts off the deepest replies first.
+	resolver.Threads.MaxThreadComments = 2
+	thread, err = query.Thread(ctx, post.ID, nil, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, thread, 1) && assert.Len(t, thread[0].Replies, 1) {
+		assert.Equal(t, reply.ID, thread[0].Replies[0].ID)
+		assert.Empty(t, thread[0].Replies[0].Replies)
+	}
+}
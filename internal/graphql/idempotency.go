@@ -0,0 +1,125 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyReservation is an idempotency key held by a create mutation
+// that is being executed. A nil reservation is valid and does nothing, so
+// mutations called without a key need no special casing.
+type idempotencyReservation struct {
+	r         *Resolver
+	scope     string
+	key       string
+	completed bool
+}
+
+// reserveIdempotencyKey reserves key for the calling client. Keys are scoped
+// per authenticated user, so anonymous callers can not send one. When the
+// key was already used for the same operation and arguments, the ID of the
+// resource created back then is returned and the mutation must return that
+// resource instead of creating a new one.
+func (r *Resolver) reserveIdempotencyKey(ctx context.Context, key *string, operation string, args ...any) (*idempotencyReservation, int64, error) {
+	if key == nil {
+		return nil, 0, nil
+	}
+
+	if *key == "" || len(*key) > maxIdempotencyKeyLength {
+		return nil, 0, fmt.Errorf("idempotency key must be between 1 and %d characters", maxIdempotencyKeyLength)
+	}
+
+	user, ok := auth.UserFromContext(ctx)
+
+	if !ok {
+		return nil, 0, fmt.Errorf("idempotency keys require an authenticated user")
+	}
+
+	scope := idempotencyScope(user)
+
+	payload, err := json.Marshal(append([]any{operation}, args...))
+	if err != nil {
+		r.logger(ctx).Error("failed to hash request", slog.String("err", err.Error()))
+		return nil, 0, fmt.Errorf("internal error")
+	}
+
+	hash := sha256.Sum256(payload)
+	requestHash := hex.EncodeToString(hash[:])
+
+	// The key is held only briefly until the request completes it, so that
+	// a crash in between does not block retries for the whole TTL.
+	record, created, err := r.Storage.Idempotency.ReserveKey(ctx, scope, *key, requestHash, time.Now().Add(r.Idempotency.InFlightTTL))
+
+	if err != nil {
+		r.logger(ctx).Error("failed to reserve idempotency key", slog.String("err", err.Error()))
+		return nil, 0, fmt.Errorf("failed to reserve idempotency key")
+	}
+
+	if created {
+		return &idempotencyReservation{r: r, scope: scope, key: *key}, 0, nil
+	}
+
+	if record.RequestHash != requestHash {
+		return nil, 0, conflictError("idempotency key was already used for a different request", nil)
+	}
+
+	if record.ResourceID == 0 {
+		return nil, 0, conflictError("a request with this idempotency key is still in progress", nil)
+	}
+
+	r.logger(ctx).Info("replaying idempotent request", slog.String("operation", operation), slog.Int64("id", record.ResourceID))
+
+	return nil, record.ResourceID, nil
+}
+
+// idempotencyScope returns the scope of user's keys. The user name is
+// unbounded, its hash fits the scope column.
+func idempotencyScope(user string) string {
+	hash := sha256.Sum256([]byte(user))
+	return hex.EncodeToString(hash[:])
+}
+
+// complete records the resource created under the key in tx, the
+// transaction that created the resource, so that both commit or neither
+// does, and keeps the key for the TTL. Call commit once tx has committed.
+func (ir *idempotencyReservation) complete(ctx context.Context, tx storage.Storage, resourceID int64) error {
+	if ir == nil {
+		return nil
+	}
+
+	if err := tx.Idempotency.CompleteKey(ctx, ir.scope, ir.key, resourceID, time.Now().Add(ir.r.Idempotency.TTL)); err != nil {
+		ir.r.logger(ctx).Error("failed to complete idempotency key", slog.String("err", err.Error()))
+		return fmt.Errorf("failed to complete idempotency key")
+	}
+
+	return nil
+}
+
+// commit keeps the completed key, so retries replay the resource.
+func (ir *idempotencyReservation) commit() {
+	if ir != nil {
+		ir.completed = true
+	}
+}
+
+// release frees a key whose mutation failed, so the client can retry it.
+// It does nothing once the key is committed.
+func (ir *idempotencyReservation) release(ctx context.Context) {
+	if ir == nil || ir.completed {
+		return
+	}
+
+	if err := ir.r.Storage.Idempotency.ReleaseKey(context.WithoutCancel(ctx), ir.scope, ir.key); err != nil {
+		ir.r.logger(ctx).Error("failed to release idempotency key", slog.String("err", err.Error()))
+	}
+}
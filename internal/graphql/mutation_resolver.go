@@ -2,34 +2,91 @@ package graphql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
 	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/constants"
 	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
 )
 
 type mutationResolver struct{ *Resolver }
 
 // CreatePost is the resolver for the createPost field.
-func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, commentsDisabled bool) (*generated.Post, error) {
-	id, err := r.Storage.Post.CreatePost(ctx, title, content, commentsDisabled)
+func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, commentsDisabled bool, status *generated.PostStatus, idempotencyKey *string) (*generated.Post, error) {
+	reservation, replayID, err := r.reserveIdempotencyKey(ctx, idempotencyKey, "createPost", title, content, commentsDisabled, status)
 
 	if err != nil {
-		r.Logger.Error("failed to create post", slog.String("err", err.Error()))
-		return nil, fmt.Errorf("failed to create post")
+		return nil, err
 	}
 
-	r.Logger.Info("post created successfully", slog.Int64("id", id))
+	if replayID != 0 {
+		post, err := r.Storage.Post.GetPostByID(storage.WithPrimary(ctx), replayID)
 
-	post, err := r.Storage.Post.GetPostByID(ctx, id)
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch replayed post", slog.String("err", err.Error()))
+			return nil, fmt.Errorf("failed to fetch post")
+		}
+
+		return toGQLPost(post, make([]*generated.Comment, 0), nil), nil
+	}
+
+	defer reservation.release(ctx)
+
+	postStatus := constants.PostPublished
+
+	if status != nil {
+		if *status != generated.PostStatusDraft && *status != generated.PostStatusPublished {
+			return nil, fmt.Errorf("new posts can only be drafts or published, use schedulePost to schedule")
+		}
+		postStatus = status.String()
+	}
+
+	author, _ := auth.UserFromContext(ctx)
+
+	if postStatus == constants.PostDraft && author == "" {
+		return nil, fmt.Errorf("drafts require an authenticated author")
+	}
+
+	var post models.Post
+
+	// The webhook event is committed with the post, or not at all.
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		id, err := tx.Post.CreatePost(ctx, title, content, author, postStatus, commentsDisabled)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to create post", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to create post")
+		}
+
+		post, err = tx.Post.GetPostByID(ctx, id)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch created post", slog.String("err", err.Error()))
+			return fmt.Errorf("internal error")
+		}
+
+		if err := r.emit(ctx, tx, constants.EventPostCreated, post); err != nil {
+			return err
+		}
+
+		return reservation.complete(ctx, tx, id)
+	})
 
 	if err != nil {
-		r.Logger.Error("failed to fetch created post", slog.String("err", err.Error()))
-		return nil, fmt.Errorf("internal error")
+		return nil, err
 	}
 
+	reservation.commit()
+
+	r.logger(ctx).Info("post created successfully", slog.Int64("id", post.ID))
+
 	// comments, err := r.Storage.Comment.GetCommentsByPostID(ctx, id)
 
 	gqlComments := make([]*generated.Comment, 0)
@@ -53,149 +110,696 @@ func (r *mutationResolver) CreatePost(ctx context.Context, title string, content
 	// 	})
 	// }
 
-	return &generated.Post{
-		ID:               strconv.FormatInt(post.ID, 10),
-		Title:            post.Title,
-		Content:          post.Content,
-		CommentsDisabled: post.CommentsDisabled,
-		CreatedAt:        post.CreatedAt.Format(time.RFC3339),
-		Comments:         gqlComments,
-	}, nil
+	return toGQLPost(post, gqlComments, nil), nil
 }
 
 // CreateComment is the resolver for the createComment field.
-func (r *mutationResolver) CreateComment(ctx context.Context, postID string, content string, parentID *string) (*generated.Comment, error) {
+func (r *mutationResolver) CreateComment(ctx context.Context, postID string, content string, parentID *string, idempotencyKey *string) (*generated.Comment, error) {
+	reservation, replayID, err := r.reserveIdempotencyKey(ctx, idempotencyKey, "createComment", postID, content, parentID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if replayID != 0 {
+		comment, err := r.Storage.Comment.GetCommentByID(storage.WithPrimary(ctx), replayID)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch replayed comment", slog.String("err", err.Error()))
+			return nil, fmt.Errorf("failed to fetch comment")
+		}
+
+		return toGQLComment(comment, nil), nil
+	}
+
+	defer reservation.release(ctx)
+
 	var pInt64ParentID *int64
 
 	if parentID != nil {
 		intParentID, err := strconv.Atoi(*parentID)
 
 		if err != nil {
-			r.Logger.Error("invalid parent id", slog.String("err", err.Error()), slog.String("id", *parentID))
+			r.logger(ctx).Error("invalid parent id", slog.String("err", err.Error()), slog.String("id", *parentID))
 			return nil, fmt.Errorf("invalid parent id ")
 		}
 
 		int64ParentID := int64(intParentID)
+		pInt64ParentID = &int64ParentID
+	}
+
+	intPostID, err := strconv.Atoi(postID)
+
+	if err != nil {
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()), slog.String("id", postID))
+		return nil, fmt.Errorf("invalid post id")
+	}
+
+	author, _ := auth.UserFromContext(ctx)
 
-		_, err = r.Storage.Comment.GetCommentByID(ctx, int64ParentID)
+	var (
+		parent  models.Comment
+		comment models.Comment
+	)
+
+	// The checks and the insert share a transaction, so the post can not be
+	// closed and the parent can not be locked or deleted in between. The post
+	// is read first, so this queues behind DeletePost in the same order.
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		post, err := tx.Post.GetPostByID(ctx, int64(intPostID))
 
 		if err != nil {
-			r.Logger.Error("failed to fetch parent comment", slog.String("err", err.Error()))
-			return nil, fmt.Errorf("failed to fetch parent comment")
+			r.logger(ctx).Error("failed to fetch post", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to fetch post")
 		}
 
-		pInt64ParentID = &int64ParentID
+		if pInt64ParentID != nil {
+			parent, err = tx.Comment.GetCommentByID(ctx, *pInt64ParentID)
+
+			if err != nil {
+				r.logger(ctx).Error("failed to fetch parent comment", slog.String("err", err.Error()))
+				return fmt.Errorf("failed to fetch parent comment")
+			}
+
+			if parent.PostID != post.ID {
+				r.logger(ctx).Error("parent comment belongs to another post", slog.Int64("parent post id", parent.PostID))
+				return fmt.Errorf("parent comment belongs to another post")
+			}
+		}
+
+		if post.Status != constants.PostPublished {
+			r.logger(ctx).Error("post is not published", slog.String("status", post.Status))
+			return fmt.Errorf("post is not published")
+		}
+
+		if post.CommentsDisabled {
+			r.logger(ctx).Error("comments disabled on this post")
+			return fmt.Errorf("comments disabled on this post")
+		}
+
+		if pInt64ParentID != nil {
+			lock, err := tx.Comment.FindActiveLock(ctx, *pInt64ParentID, time.Now())
+
+			if err == nil {
+				r.logger(ctx).Info("reply rejected by thread lock", slog.Int64("lock", lock.CommentID))
+				return fmt.Errorf("thread is locked: %s", lock.Reason)
+			}
+
+			if !errors.Is(err, storageErrors.ErrLockNotFound) {
+				r.logger(ctx).Error("failed to check thread lock", slog.String("err", err.Error()))
+				return fmt.Errorf("failed to check thread lock")
+			}
+		}
+
+		parentID := pInt64ParentID
+		var replyToID *int64
+
+		if parentID != nil && r.Threads.MaxDepth > 0 && parent.Depth >= r.Threads.MaxDepth {
+			if r.Threads.Overflow != constants.OverflowFlatten {
+				r.logger(ctx).Info("reply rejected by thread depth", slog.Int("max depth", r.Threads.MaxDepth))
+				return fmt.Errorf("maximum thread depth of %d reached", r.Threads.MaxDepth)
+			}
+
+			ancestor := parent
+
+			for ancestor.Depth >= r.Threads.MaxDepth && ancestor.ParentID != nil {
+				ancestor, err = tx.Comment.GetCommentByID(ctx, *ancestor.ParentID)
+
+				if err != nil {
+					r.logger(ctx).Error("failed to fetch ancestor comment", slog.String("err", err.Error()))
+					return fmt.Errorf("failed to fetch ancestor comment")
+				}
+			}
+
+			replyToID = parentID
+			parentID = &ancestor.ID
+		}
+
+		id, err := tx.Comment.CreateComment(ctx, content, author, int64(intPostID), parentID, replyToID)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to create comment", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to create comment")
+		}
+
+		comment, err = tx.Comment.GetCommentByID(ctx, id)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch created comment", slog.String("err", err.Error()))
+			return fmt.Errorf("internal error")
+		}
+
+		if err := r.emit(ctx, tx, constants.EventCommentCreated, comment); err != nil {
+			return err
+		}
+
+		return reservation.complete(ctx, tx, id)
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	intPostID, err := strconv.Atoi(postID)
+	reservation.commit()
+
+	r.logger(ctx).Info("comment created successfully", slog.Int64("id", comment.ID))
+
+	r.notifyCommentCreated(ctx, comment, parent.Author)
+
+	return toGQLComment(comment, nil), nil
+}
+
+// UpdatePost is the resolver for the updatePost field.
+func (r *mutationResolver) UpdatePost(ctx context.Context, id string, title string, content string, expectedVersion *int32) (*generated.Post, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
 
 	if err != nil {
-		r.Logger.Error("invalid post id", slog.String("err", err.Error()), slog.String("id", postID))
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()), slog.String("id", id))
 		return nil, fmt.Errorf("invalid post id")
 	}
 
-	post, err := r.Storage.Post.GetPostByID(ctx, int64(intPostID))
+	post, err := r.Storage.Post.GetPostByID(storage.WithPrimary(ctx), intID)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch post", slog.String("err", err.Error()))
+		r.logger(ctx).Error("failed to fetch post", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("failed to fetch post")
 	}
 
-	if post.CommentsDisabled {
-		r.Logger.Error("comments disabled on this post")
-		return nil, fmt.Errorf("comments disabled on this post")
+	if !r.canManagePost(ctx, post) {
+		return nil, fmt.Errorf("forbidden")
 	}
 
-	id, err := r.Storage.Comment.CreateComment(ctx, content, int64(intPostID), pInt64ParentID)
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		err := tx.Post.UpdatePost(ctx, intID, title, content, optionalVersion(expectedVersion))
+
+		if errors.Is(err, storageErrors.ErrVersionConflict) {
+			return err
+		}
+
+		if err != nil {
+			r.logger(ctx).Error("failed to update post", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to update post")
+		}
+
+		post, err = tx.Post.GetPostByID(ctx, intID)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch updated post", slog.String("err", err.Error()))
+			return fmt.Errorf("internal error")
+		}
+
+		return r.emit(ctx, tx, constants.EventPostUpdated, post)
+	})
+
+	if errors.Is(err, storageErrors.ErrVersionConflict) {
+		return nil, r.postVersionConflict(ctx, intID)
+	}
 
 	if err != nil {
-		r.Logger.Error("failed to create comment")
-		return nil, fmt.Errorf("failed to create comment")
+		return nil, err
 	}
 
-	r.Logger.Info("comment created successfully", slog.Int64("id", id))
+	r.logger(ctx).Info("post updated successfully", slog.Int64("id", intID))
 
-	comment, err := r.Storage.Comment.GetCommentByID(ctx, id)
+	return (&queryResolver{r.Resolver}).Post(ctx, id)
+}
+
+// UpdateComment is the resolver for the updateComment field.
+func (r *mutationResolver) UpdateComment(ctx context.Context, id string, content string, expectedVersion *int32) (*generated.Comment, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch created comment", slog.String("err", err.Error()))
-		return nil, fmt.Errorf("internal error")
+		r.logger(ctx).Error("invalid comment id", slog.String("err", err.Error()), slog.String("id", id))
+		return nil, fmt.Errorf("invalid comment id")
 	}
 
-	var parentIDCopy *string
-	if comment.ParentID != nil {
-		s := strconv.FormatInt(*comment.ParentID, 10)
-		parentIDCopy = &s
+	comment, err := r.Storage.Comment.GetCommentByID(storage.WithPrimary(ctx), intID)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch comment", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to fetch comment")
 	}
 
-	return &generated.Comment{
-		ID:        strconv.FormatInt(comment.ID, 10),
-		PostID:    strconv.FormatInt(comment.PostID, 10),
-		ParentID:  parentIDCopy,
-		Content:   comment.Content,
-		CreatedAt: comment.CreatedAt.Format(time.RFC3339),
-	}, nil
+	if !r.canManageComment(ctx, comment) {
+		return nil, fmt.Errorf("forbidden")
+	}
+
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		err := tx.Comment.UpdateComment(ctx, intID, content, optionalVersion(expectedVersion))
+
+		if errors.Is(err, storageErrors.ErrVersionConflict) {
+			return err
+		}
+
+		if err != nil {
+			r.logger(ctx).Error("failed to update comment", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to update comment")
+		}
+
+		comment, err = tx.Comment.GetCommentByID(ctx, intID)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch updated comment", slog.String("err", err.Error()))
+			return fmt.Errorf("internal error")
+		}
+
+		return r.emit(ctx, tx, constants.EventCommentUpdated, comment)
+	})
+
+	if errors.Is(err, storageErrors.ErrVersionConflict) {
+		return nil, r.commentVersionConflict(ctx, intID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger(ctx).Info("comment updated successfully", slog.Int64("id", intID))
+
+	return (&queryResolver{r.Resolver}).Comment(ctx, id)
 }
 
 // DeletePost is the resolver for the deletePost field.
-func (r *mutationResolver) DeletePost(ctx context.Context, id string) (bool, error) {
+func (r *mutationResolver) DeletePost(ctx context.Context, id string, expectedVersion *int32) (bool, error) {
 	intID, err := strconv.Atoi(id)
 
 	if err != nil {
-		r.Logger.Error("invalid post id", slog.String("err", err.Error()))
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()))
 		return false, fmt.Errorf("invalid post id")
 	}
 
-	_, err = r.Storage.Post.GetPostByID(ctx, int64(intID))
+	var post models.Post
+
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		post, err = tx.Post.GetPostByID(ctx, int64(intID))
+
+		if err != nil {
+			r.logger(ctx).Error("post not found", slog.String("err", err.Error()), slog.Int("id", intID))
+			return fmt.Errorf("post not found")
+		}
+
+		if !r.canManagePost(ctx, post) {
+			return fmt.Errorf("forbidden")
+		}
+
+		// Checked before the comments go, although the rollback would
+		// restore them anyway.
+		if expectedVersion != nil && int64(*expectedVersion) != post.Version {
+			return storageErrors.ErrVersionConflict
+		}
+
+		if err := tx.Comment.DeleteCommentsByPostID(ctx, int64(intID)); err != nil {
+			r.logger(ctx).Error("failed to delete comments from post", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to delete comments from post")
+		}
+
+		err = tx.Post.DeletePost(ctx, int64(intID), optionalVersion(expectedVersion))
+
+		if errors.Is(err, storageErrors.ErrVersionConflict) {
+			return err
+		}
+
+		if err != nil {
+			r.logger(ctx).Error("failed to delete post", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to delete post")
+		}
+
+		return r.emit(ctx, tx, constants.EventPostDeleted, post)
+	})
+
+	if errors.Is(err, storageErrors.ErrVersionConflict) {
+		return false, r.postVersionConflict(ctx, int64(intID))
+	}
 
 	if err != nil {
-		r.Logger.Error("post not found", slog.String("err", err.Error()), slog.Int("id", intID))
-		return false, fmt.Errorf("post not found")
+		return false, err
 	}
 
-	err = r.Storage.Comment.DeleteCommentsByPostID(ctx, int64(intID))
+	r.logger(ctx).Info("post deleted successfully")
+
+	return true, nil
+}
+
+// DeleteComment is the resolver for the deleteComment field.
+func (r *mutationResolver) DeleteComment(ctx context.Context, id string, expectedVersion *int32) (bool, error) {
+	intID, err := strconv.Atoi(id)
 
 	if err != nil {
-		r.Logger.Error("failed to delete comments from post", slog.String("err", err.Error()))
-		return false, fmt.Errorf("failed to delete comments from post")
+		r.logger(ctx).Error("invalid comment ID", slog.String("err", err.Error()))
+		return false, fmt.Errorf("invalid comment ID")
 	}
 
-	err = r.Storage.Post.DeletePost(ctx, int64(intID))
+	var comment models.Comment
+
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		comment, err = tx.Comment.GetCommentByID(ctx, int64(intID))
+
+		if err != nil {
+			r.logger(ctx).Error("comment not found", slog.String("err", err.Error()))
+			return fmt.Errorf("comment not found")
+		}
+
+		if !r.canManageComment(ctx, comment) {
+			return fmt.Errorf("forbidden")
+		}
+
+		err := tx.Comment.DeleteComment(ctx, int64(intID), optionalVersion(expectedVersion))
+
+		if errors.Is(err, storageErrors.ErrVersionConflict) {
+			return err
+		}
+
+		if err != nil {
+			r.logger(ctx).Error("failed to delete comment", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to delete comment")
+		}
+
+		return r.emit(ctx, tx, constants.EventCommentDeleted, comment)
+	})
+
+	if errors.Is(err, storageErrors.ErrVersionConflict) {
+		return false, r.commentVersionConflict(ctx, int64(intID))
+	}
 
 	if err != nil {
-		r.Logger.Error("failed to delete post", slog.String("err", err.Error()))
-		return false, fmt.Errorf("failed to delete post")
+		return false, err
 	}
 
-	r.Logger.Info("post deleted successfully")
+	r.logger(ctx).Info("comment deleted successfully")
 
 	return true, nil
 }
 
-// DeleteComment is the resolver for the deleteComment field.
-func (r *mutationResolver) DeleteComment(ctx context.Context, id string) (bool, error) {
-	intID, err := strconv.Atoi(id)
+// MarkNotificationsRead is the resolver for the markNotificationsRead field.
+func (r *mutationResolver) MarkNotificationsRead(ctx context.Context, ids []string) (int32, error) {
+	user, ok := auth.UserFromContext(ctx)
+
+	if !ok {
+		return 0, fmt.Errorf("unauthenticated")
+	}
+
+	var int64IDs []int64
+
+	if ids != nil {
+		int64IDs = make([]int64, 0, len(ids))
+
+		for _, id := range ids {
+			intID, err := strconv.ParseInt(id, 10, 64)
+
+			if err != nil {
+				r.logger(ctx).Error("invalid notification id", slog.String("err", err.Error()), slog.String("id", id))
+				return 0, fmt.Errorf("invalid notification id")
+			}
+
+			int64IDs = append(int64IDs, intID)
+		}
+	}
+
+	marked, err := r.Storage.Notification.MarkNotificationsRead(ctx, user, int64IDs)
 
 	if err != nil {
-		r.Logger.Error("invalid comment ID", slog.String("err", err.Error()))
-		return false, fmt.Errorf("invalid comment ID")
+		r.logger(ctx).Error("failed to mark notifications read", slog.String("err", err.Error()))
+		return 0, fmt.Errorf("failed to mark notifications read")
+	}
+
+	return int32(marked), nil
+}
+
+// SetCommentsDisabled is the resolver for the setCommentsDisabled field.
+func (r *mutationResolver) SetCommentsDisabled(ctx context.Context, postID string, disabled bool, expectedVersion *int32) (*generated.Post, error) {
+	if !auth.IsAdmin(ctx, r.Admins) {
+		return nil, fmt.Errorf("forbidden")
 	}
 
-	_, err = r.Storage.Comment.GetCommentByID(ctx, int64(intID))
+	intPostID, err := strconv.ParseInt(postID, 10, 64)
 
 	if err != nil {
-		r.Logger.Error("comment not found", slog.String("err", err.Error()))
-		return false, fmt.Errorf("comment not found")
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()), slog.String("id", postID))
+		return nil, fmt.Errorf("invalid post id")
 	}
 
-	err = r.Storage.Comment.DeleteComment(ctx, int64(intID))
+	err = r.Storage.Post.SetCommentsDisabled(ctx, intPostID, disabled, optionalVersion(expectedVersion))
+
+	if errors.Is(err, storageErrors.ErrVersionConflict) {
+		return nil, r.postVersionConflict(ctx, intPostID)
+	}
 
 	if err != nil {
-		r.Logger.Error("failed to delete comment", slog.String("err", err.Error()))
-		return false, fmt.Errorf("failed to delete comment")
+		r.logger(ctx).Error("failed to set comments disabled", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to set comments disabled")
 	}
 
-	r.Logger.Info("comment deleted successfully")
+	r.logger(ctx).Info("post comments toggled", slog.Int64("id", intPostID), slog.Bool("disabled", disabled))
+
+	return (&queryResolver{r.Resolver}).Post(ctx, postID)
+}
+
+// LockComment is the resolver for the lockComment field.
+func (r *mutationResolver) LockComment(ctx context.Context, id string, reason string, expiresAt *string) (*generated.CommentLock, error) {
+	if !auth.IsAdmin(ctx, r.Admins) {
+		return nil, fmt.Errorf("forbidden")
+	}
+
+	intID, err := strconv.ParseInt(id, 10, 64)
+
+	if err != nil {
+		r.logger(ctx).Error("invalid comment id", slog.String("err", err.Error()), slog.String("id", id))
+		return nil, fmt.Errorf("invalid comment id")
+	}
+
+	var expiresAtTime *time.Time
+
+	if expiresAt != nil {
+		parsed, err := time.Parse(time.RFC3339, *expiresAt)
+
+		if err != nil {
+			r.logger(ctx).Error("invalid lock expiry", slog.String("err", err.Error()))
+			return nil, fmt.Errorf("invalid expiresAt, expected RFC3339")
+		}
+
+		if !parsed.After(time.Now()) {
+			return nil, fmt.Errorf("expiresAt must be in the future")
+		}
+
+		expiresAtTime = &parsed
+	}
+
+	lockedBy, _ := auth.UserFromContext(ctx)
+
+	var lock models.CommentLock
+
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		if err := tx.Comment.LockComment(ctx, intID, reason, lockedBy, expiresAtTime); err != nil {
+			r.logger(ctx).Error("failed to lock comment", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to lock comment")
+		}
+
+		lock, err = tx.Comment.FindActiveLock(ctx, intID, time.Now())
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch created lock", slog.String("err", err.Error()))
+			return fmt.Errorf("internal error")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger(ctx).Info("comment locked successfully", slog.Int64("id", intID))
+
+	var expiresAtCopy *string
+	if lock.ExpiresAt != nil {
+		s := lock.ExpiresAt.Format(time.RFC3339)
+		expiresAtCopy = &s
+	}
+
+	return &generated.CommentLock{
+		CommentID: strconv.FormatInt(lock.CommentID, 10),
+		Reason:    lock.Reason,
+		LockedBy:  optionalString(lock.LockedBy),
+		CreatedAt: lock.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: expiresAtCopy,
+	}, nil
+}
+
+// UnlockComment is the resolver for the unlockComment field.
+func (r *mutationResolver) UnlockComment(ctx context.Context, id string) (bool, error) {
+	if !auth.IsAdmin(ctx, r.Admins) {
+		return false, fmt.Errorf("forbidden")
+	}
+
+	intID, err := strconv.ParseInt(id, 10, 64)
+
+	if err != nil {
+		r.logger(ctx).Error("invalid comment id", slog.String("err", err.Error()), slog.String("id", id))
+		return false, fmt.Errorf("invalid comment id")
+	}
+
+	err = r.Storage.Comment.UnlockComment(ctx, intID)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to unlock comment", slog.String("err", err.Error()))
+		return false, fmt.Errorf("failed to unlock comment")
+	}
+
+	r.logger(ctx).Info("comment unlocked successfully", slog.Int64("id", intID))
 
 	return true, nil
 }
+
+// PinComment is the resolver for the pinComment field.
+func (r *mutationResolver) PinComment(ctx context.Context, postID string, commentID string) (*generated.Post, error) {
+	intPostID, intCommentID, err := r.authorizePin(ctx, postID, commentID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Storage.Comment.PinComment(ctx, intPostID, intCommentID, r.Threads.MaxPins)
+
+	if errors.Is(err, storageErrors.ErrPinLimitReached) {
+		return nil, fmt.Errorf("at most %d comments can be pinned", r.Threads.MaxPins)
+	}
+
+	if err != nil {
+		r.logger(ctx).Error("failed to pin comment", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to pin comment")
+	}
+
+	r.logger(ctx).Info("comment pinned successfully", slog.Int64("id", intCommentID))
+
+	return (&queryResolver{r.Resolver}).Post(ctx, postID)
+}
+
+// UnpinComment is the resolver for the unpinComment field.
+func (r *mutationResolver) UnpinComment(ctx context.Context, postID string, commentID string) (*generated.Post, error) {
+	intPostID, intCommentID, err := r.authorizePin(ctx, postID, commentID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Storage.Comment.UnpinComment(ctx, intPostID, intCommentID)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to unpin comment", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to unpin comment")
+	}
+
+	r.logger(ctx).Info("comment unpinned successfully", slog.Int64("id", intCommentID))
+
+	return (&queryResolver{r.Resolver}).Post(ctx, postID)
+}
+
+// authorizePin parses the pin arguments and checks that the caller is a
+// moderator or the author of the post.
+func (r *mutationResolver) authorizePin(ctx context.Context, postID string, commentID string) (int64, int64, error) {
+	intPostID, err := strconv.ParseInt(postID, 10, 64)
+
+	if err != nil {
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()), slog.String("id", postID))
+		return 0, 0, fmt.Errorf("invalid post id")
+	}
+
+	intCommentID, err := strconv.ParseInt(commentID, 10, 64)
+
+	if err != nil {
+		r.logger(ctx).Error("invalid comment id", slog.String("err", err.Error()), slog.String("id", commentID))
+		return 0, 0, fmt.Errorf("invalid comment id")
+	}
+
+	post, err := r.Storage.Post.GetPostByID(storage.WithPrimary(ctx), intPostID)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch post", slog.String("err", err.Error()))
+		return 0, 0, fmt.Errorf("failed to fetch post")
+	}
+
+	if !r.canManagePost(ctx, post) {
+		return 0, 0, fmt.Errorf("forbidden")
+	}
+
+	return intPostID, intCommentID, nil
+}
+
+// PublishPost is the resolver for the publishPost field.
+func (r *mutationResolver) PublishPost(ctx context.Context, id string, expectedVersion *int32) (*generated.Post, error) {
+	now := time.Now()
+	return r.setPostStatus(ctx, id, constants.PostPublished, &now, expectedVersion)
+}
+
+// SchedulePost is the resolver for the schedulePost field.
+func (r *mutationResolver) SchedulePost(ctx context.Context, id string, publishAt string, expectedVersion *int32) (*generated.Post, error) {
+	publishAtTime, err := time.Parse(time.RFC3339, publishAt)
+
+	if err != nil {
+		r.logger(ctx).Error("invalid publish time", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("invalid publishAt, expected RFC3339")
+	}
+
+	if !publishAtTime.After(time.Now()) {
+		return nil, fmt.Errorf("publishAt must be in the future")
+	}
+
+	return r.setPostStatus(ctx, id, constants.PostScheduled, &publishAtTime, expectedVersion)
+}
+
+// ArchivePost is the resolver for the archivePost field.
+func (r *mutationResolver) ArchivePost(ctx context.Context, id string, expectedVersion *int32) (*generated.Post, error) {
+	return r.setPostStatus(ctx, id, constants.PostArchived, nil, expectedVersion)
+}
+
+func (r *mutationResolver) setPostStatus(ctx context.Context, id string, status string, publishAt *time.Time, expectedVersion *int32) (*generated.Post, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+
+	if err != nil {
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()), slog.String("id", id))
+		return nil, fmt.Errorf("invalid post id")
+	}
+
+	// An archive racing with a publish must not be undone by it.
+	err = r.Storage.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		post, err := tx.Post.GetPostByID(ctx, intID)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch post", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to fetch post")
+		}
+
+		if !r.canManagePost(ctx, post) {
+			return fmt.Errorf("forbidden")
+		}
+
+		if post.Status == constants.PostArchived && status != constants.PostArchived {
+			return fmt.Errorf("archived posts can not be republished")
+		}
+
+		err = tx.Post.SetPostStatus(ctx, intID, status, publishAt, optionalVersion(expectedVersion))
+
+		if errors.Is(err, storageErrors.ErrVersionConflict) {
+			return err
+		}
+
+		if err != nil {
+			r.logger(ctx).Error("failed to update post status", slog.String("err", err.Error()))
+			return fmt.Errorf("failed to update post status")
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, storageErrors.ErrVersionConflict) {
+		return nil, r.postVersionConflict(ctx, intID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger(ctx).Info("post status updated", slog.Int64("id", intID), slog.String("status", status))
+
+	return (&queryResolver{r.Resolver}).Post(ctx, id)
+}
@@ -0,0 +1,62 @@
+package graphql
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/notification"
+)
+
+// notifyCommentCreated notifies the author of the parent comment about a reply
+// and every user mentioned in the comment. Failures are logged and never fail
+// the comment creation itself.
+func (r *Resolver) notifyCommentCreated(ctx context.Context, comment models.Comment, parentAuthor string) {
+	notified := map[string]struct{}{comment.Author: {}, "": {}}
+
+	notify := func(recipient, notificationType string) {
+		if _, ok := notified[recipient]; ok {
+			return
+		}
+		notified[recipient] = struct{}{}
+
+		id, err := r.Storage.Notification.CreateNotification(ctx, recipient, notificationType, comment.PostID, comment.ID)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to create notification", slog.String("err", err.Error()), slog.String("recipient", recipient))
+			return
+		}
+
+		created, err := r.Storage.Notification.GetNotificationByID(ctx, id)
+
+		if err != nil {
+			r.logger(ctx).Error("failed to fetch created notification", slog.String("err", err.Error()))
+			return
+		}
+
+		if r.Broker != nil {
+			r.Broker.Publish(created)
+		}
+	}
+
+	notify(parentAuthor, constants.NotificationReply)
+
+	for _, mention := range notification.ParseMentions(comment.Content) {
+		notify(mention, constants.NotificationMention)
+	}
+}
+
+func toGQLNotification(notification models.Notification) *generated.Notification {
+	return &generated.Notification{
+		ID:        strconv.FormatInt(notification.ID, 10),
+		Type:      generated.NotificationType(notification.Type),
+		PostID:    strconv.FormatInt(notification.PostID, 10),
+		CommentID: strconv.FormatInt(notification.CommentID, 10),
+		Read:      notification.ReadAt != nil,
+		CreatedAt: notification.CreatedAt.Format(time.RFC3339),
+	}
+}
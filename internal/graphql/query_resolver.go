@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
-	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/auth"
 	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
 )
 
@@ -17,77 +17,70 @@ func (r *queryResolver) Post(ctx context.Context, id string) (*generated.Post, e
 	intID, err := strconv.ParseInt(id, 10, 64)
 
 	if err != nil {
-		r.Logger.Error("invalid post id", slog.String("err", err.Error()))
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("invalid post id")
 	}
 
 	post, err := r.Storage.Post.GetPostByID(ctx, intID)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch post", slog.String("err", err.Error()))
+		r.logger(ctx).Error("failed to fetch post", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to fetch post")
+	}
+
+	if !r.canViewPost(ctx, post) {
+		r.logger(ctx).Info("post is not visible to caller", slog.Int64("id", intID))
 		return nil, fmt.Errorf("failed to fetch post")
 	}
 
 	comments, err := r.Storage.Comment.GetCommentsByPostID(ctx, intID, nil, nil)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch comments", slog.String("err", err.Error()))
+		r.logger(ctx).Error("failed to fetch comments", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("failed to fetch comments")
 	}
 
 	gqlComments := make([]*generated.Comment, 0, len(comments))
 
 	for _, comment := range comments {
+		if !r.canViewComment(ctx, comment) {
+			continue
+		}
+
 		childComments, err := r.Storage.Comment.GetCommentsByParentID(ctx, comment.ID)
 
 		if err != nil {
-			r.Logger.Error("failed to fetch child comments", slog.String("err", err.Error()))
+			r.logger(ctx).Error("failed to fetch child comments", slog.String("err", err.Error()))
 			return nil, fmt.Errorf("failed to fetch child comments")
 		}
 
 		gqlReplies := make([]*generated.Comment, 0, len(childComments))
 
 		for _, child := range childComments {
-			var childParentIDCopy *string
-			if child.ParentID != nil {
-				s := strconv.FormatInt(*child.ParentID, 10)
-				childParentIDCopy = &s
+			if r.canViewComment(ctx, child) {
+				gqlReplies = append(gqlReplies, toGQLComment(child, nil))
 			}
-
-			gqlReplies = append(gqlReplies, &generated.Comment{
-				ID:        strconv.FormatInt(child.ID, 10),
-				PostID:    strconv.FormatInt(child.PostID, 10),
-				ParentID:  childParentIDCopy,
-				Content:   child.Content,
-				CreatedAt: child.CreatedAt.Format(time.RFC3339),
-				Replies:   nil,
-			})
 		}
 
-		var parentIDCopy *string
-		if comment.ParentID != nil {
-			s := strconv.FormatInt(*comment.ParentID, 10)
-			parentIDCopy = &s
+		gqlComments = append(gqlComments, toGQLComment(comment, gqlReplies))
+	}
+
+	pinnedComments, err := r.Storage.Comment.GetPinnedComments(ctx, intID)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch pinned comments", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to fetch pinned comments")
+	}
+
+	gqlPinnedComments := make([]*generated.Comment, 0, len(pinnedComments))
+
+	for _, comment := range pinnedComments {
+		if r.canViewComment(ctx, comment) {
+			gqlPinnedComments = append(gqlPinnedComments, toGQLComment(comment, nil))
 		}
+	}
 
-		gqlComments = append(gqlComments, &generated.Comment{
-			ID:        strconv.FormatInt(comment.ID, 10),
-			PostID:    strconv.FormatInt(comment.PostID, 10),
-			ParentID:  parentIDCopy,
-			Content:   comment.Content,
-			CreatedAt: comment.CreatedAt.Format(time.RFC3339),
-			Replies:   gqlReplies,
-		})
-	}
-
-	return &generated.Post{
-		ID:               strconv.FormatInt(post.ID, 10),
-		Title:            post.Title,
-		Content:          post.Content,
-		CommentsDisabled: post.CommentsDisabled,
-		CreatedAt:        post.CreatedAt.Format(time.RFC3339),
-		Comments:         gqlComments,
-	}, nil
+	return toGQLPost(post, gqlComments, gqlPinnedComments), nil
 }
 
 // Posts is the resolver for the posts field.
@@ -95,24 +88,21 @@ func (r *queryResolver) Posts(ctx context.Context, limit *int32, offset *int32)
 	posts, err := r.Storage.Post.GetAllPosts(ctx)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch posts", slog.String("err", err.Error()))
+		r.logger(ctx).Error("failed to fetch posts", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("failed to fetch posts")
 	}
 
 	gqlPosts := make([]*generated.Post, 0, len(posts))
 
 	for _, post := range posts {
-		gqlPosts = append(gqlPosts, &generated.Post{
-			ID:               strconv.FormatInt(post.ID, 10),
-			Title:            post.Title,
-			Content:          post.Content,
-			CommentsDisabled: post.CommentsDisabled,
-			CreatedAt:        post.CreatedAt.Format(time.RFC3339),
-			Comments:         nil,
-		})
+		if !r.canViewPost(ctx, post) {
+			continue
+		}
+
+		gqlPosts = append(gqlPosts, toGQLPost(post, nil, nil))
 	}
 
-	r.Logger.Info("Fetch all posts successfully")
+	r.logger(ctx).Info("Fetch all posts successfully")
 
 	if limit != nil && offset != nil {
 		start := int(*offset)
@@ -134,51 +124,38 @@ func (r *queryResolver) Comment(ctx context.Context, id string) (*generated.Comm
 	intID, err := strconv.ParseInt(id, 10, 64)
 
 	if err != nil {
-		r.Logger.Error("invalid comment id", slog.String("err", err.Error()))
+		r.logger(ctx).Error("invalid comment id", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("invalid comment id")
 	}
 
 	comment, err := r.Storage.Comment.GetCommentByID(ctx, intID)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch comment", slog.String("err", err.Error()))
+		r.logger(ctx).Error("failed to fetch comment", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to fetch comment")
+	}
+
+	if !r.canViewComment(ctx, comment) {
+		r.logger(ctx).Info("comment is not visible to caller", slog.Int64("id", intID))
 		return nil, fmt.Errorf("failed to fetch comment")
 	}
 
 	childComments, err := r.Storage.Comment.GetCommentsByParentID(ctx, comment.ID)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch child comments", slog.String("err", err.Error()))
+		r.logger(ctx).Error("failed to fetch child comments", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("failed to fetch child comments")
 	}
 
 	gqlReplies := make([]*generated.Comment, 0, len(childComments))
 
 	for _, child := range childComments {
-		gqlReplies = append(gqlReplies, &generated.Comment{
-			ID:        strconv.FormatInt(child.ID, 10),
-			PostID:    strconv.FormatInt(child.PostID, 10),
-			ParentID:  &id,
-			Content:   child.Content,
-			CreatedAt: child.CreatedAt.Format(time.RFC3339),
-			Replies:   nil,
-		})
-	}
-
-	var parentIDCopy *string
-	if comment.ParentID != nil {
-		s := strconv.FormatInt(*comment.ParentID, 10)
-		parentIDCopy = &s
-	}
-
-	return &generated.Comment{
-		ID:        strconv.FormatInt(comment.ID, 10),
-		PostID:    strconv.FormatInt(comment.PostID, 10),
-		ParentID:  parentIDCopy,
-		Content:   comment.Content,
-		CreatedAt: comment.CreatedAt.Format(time.RFC3339),
-		Replies:   gqlReplies,
-	}, nil
+		if r.canViewComment(ctx, child) {
+			gqlReplies = append(gqlReplies, toGQLComment(child, nil))
+		}
+	}
+
+	return toGQLComment(comment, gqlReplies), nil
 }
 
 // Comments is the resolver for the comments field.
@@ -186,61 +163,166 @@ func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int3
 	intPostID, err := strconv.ParseInt(postID, 10, 64)
 
 	if err != nil {
-		r.Logger.Error("invalid post id", slog.String("err", err.Error()))
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("invalid post id")
 	}
 
+	post, err := r.Storage.Post.GetPostByID(ctx, intPostID)
+
+	if err != nil || !r.canViewPost(ctx, post) {
+		r.logger(ctx).Error("failed to fetch post", slog.String("id", postID))
+		return nil, fmt.Errorf("failed to fetch post")
+	}
+
 	comments, err := r.Storage.Comment.GetCommentsByPostID(ctx, intPostID, limit, offset)
 
 	if err != nil {
-		r.Logger.Error("failed to fetch comments", slog.String("err", err.Error()))
+		r.logger(ctx).Error("failed to fetch comments", slog.String("err", err.Error()))
 		return nil, fmt.Errorf("failed to fetch comments")
 	}
 
 	gqlComments := make([]*generated.Comment, 0, len(comments))
 
 	for _, comment := range comments {
+		if !r.canViewComment(ctx, comment) {
+			continue
+		}
+
 		childComments, err := r.Storage.Comment.GetCommentsByParentID(ctx, comment.ID)
 
 		if err != nil {
-			r.Logger.Error("failed to fetch child comments", slog.String("err", err.Error()))
+			r.logger(ctx).Error("failed to fetch child comments", slog.String("err", err.Error()))
 			return nil, fmt.Errorf("failed to fetch child comments")
 		}
 
 		gqlChildComments := make([]*generated.Comment, 0, len(childComments))
 
 		for _, child := range childComments {
-			var childParentIDCopy *string
-			if child.ParentID != nil {
-				s := strconv.FormatInt(*child.ParentID, 10)
-				childParentIDCopy = &s
+			if r.canViewComment(ctx, child) {
+				gqlChildComments = append(gqlChildComments, toGQLComment(child, nil))
 			}
+		}
+
+		gqlComments = append(gqlComments, toGQLComment(comment, gqlChildComments))
+	}
+
+	return gqlComments, nil
+}
+
+// Thread is the resolver for the thread field. It lists at most
+// Threads.MaxThreadComments comments, taken level by level, so a large
+// thread is cut off at its deepest replies; they can be fetched by passing
+// their ancestor as rootID.
+func (r *queryResolver) Thread(ctx context.Context, postID string, rootID *string, maxDepth *int32) ([]*generated.Comment, error) {
+	intPostID, err := strconv.ParseInt(postID, 10, 64)
 
-			gqlChildComments = append(gqlChildComments, &generated.Comment{
-				ID:        strconv.FormatInt(child.ID, 10),
-				PostID:    strconv.FormatInt(child.PostID, 10),
-				ParentID:  childParentIDCopy,
-				Content:   child.Content,
-				CreatedAt: child.CreatedAt.Format(time.RFC3339),
-				Replies:   nil,
-			})
+	if err != nil {
+		r.logger(ctx).Error("invalid post id", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("invalid post id")
+	}
+
+	var intRootID *int64
+
+	if rootID != nil {
+		id, err := strconv.ParseInt(*rootID, 10, 64)
+
+		if err != nil {
+			r.logger(ctx).Error("invalid root id", slog.String("err", err.Error()))
+			return nil, fmt.Errorf("invalid root id")
 		}
 
-		var parentIDCopy *string
-		if comment.ParentID != nil {
-			s := strconv.FormatInt(*comment.ParentID, 10)
-			parentIDCopy = &s
+		intRootID = &id
+	}
+
+	depth := 0
+
+	if maxDepth != nil {
+		if *maxDepth < 0 {
+			r.logger(ctx).Error("invalid max depth", slog.Int("max depth", int(*maxDepth)))
+			return nil, fmt.Errorf("invalid max depth")
 		}
 
-		gqlComments = append(gqlComments, &generated.Comment{
-			ID:        strconv.FormatInt(comment.ID, 10),
-			PostID:    strconv.FormatInt(comment.PostID, 10),
-			ParentID:  parentIDCopy,
-			Content:   comment.Content,
-			CreatedAt: comment.CreatedAt.Format(time.RFC3339),
-			Replies:   gqlChildComments,
-		})
+		depth = int(*maxDepth)
 	}
 
-	return gqlComments, nil
+	post, err := r.Storage.Post.GetPostByID(ctx, intPostID)
+
+	if err != nil || !r.canViewPost(ctx, post) {
+		r.logger(ctx).Error("failed to fetch post", slog.String("id", postID))
+		return nil, fmt.Errorf("failed to fetch post")
+	}
+
+	thread, err := r.Storage.Comment.GetThread(ctx, intPostID, intRootID, depth, r.Threads.MaxThreadComments)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch thread", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to fetch thread")
+	}
+
+	return r.toGQLThread(ctx, thread), nil
+}
+
+// Notifications is the resolver for the notifications field.
+func (r *queryResolver) Notifications(ctx context.Context, unreadOnly *bool, first *int32, after *string) ([]*generated.Notification, error) {
+	user, ok := auth.UserFromContext(ctx)
+
+	if !ok {
+		return nil, fmt.Errorf("unauthenticated")
+	}
+
+	var afterID *int64
+
+	if after != nil {
+		intAfter, err := strconv.ParseInt(*after, 10, 64)
+
+		if err != nil {
+			r.logger(ctx).Error("invalid cursor", slog.String("err", err.Error()))
+			return nil, fmt.Errorf("invalid cursor")
+		}
+
+		afterID = &intAfter
+	}
+
+	notifications, err := r.Storage.Notification.GetNotificationsByRecipient(ctx, user, unreadOnly != nil && *unreadOnly, first, afterID)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch notifications", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to fetch notifications")
+	}
+
+	gqlNotifications := make([]*generated.Notification, 0, len(notifications))
+
+	for _, notification := range notifications {
+		gqlNotifications = append(gqlNotifications, toGQLNotification(notification))
+	}
+
+	return gqlNotifications, nil
+}
+
+// WebhookDeliveries is the resolver for the webhookDeliveries field.
+func (r *queryResolver) WebhookDeliveries(ctx context.Context, status *generated.WebhookDeliveryStatus, limit *int32, offset *int32) ([]*generated.WebhookDelivery, error) {
+	if !auth.IsAdmin(ctx, r.Admins) {
+		return nil, fmt.Errorf("forbidden")
+	}
+
+	var statusFilter *string
+	if status != nil {
+		s := status.String()
+		statusFilter = &s
+	}
+
+	deliveries, err := r.Storage.Webhook.GetDeliveries(ctx, statusFilter, limit, offset)
+
+	if err != nil {
+		r.logger(ctx).Error("failed to fetch webhook deliveries", slog.String("err", err.Error()))
+		return nil, fmt.Errorf("failed to fetch webhook deliveries")
+	}
+
+	gqlDeliveries := make([]*generated.WebhookDelivery, 0, len(deliveries))
+
+	for _, delivery := range deliveries {
+		gqlDeliveries = append(gqlDeliveries, toGQLWebhookDelivery(delivery))
+	}
+
+	return gqlDeliveries, nil
 }
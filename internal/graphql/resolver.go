@@ -1,15 +1,36 @@
 package graphql
 
 import (
+	"context"
 	"log/slog"
+	"strconv"
+	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/constants"
 	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/logging"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/notification"
 	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/webhook"
 )
 
 type Resolver struct {
-	Storage *storage.Storage
-	Logger  *slog.Logger
+	Storage     *storage.Storage
+	Logger      *slog.Logger
+	Broker      *notification.Broker
+	Webhooks    *webhook.Dispatcher
+	Threads     config.Threads
+	Idempotency config.Idempotency
+	Admins      []string
+}
+
+// logger returns the request-scoped logger, which carries the request ID,
+// operation and user.
+func (r *Resolver) logger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, r.Logger)
 }
 
 func (r *Resolver) Query() generated.QueryResolver {
@@ -19,3 +40,136 @@ func (r *Resolver) Query() generated.QueryResolver {
 func (r *Resolver) Mutation() generated.MutationResolver {
 	return &mutationResolver{r}
 }
+
+func (r *Resolver) Subscription() generated.SubscriptionResolver {
+	return &subscriptionResolver{r}
+}
+
+// canViewPost reports whether the caller may see the post. Published posts
+// are public, everything else is visible only to its author and moderators.
+func (r *Resolver) canViewPost(ctx context.Context, post models.Post) bool {
+	return post.Status == constants.PostPublished || r.canManagePost(ctx, post)
+}
+
+// canViewComment hides deleted and spam comments from everyone but
+// moderators.
+func (r *Resolver) canViewComment(ctx context.Context, comment models.Comment) bool {
+	return comment.Status == constants.CommentVisible || auth.IsAdmin(ctx, r.Admins)
+}
+
+func (r *Resolver) canManagePost(ctx context.Context, post models.Post) bool {
+	if auth.IsAdmin(ctx, r.Admins) {
+		return true
+	}
+
+	user, ok := auth.UserFromContext(ctx)
+	return ok && user == post.Author
+}
+
+func (r *Resolver) canManageComment(ctx context.Context, comment models.Comment) bool {
+	if auth.IsAdmin(ctx, r.Admins) {
+		return true
+	}
+
+	user, ok := auth.UserFromContext(ctx)
+	return ok && user == comment.Author
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+func optionalID(id *int64) *string {
+	if id == nil {
+		return nil
+	}
+
+	s := strconv.FormatInt(*id, 10)
+	return &s
+}
+
+func optionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+func optionalVersion(version *int32) *int64 {
+	if version == nil {
+		return nil
+	}
+
+	v := int64(*version)
+	return &v
+}
+
+func toGQLComment(comment models.Comment, replies []*generated.Comment) *generated.Comment {
+	return &generated.Comment{
+		ID:        strconv.FormatInt(comment.ID, 10),
+		PostID:    strconv.FormatInt(comment.PostID, 10),
+		ParentID:  optionalID(comment.ParentID),
+		ReplyToID: optionalID(comment.ReplyToID),
+		Depth:     int32(comment.Depth),
+		Author:    optionalString(comment.Author),
+		Content:   comment.Content,
+		Status:    generated.CommentStatus(comment.Status),
+		Pinned:    comment.Pinned,
+		CreatedAt: comment.CreatedAt.Format(time.RFC3339),
+		Version:   int32(comment.Version),
+		Replies:   replies,
+	}
+}
+
+// toGQLThread nests the comments listed by GetThread under the top ones.
+// Comments the caller may not view are left out along with their replies.
+func (r *Resolver) toGQLThread(ctx context.Context, thread []models.ThreadComment) []*generated.Comment {
+	top := make([]*generated.Comment, 0)
+	nodes := make(map[int64]*generated.Comment, len(thread))
+
+	for _, comment := range thread {
+		if !r.canViewComment(ctx, comment.Comment) {
+			continue
+		}
+
+		node := toGQLComment(comment.Comment, make([]*generated.Comment, 0))
+
+		if comment.Depth == 0 {
+			top = append(top, node)
+		} else {
+			// Parents are listed first, so a missing one was left out.
+			parent, ok := nodes[comment.Path[len(comment.Path)-2]]
+			if !ok {
+				continue
+			}
+
+			parent.Replies = append(parent.Replies, node)
+		}
+
+		nodes[comment.Comment.ID] = node
+	}
+
+	return top
+}
+
+func toGQLPost(post models.Post, comments, pinnedComments []*generated.Comment) *generated.Post {
+	return &generated.Post{
+		ID:               strconv.FormatInt(post.ID, 10),
+		Title:            post.Title,
+		Content:          post.Content,
+		Author:           optionalString(post.Author),
+		Status:           generated.PostStatus(post.Status),
+		PublishAt:        optionalTime(post.PublishAt),
+		CommentsDisabled: post.CommentsDisabled,
+		CreatedAt:        post.CreatedAt.Format(time.RFC3339),
+		Version:          int32(post.Version),
+		Comments:         comments,
+		PinnedComments:   pinnedComments,
+	}
+}
@@ -0,0 +1,51 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+)
+
+type subscriptionResolver struct{ *Resolver }
+
+// NotificationAdded is the resolver for the notificationAdded field.
+func (r *subscriptionResolver) NotificationAdded(ctx context.Context) (<-chan *generated.Notification, error) {
+	user, ok := auth.UserFromContext(ctx)
+
+	if !ok {
+		return nil, fmt.Errorf("unauthenticated")
+	}
+
+	if r.Broker == nil {
+		return nil, fmt.Errorf("subscriptions are not available")
+	}
+
+	notifications, unsubscribe := r.Broker.Subscribe(user)
+	out := make(chan *generated.Notification, 1)
+
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification, ok := <-notifications:
+				if !ok {
+					return
+				}
+
+				select {
+				case out <- toGQLNotification(notification):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,42 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// emit enqueues a webhook event in the outbox of tx, so that the event is
+// committed together with the change that produced it.
+func (r *Resolver) emit(ctx context.Context, tx storage.Storage, event string, data any) error {
+	if r.Webhooks == nil {
+		return nil
+	}
+
+	if err := r.Webhooks.Emit(ctx, tx.Webhook, event, data); err != nil {
+		r.logger(ctx).Error("failed to enqueue webhook", slog.String("err", err.Error()), slog.String("event", event))
+		return fmt.Errorf("failed to enqueue webhook")
+	}
+
+	return nil
+}
+
+func toGQLWebhookDelivery(delivery models.WebhookDelivery) *generated.WebhookDelivery {
+	return &generated.WebhookDelivery{
+		ID:            strconv.FormatInt(delivery.ID, 10),
+		Event:         delivery.Event,
+		Endpoint:      delivery.Endpoint,
+		Status:        generated.WebhookDeliveryStatus(delivery.Status),
+		Attempts:      int32(delivery.Attempts),
+		LastError:     optionalString(delivery.LastError),
+		NextAttemptAt: delivery.NextAttemptAt.Format(time.RFC3339),
+		CreatedAt:     delivery.CreatedAt.Format(time.RFC3339),
+		DeliveredAt:   optionalTime(delivery.DeliveredAt),
+	}
+}
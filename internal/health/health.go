@@ -0,0 +1,136 @@
+// Package health serves the liveness and readiness endpoints used by the
+// orchestrator.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of the service's dependencies.
+type Checker struct {
+	timeout  time.Duration
+	checks   []namedCheck
+	draining atomic.Bool
+	logger   *slog.Logger
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// NewChecker returns a Checker that gives each check at most timeout.
+func NewChecker(timeout time.Duration, logger *slog.Logger) *Checker {
+	return &Checker{timeout: timeout, logger: logger}
+}
+
+// Add registers a dependency. Checks must be added before serving.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the service report not ready from now on, so the
+// orchestrator stops routing to it while in-flight requests finish.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs every check concurrently.
+func (c *Checker) Ready(ctx context.Context) Report {
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(c.checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			result := CheckResult{Status: StatusOK}
+			if err := nc.check(checkCtx); err != nil {
+				result = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			}
+
+			mu.Lock()
+			report.Checks[nc.name] = result
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	if c.draining.Load() {
+		report.Status = StatusDraining
+	}
+
+	return report
+}
+
+// LiveHandler answers as long as the process can serve HTTP at all.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadyHandler answers 200 when every dependency is healthy and the service
+// is not draining, 503 otherwise. The body reports each dependency.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Ready(r.Context())
+
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+			c.logger.Warn("service not ready", slog.String("status", report.Status), slog.Any("checks", report.Checks))
+		}
+
+		writeJSON(w, code, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
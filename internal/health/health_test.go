@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, handler http.Handler) (int, Report) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var report Report
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+
+	return rec.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	checker := NewChecker(50*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var storageErr error
+	checker.Add("storage", func(ctx context.Context) error { return storageErr })
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, report := get(t, checker.ReadyHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusUnavailable, report.Status)
+	assert.Equal(t, CheckResult{Status: StatusOK}, report.Checks["storage"])
+	assert.Equal(t, CheckResult{Status: StatusUnavailable, Error: context.DeadlineExceeded.Error()}, report.Checks["slow"])
+
+	checker = NewChecker(time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	checker.Add("storage", func(ctx context.Context) error { return storageErr })
+
+	code, report = get(t, checker.ReadyHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+
+	storageErr = errors.New("database schema is behind")
+	code, report = get(t, checker.ReadyHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "database schema is behind", report.Checks["storage"].Error)
+
+	storageErr = nil
+	checker.Drain()
+	code, report = get(t, checker.ReadyHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDraining, report.Status)
+
+	// Liveness does not depend on dependencies or draining.
+	code, report = get(t, checker.LiveHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+}
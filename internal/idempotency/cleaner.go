@@ -0,0 +1,53 @@
+// Package idempotency expires the idempotency keys of create mutations.
+package idempotency
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// Cleaner periodically deletes expired idempotency keys.
+type Cleaner struct {
+	keys     storage.IdempotencyStorage
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func NewCleaner(keys storage.IdempotencyStorage, interval time.Duration, logger *slog.Logger) *Cleaner {
+	return &Cleaner{
+		keys:     keys,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run deletes expired keys every interval until ctx is cancelled.
+func (c *Cleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.deleteExpired(ctx, now)
+		}
+	}
+}
+
+func (c *Cleaner) deleteExpired(ctx context.Context, now time.Time) {
+	deleted, err := c.keys.DeleteExpiredKeys(ctx, now)
+
+	if err != nil {
+		c.logger.Error("failed to delete expired idempotency keys", slog.String("err", err.Error()))
+		return
+	}
+
+	if deleted > 0 {
+		c.logger.Debug("expired idempotency keys deleted", slog.Int64("count", deleted))
+	}
+}
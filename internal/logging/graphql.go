@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// Extension returns the gqlgen extension that adds the operation name to the
+// request-scoped logger and reports operations and their errors, including
+// parse and validation errors, to the access log.
+func Extension() graphql.HandlerExtension {
+	return operationLogger{}
+}
+
+type operationLogger struct{}
+
+var (
+	_ graphql.HandlerExtension     = operationLogger{}
+	_ graphql.OperationInterceptor = operationLogger{}
+	_ graphql.ResponseInterceptor  = operationLogger{}
+)
+
+func (operationLogger) ExtensionName() string {
+	return "Logging"
+}
+
+func (operationLogger) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (operationLogger) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		ctx = WithLogger(ctx, logger.With(slog.String("operation", operationName(ctx))))
+	}
+
+	return next(ctx)
+}
+
+func (operationLogger) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	response := next(ctx)
+
+	if req, ok := ctx.Value(requestKey{}).(*request); ok && response != nil {
+		req.record(operationName(ctx), len(response.Errors))
+	}
+
+	return response
+}
+
+// operationName falls back to the operation type for anonymous operations
+// and is empty when the document did not parse.
+func operationName(ctx context.Context) string {
+	if !graphql.HasOperationContext(ctx) {
+		return ""
+	}
+
+	oc := graphql.GetOperationContext(ctx)
+	if oc.Operation == nil {
+		return ""
+	}
+
+	if oc.Operation.Name != "" {
+		return oc.Operation.Name
+	}
+
+	return string(oc.Operation.Operation)
+}
@@ -0,0 +1,182 @@
+// Package logging ties log lines to the request that produced them: it
+// assigns request IDs, keeps a request-scoped logger in the context and
+// writes one access log line per request.
+package logging
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/auth"
+)
+
+// RequestIDHeader is read from the request, or generated when missing, and
+// echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+type requestKey struct{}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request-scoped logger, or fallback outside a
+// request.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return fallback
+}
+
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// request collects what the GraphQL extension learns about the request for
+// the access log line.
+type request struct {
+	mu        sync.Mutex
+	operation string
+	errors    int
+}
+
+func (r *request) record(operation string, errors int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.operation == "" {
+		r.operation = operation
+	}
+	r.errors += errors
+}
+
+// Middleware assigns the request ID and the request-scoped logger. It must
+// run inside auth.Middleware to log the user.
+func Middleware(log *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := log.With(slog.String("request_id", id))
+		if user, ok := auth.UserFromContext(r.Context()); ok {
+			logger = logger.With(slog.String("user", user))
+		}
+
+		req := &request{}
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = context.WithValue(ctx, requestKey{}, req)
+		ctx = WithLogger(ctx, logger)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		req.mu.Lock()
+		defer req.mu.Unlock()
+
+		attrs := []any{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("errors", req.errors),
+		}
+
+		if req.operation != "" {
+			attrs = append(attrs, slog.String("operation", req.operation))
+		}
+
+		logger.Info("request completed", attrs...)
+	})
+}
+
+// validRequestID accepts IDs from upstream proxies as long as they are
+// short printable ASCII, so they can not forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
+
+// statusRecorder remembers the response status. It keeps the writer usable
+// for websocket upgrades and streaming.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+
+	r.status = http.StatusSwitchingProtocols
+	r.wroteHeader = true
+
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
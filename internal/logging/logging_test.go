@@ -0,0 +1,107 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/graphql"
+	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/logging"
+	"github.com/Pacahar/graphql-comments/internal/notification"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/Pacahar/graphql-comments/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupHandler(t *testing.T, out *bytes.Buffer) http.Handler {
+	logger := slog.New(slog.NewJSONHandler(out, nil))
+
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: &graphql.Resolver{
+		Storage:  st,
+		Logger:   logger,
+		Broker:   notification.NewBroker(),
+		Webhooks: webhook.NewDispatcher(config.Webhooks{}, st.Webhook, logger),
+	}}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(logging.Extension())
+
+	return auth.Middleware(logging.Middleware(logger, srv))
+}
+
+func logLines(t *testing.T, out *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		lines = append(lines, entry)
+	}
+
+	out.Reset()
+
+	return lines
+}
+
+func query(api http.Handler, body, requestID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.UserHeader, "alice")
+	if requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestRequestScopedLogging(t *testing.T) {
+	var out bytes.Buffer
+	api := setupHandler(t, &out)
+
+	rec := query(api, `{"query": "query GetPost { post(id: \"42\") { id } }"}`, "req-1")
+	assert.Equal(t, "req-1", rec.Header().Get(logging.RequestIDHeader))
+
+	lines := logLines(t, &out)
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+
+	// The resolver's own line carries the request context.
+	assert.Equal(t, "failed to fetch post", lines[0]["msg"])
+	assert.Equal(t, "req-1", lines[0]["request_id"])
+	assert.Equal(t, "alice", lines[0]["user"])
+	assert.Equal(t, "GetPost", lines[0]["operation"])
+
+	assert.Equal(t, "request completed", lines[1]["msg"])
+	assert.Equal(t, "req-1", lines[1]["request_id"])
+	assert.Equal(t, float64(http.StatusOK), lines[1]["status"])
+	assert.Equal(t, float64(1), lines[1]["errors"])
+	assert.Equal(t, "GetPost", lines[1]["operation"])
+	assert.Contains(t, lines[1], "duration")
+
+	// Parse errors never reach the resolvers but are still counted.
+	rec = query(api, `{"query": "{ post("}`, "bad\nid")
+	assigned := rec.Header().Get(logging.RequestIDHeader)
+	assert.Len(t, assigned, 32)
+
+	lines = logLines(t, &out)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, assigned, lines[0]["request_id"])
+		assert.Equal(t, float64(1), lines[0]["errors"])
+		assert.NotContains(t, lines[0], "operation")
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	// otherOperation labels operations selecting several root fields or
+	// selecting them through fragments.
+	otherOperation = "other"
+	// codeUnknown labels errors without a code extension, which is what
+	// resolvers return for internal failures.
+	codeUnknown = "INTERNAL"
+)
+
+// Extension returns the gqlgen extension recording operation metrics. It
+// only sees operations that parsed and validated.
+func (m *Metrics) Extension() graphql.HandlerExtension {
+	return operationTracer{m}
+}
+
+type operationTracer struct {
+	m *Metrics
+}
+
+var (
+	_ graphql.HandlerExtension     = operationTracer{}
+	_ graphql.OperationInterceptor = operationTracer{}
+)
+
+func (operationTracer) ExtensionName() string {
+	return "Metrics"
+}
+
+func (operationTracer) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (t operationTracer) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+
+	start := oc.Stats.OperationStart
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	name := operationLabel(oc.Operation)
+
+	operationType := string(oc.Operation.Operation)
+
+	responses := next(ctx)
+
+	return func(ctx context.Context) *graphql.Response {
+		response := responses(ctx)
+		if response == nil {
+			return nil
+		}
+
+		// A subscription responds once per event, long after it started, so
+		// only its errors are recorded.
+		if oc.Operation.Operation != ast.Subscription {
+			t.m.operationDuration.WithLabelValues(name, operationType).Observe(time.Since(start).Seconds())
+		}
+
+		for _, err := range response.Errors {
+			code, _ := err.Extensions["code"].(string)
+			if code == "" {
+				code = codeUnknown
+			}
+
+			t.m.operationErrors.WithLabelValues(name, operationType, code).Inc()
+		}
+
+		return response
+	}
+}
+
+// operationLabel names an operation by its root field. Operation names are
+// chosen by clients and would let them grow the label set without bound,
+// root fields are limited by the schema.
+func operationLabel(op *ast.OperationDefinition) string {
+	if len(op.SelectionSet) != 1 {
+		return otherOperation
+	}
+
+	field, ok := op.SelectionSet[0].(*ast.Field)
+	if !ok {
+		return otherOperation
+	}
+
+	return field.Name
+}
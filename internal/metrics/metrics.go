@@ -0,0 +1,55 @@
+// Package metrics exposes the service's Prometheus metrics: GraphQL
+// operation latency and errors, collected by a gqlgen extension, and
+// storage call latency, collected by a storage decorator.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	operationDuration *prometheus.HistogramVec
+	operationErrors   *prometheus.CounterVec
+	storageDuration   *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "graphql_operation_duration_seconds",
+			Help:    "Time from receiving a GraphQL operation to its response.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation", "type"}),
+		operationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphql_errors_total",
+			Help: "Errors returned in GraphQL responses, by the code extension.",
+		}, []string{"operation", "type", "code"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "storage_call_duration_seconds",
+			Help:    "Duration of storage calls.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"storage", "method"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.operationDuration,
+		m.operationErrors,
+		m.storageDuration,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/graphql"
+	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/notification"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/Pacahar/graphql-comments/internal/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationAndStorageMetrics(t *testing.T) {
+	m := New()
+
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	st, err = m.InstrumentStorage(st)
+	assert.NoError(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: &graphql.Resolver{
+		Storage:  st,
+		Logger:   logger,
+		Broker:   notification.NewBroker(),
+		Webhooks: webhook.NewDispatcher(config.Webhooks{}, st.Webhook, logger),
+	}}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(m.Extension())
+
+	api := auth.Middleware(srv)
+
+	post := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.UserHeader, "alice")
+
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	post(`{"query": "mutation NewPost { createPost(title: \"T\", content: \"C\", commentsDisabled: false) { id } }"}`)
+	post(`{"query": "{ post(id: \"42\") { id } }"}`)
+	post(`{"query": "query Random123 { post(id: \"1\") { id } }"}`)
+	post(`{"query": "{ a: post(id: \"1\") { id } b: post(id: \"2\") { id } }"}`)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(m.operationDuration))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.operationErrors))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.operationErrors.WithLabelValues("post", "query", codeUnknown)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.operationErrors.WithLabelValues(otherOperation, "query", codeUnknown)))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `graphql_operation_duration_seconds_count{operation="createPost",type="mutation"} 1`)
+	assert.Contains(t, body, `graphql_operation_duration_seconds_count{operation="post",type="query"} 2`)
+	assert.Contains(t, body, `graphql_operation_duration_seconds_count{operation="other",type="query"} 1`)
+	assert.NotContains(t, body, "Random123")
+	assert.Contains(t, body, `storage_call_duration_seconds_count{method="CreatePost",storage="post"} 1`)
+	assert.Contains(t, body, `memory_storage_entities{entity="posts"} 1`)
+}
+
+func TestStorageCallsInsideTransactions(t *testing.T) {
+	m := New()
+
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	st, err = m.InstrumentStorage(st)
+	assert.NoError(t, err)
+
+	err = st.WithTx(context.Background(), func(ctx context.Context, tx storage.Storage) error {
+		_, err := tx.Post.CreatePost(context.Background(), "T", "C", "alice", constants.PostPublished, false)
+		return err
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(1), sampleCount(t, m, "tx", "WithTx"))
+	assert.Equal(t, uint64(1), sampleCount(t, m, "post", "CreatePost"))
+}
+
+func sampleCount(t *testing.T, m *Metrics, storage, method string) uint64 {
+	var metric dto.Metric
+	assert.NoError(t, m.storageDuration.WithLabelValues(storage, method).(prometheus.Histogram).Write(&metric))
+
+	return metric.GetHistogram().GetSampleCount()
+}
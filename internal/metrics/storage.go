@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentStorage returns st with the duration of every call recorded,
+// including calls made inside transactions, and registers the backend's own
+// collector.
+func (m *Metrics) InstrumentStorage(st *storage.Storage) (*storage.Storage, error) {
+	const op = "metrics.InstrumentStorage"
+
+	if st.Collector != nil {
+		if err := m.registry.Register(st.Collector); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	instrumented := m.instrument(*st)
+
+	return &instrumented, nil
+}
+
+func (m *Metrics) instrument(st storage.Storage) storage.Storage {
+	observe := func(name string) observer {
+		return observer{storage: name, duration: m.storageDuration}
+	}
+
+	instrumented := st
+	instrumented.Post = postStorage{st.Post, observe("post")}
+	instrumented.Comment = commentStorage{st.Comment, observe("comment")}
+	instrumented.Notification = notificationStorage{st.Notification, observe("notification")}
+	instrumented.Webhook = webhookStorage{st.Webhook, observe("webhook")}
+	instrumented.Idempotency = idempotencyStorage{st.Idempotency, observe("idempotency")}
+
+	if st.Transactor != nil {
+		instrumented.Transactor = transactor{st.Transactor, m, observe("tx")}
+	}
+
+	return instrumented
+}
+
+type observer struct {
+	storage  string
+	duration *prometheus.HistogramVec
+}
+
+// observe is deferred with the call's start time.
+func (o observer) observe(method string, start time.Time) {
+	o.duration.WithLabelValues(o.storage, method).Observe(time.Since(start).Seconds())
+}
+
+type transactor struct {
+	next storage.Transactor
+	m    *Metrics
+	observer
+}
+
+func (t transactor) WithTx(ctx context.Context, fn func(ctx context.Context, tx storage.Storage) error) error {
+	defer t.observe("WithTx", time.Now())
+	return t.next.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		return fn(ctx, t.m.instrument(tx))
+	})
+}
+
+type postStorage struct {
+	next storage.PostStorage
+	observer
+}
+
+func (s postStorage) CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error) {
+	defer s.observe("CreatePost", time.Now())
+	return s.next.CreatePost(ctx, title, content, author, status, commentsDisabled)
+}
+
+func (s postStorage) ImportPost(ctx context.Context, post models.Post) (int64, error) {
+	defer s.observe("ImportPost", time.Now())
+	return s.next.ImportPost(ctx, post)
+}
+
+func (s postStorage) GetPostByID(ctx context.Context, id int64) (models.Post, error) {
+	defer s.observe("GetPostByID", time.Now())
+	return s.next.GetPostByID(ctx, id)
+}
+
+func (s postStorage) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	defer s.observe("GetAllPosts", time.Now())
+	return s.next.GetAllPosts(ctx)
+}
+
+func (s postStorage) UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error {
+	defer s.observe("UpdatePost", time.Now())
+	return s.next.UpdatePost(ctx, id, title, content, expectedVersion)
+}
+
+func (s postStorage) SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error {
+	defer s.observe("SetCommentsDisabled", time.Now())
+	return s.next.SetCommentsDisabled(ctx, id, disabled, expectedVersion)
+}
+
+func (s postStorage) SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error {
+	defer s.observe("SetPostStatus", time.Now())
+	return s.next.SetPostStatus(ctx, id, status, publishAt, expectedVersion)
+}
+
+func (s postStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]int64, error) {
+	defer s.observe("PublishDuePosts", time.Now())
+	return s.next.PublishDuePosts(ctx, now)
+}
+
+func (s postStorage) DeletePost(ctx context.Context, id int64, expectedVersion *int64) error {
+	defer s.observe("DeletePost", time.Now())
+	return s.next.DeletePost(ctx, id, expectedVersion)
+}
+
+type commentStorage struct {
+	next storage.CommentStorage
+	observer
+}
+
+func (s commentStorage) CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error) {
+	defer s.observe("CreateComment", time.Now())
+	return s.next.CreateComment(ctx, content, author, postID, parentID, replyToID)
+}
+
+func (s commentStorage) ImportComment(ctx context.Context, comment models.Comment) (int64, error) {
+	defer s.observe("ImportComment", time.Now())
+	return s.next.ImportComment(ctx, comment)
+}
+
+func (s commentStorage) GetCommentByID(ctx context.Context, id int64) (models.Comment, error) {
+	defer s.observe("GetCommentByID", time.Now())
+	return s.next.GetCommentByID(ctx, id)
+}
+
+func (s commentStorage) GetCommentsByParentID(ctx context.Context, postID int64) ([]models.Comment, error) {
+	defer s.observe("GetCommentsByParentID", time.Now())
+	return s.next.GetCommentsByParentID(ctx, postID)
+}
+
+func (s commentStorage) GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) ([]models.Comment, error) {
+	defer s.observe("GetCommentsByPostID", time.Now())
+	return s.next.GetCommentsByPostID(ctx, postID, limit, offset)
+}
+
+func (s commentStorage) GetThread(ctx context.Context, postID int64, rootID *int64, maxDepth, limit int) ([]models.ThreadComment, error) {
+	defer s.observe("GetThread", time.Now())
+	return s.next.GetThread(ctx, postID, rootID, maxDepth, limit)
+}
+
+func (s commentStorage) UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error {
+	defer s.observe("UpdateComment", time.Now())
+	return s.next.UpdateComment(ctx, id, content, expectedVersion)
+}
+
+func (s commentStorage) DeleteComment(ctx context.Context, id int64, expectedVersion *int64) error {
+	defer s.observe("DeleteComment", time.Now())
+	return s.next.DeleteComment(ctx, id, expectedVersion)
+}
+
+func (s commentStorage) DeleteCommentsByPostID(ctx context.Context, id int64) error {
+	defer s.observe("DeleteCommentsByPostID", time.Now())
+	return s.next.DeleteCommentsByPostID(ctx, id)
+}
+
+func (s commentStorage) LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error {
+	defer s.observe("LockComment", time.Now())
+	return s.next.LockComment(ctx, id, reason, lockedBy, expiresAt)
+}
+
+func (s commentStorage) UnlockComment(ctx context.Context, id int64) error {
+	defer s.observe("UnlockComment", time.Now())
+	return s.next.UnlockComment(ctx, id)
+}
+
+func (s commentStorage) FindActiveLock(ctx context.Context, id int64, now time.Time) (models.CommentLock, error) {
+	defer s.observe("FindActiveLock", time.Now())
+	return s.next.FindActiveLock(ctx, id, now)
+}
+
+func (s commentStorage) PinComment(ctx context.Context, postID, commentID int64, maxPins int) error {
+	defer s.observe("PinComment", time.Now())
+	return s.next.PinComment(ctx, postID, commentID, maxPins)
+}
+
+func (s commentStorage) UnpinComment(ctx context.Context, postID, commentID int64) error {
+	defer s.observe("UnpinComment", time.Now())
+	return s.next.UnpinComment(ctx, postID, commentID)
+}
+
+func (s commentStorage) GetPinnedComments(ctx context.Context, postID int64) ([]models.Comment, error) {
+	defer s.observe("GetPinnedComments", time.Now())
+	return s.next.GetPinnedComments(ctx, postID)
+}
+
+type notificationStorage struct {
+	next storage.NotificationStorage
+	observer
+}
+
+func (s notificationStorage) CreateNotification(ctx context.Context, recipient, notificationType string, postID, commentID int64) (int64, error) {
+	defer s.observe("CreateNotification", time.Now())
+	return s.next.CreateNotification(ctx, recipient, notificationType, postID, commentID)
+}
+
+func (s notificationStorage) GetNotificationByID(ctx context.Context, id int64) (models.Notification, error) {
+	defer s.observe("GetNotificationByID", time.Now())
+	return s.next.GetNotificationByID(ctx, id)
+}
+
+func (s notificationStorage) GetNotificationsByRecipient(ctx context.Context, recipient string, unreadOnly bool, first *int32, after *int64) ([]models.Notification, error) {
+	defer s.observe("GetNotificationsByRecipient", time.Now())
+	return s.next.GetNotificationsByRecipient(ctx, recipient, unreadOnly, first, after)
+}
+
+func (s notificationStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int64) (int64, error) {
+	defer s.observe("MarkNotificationsRead", time.Now())
+	return s.next.MarkNotificationsRead(ctx, recipient, ids)
+}
+
+type webhookStorage struct {
+	next storage.WebhookStorage
+	observer
+}
+
+func (s webhookStorage) EnqueueDelivery(ctx context.Context, event, endpoint string, payload []byte) (int64, error) {
+	defer s.observe("EnqueueDelivery", time.Now())
+	return s.next.EnqueueDelivery(ctx, event, endpoint, payload)
+}
+
+func (s webhookStorage) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	defer s.observe("ClaimDueDeliveries", time.Now())
+	return s.next.ClaimDueDeliveries(ctx, now, lease, limit)
+}
+
+func (s webhookStorage) MarkDeliverySucceeded(ctx context.Context, id int64) error {
+	defer s.observe("MarkDeliverySucceeded", time.Now())
+	return s.next.MarkDeliverySucceeded(ctx, id)
+}
+
+func (s webhookStorage) MarkDeliveryFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error {
+	defer s.observe("MarkDeliveryFailed", time.Now())
+	return s.next.MarkDeliveryFailed(ctx, id, lastError, nextAttemptAt)
+}
+
+func (s webhookStorage) GetDeliveries(ctx context.Context, status *string, limit *int32, offset *int32) ([]models.WebhookDelivery, error) {
+	defer s.observe("GetDeliveries", time.Now())
+	return s.next.GetDeliveries(ctx, status, limit, offset)
+}
+
+type idempotencyStorage struct {
+	next storage.IdempotencyStorage
+	observer
+}
+
+func (s idempotencyStorage) ReserveKey(ctx context.Context, scope, key, requestHash string, expiresAt time.Time) (models.IdempotencyKey, bool, error) {
+	defer s.observe("ReserveKey", time.Now())
+	return s.next.ReserveKey(ctx, scope, key, requestHash, expiresAt)
+}
+
+func (s idempotencyStorage) CompleteKey(ctx context.Context, scope, key string, resourceID int64, expiresAt time.Time) error {
+	defer s.observe("CompleteKey", time.Now())
+	return s.next.CompleteKey(ctx, scope, key, resourceID, expiresAt)
+}
+
+func (s idempotencyStorage) ReleaseKey(ctx context.Context, scope, key string) error {
+	defer s.observe("ReleaseKey", time.Now())
+	return s.next.ReleaseKey(ctx, scope, key)
+}
+
+func (s idempotencyStorage) DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error) {
+	defer s.observe("DeleteExpiredKeys", time.Now())
+	return s.next.DeleteExpiredKeys(ctx, now)
+}
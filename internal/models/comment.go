@@ -6,6 +6,12 @@ type Comment struct {
 	ID        int64     `json:"id"`
 	PostID    int64     `json:"post_id"`
 	ParentID  *int64    `json:"parent_id,omitempty"`
+	ReplyToID *int64    `json:"reply_to_id,omitempty"`
+	Depth     int       `json:"depth"`
+	Author    string    `json:"author,omitempty"`
 	Content   string    `json:"content"`
+	Status    string    `json:"status"`
+	Pinned    bool      `json:"pinned"`
 	CreatedAt time.Time `json:"created_at"`
+	Version   int64     `json:"version"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type CommentLock struct {
+	CommentID int64      `json:"comment_id"`
+	Reason    string     `json:"reason"`
+	LockedBy  string     `json:"locked_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
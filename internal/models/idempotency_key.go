@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a create request made with a client supplied key.
+// ResourceID stays zero while the original request is still in flight.
+type IdempotencyKey struct {
+	Scope       string    `json:"scope"`
+	Key         string    `json:"key"`
+	RequestHash string    `json:"request_hash"`
+	ResourceID  int64     `json:"resource_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type Notification struct {
+	ID        int64      `json:"id"`
+	Recipient string     `json:"recipient"`
+	Type      string     `json:"type"`
+	PostID    int64      `json:"post_id"`
+	CommentID int64      `json:"comment_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
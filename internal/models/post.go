@@ -3,9 +3,13 @@ package models
 import "time"
 
 type Post struct {
-	ID               int64     `json:"id"`
-	Title            string    `json:"title"`
-	Content          string    `json:"content"`
-	CommentsDisabled bool      `json:"comments_disabled"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID               int64      `json:"id"`
+	Title            string     `json:"title"`
+	Content          string     `json:"content"`
+	Author           string     `json:"author,omitempty"`
+	Status           string     `json:"status"`
+	PublishAt        *time.Time `json:"publish_at,omitempty"`
+	CommentsDisabled bool       `json:"comments_disabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Version          int64      `json:"version"`
 }
@@ -0,0 +1,10 @@
+package models
+
+// ThreadComment is a comment listed by GetThread. Depth counts the levels
+// below the top of the listing and Path holds the IDs from there down to the
+// comment itself.
+type ThreadComment struct {
+	Comment Comment `json:"comment"`
+	Depth   int     `json:"depth"`
+	Path    []int64 `json:"path"`
+}
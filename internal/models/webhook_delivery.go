@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	Event         string     `json:"event"`
+	Endpoint      string     `json:"endpoint"`
+	Payload       []byte     `json:"payload"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"sync"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+const subscriberBuffer = 16
+
+// Broker fans out newly created notifications to the subscriptions of their
+// recipients. Slow subscribers drop notifications rather than block
+// publishers.
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan models.Notification]struct{}
+	closed      bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[string]map[chan models.Notification]struct{}),
+	}
+}
+
+func (b *Broker) Subscribe(recipient string) (<-chan models.Notification, func()) {
+	ch := make(chan models.Notification, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subscribers[recipient] == nil {
+		b.subscribers[recipient] = make(map[chan models.Notification]struct{})
+	}
+	b.subscribers[recipient][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			// Close already closed the channel.
+			if _, ok := b.subscribers[recipient][ch]; !ok {
+				return
+			}
+
+			delete(b.subscribers[recipient], ch)
+			if len(b.subscribers[recipient]) == 0 {
+				delete(b.subscribers, recipient)
+			}
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+func (b *Broker) Publish(notification models.Notification) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[notification.Recipient] {
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription by closing its channel. Later subscriptions
+// end immediately.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for recipient, channels := range b.subscribers {
+		for ch := range channels {
+			close(ch)
+		}
+		delete(b.subscribers, recipient)
+	}
+}
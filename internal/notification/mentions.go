@@ -0,0 +1,26 @@
+package notification
+
+import "regexp"
+
+var mentionRegexp = regexp.MustCompile(`(?:^|[^\w@.])@(\w{1,64})`)
+
+// ParseMentions returns the unique usernames mentioned as @username in
+// content, in order of first appearance.
+func ParseMentions(content string) []string {
+	matches := mentionRegexp.FindAllStringSubmatch(content, -1)
+
+	seen := make(map[string]struct{}, len(matches))
+	mentions := make([]string, 0, len(matches))
+
+	for _, match := range matches {
+		username := match[1]
+		if _, ok := seen[username]; ok {
+			continue
+		}
+
+		seen[username] = struct{}{}
+		mentions = append(mentions, username)
+	}
+
+	return mentions
+}
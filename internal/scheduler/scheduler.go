@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// Publisher periodically publishes scheduled posts whose publish time has
+// come.
+type Publisher struct {
+	posts    storage.PostStorage
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func NewPublisher(posts storage.PostStorage, interval time.Duration, logger *slog.Logger) *Publisher {
+	return &Publisher{
+		posts:    posts,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run publishes due posts every interval until ctx is cancelled.
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.publishDue(ctx, time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.publishDue(ctx, now)
+		}
+	}
+}
+
+func (p *Publisher) publishDue(ctx context.Context, now time.Time) {
+	published, err := p.posts.PublishDuePosts(ctx, now)
+
+	if err != nil {
+		p.logger.Error("failed to publish scheduled posts", slog.String("err", err.Error()))
+		return
+	}
+
+	for _, id := range published {
+		p.logger.Info("scheduled post published", slog.Int64("id", id))
+	}
+}
@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/Pacahar/graphql-comments/internal/storage/storagetest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStorage(t *testing.T) (cached, backend *storage.Storage, requests func(kind, result string) float64) {
+	backend, err := memory.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lru := NewLRU(100, time.Minute)
+	cached = NewStorage(backend, Caches{Posts: lru, Comments: lru, Pages: lru})
+
+	counter := cached.Collector.(storage.Collectors)[1].(*prometheus.CounterVec)
+
+	return cached, backend, func(kind, result string) float64 {
+		return testutil.ToFloat64(counter.WithLabelValues(kind, result))
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *storage.Storage {
+		st, _, _ := newTestStorage(t)
+		return st
+	})
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(2, time.Minute)
+
+	lru.Set(ctx, "a", []byte("1"))
+	lru.Set(ctx, "b", []byte("2"))
+	lru.Get(ctx, "a")
+	lru.Set(ctx, "c", []byte("3"))
+
+	_, ok := lru.Get(ctx, "b")
+	assert.False(t, ok)
+
+	value, ok := lru.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 2, lru.Len())
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	lru := NewLRU(10, time.Minute)
+	lru.now = func() time.Time { return now }
+
+	lru.Set(ctx, "a", []byte("1"))
+
+	now = now.Add(59 * time.Second)
+	_, ok := lru.Get(ctx, "a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = lru.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestPostsAreCachedUntilWritten(t *testing.T) {
+	ctx := context.Background()
+	st, _, requests := newTestStorage(t)
+
+	id, err := st.Post.CreatePost(ctx, "Title", "Content", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	_, err = st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	_, err = st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(1), requests("post", "miss"))
+	assert.Equal(t, float64(1), requests("post", "hit"))
+
+	assert.NoError(t, st.Post.UpdatePost(ctx, id, "Updated", "Content", nil))
+
+	post, err := st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", post.Title)
+	assert.Equal(t, float64(2), requests("post", "miss"))
+
+	assert.NoError(t, st.Post.DeletePost(ctx, id, nil))
+
+	_, err = st.Post.GetPostByID(ctx, id)
+	assert.True(t, errors.Is(err, storageErrors.ErrPostNotFound))
+}
+
+func TestCommentsAreInvalidated(t *testing.T) {
+	ctx := context.Background()
+	st, _, requests := newTestStorage(t)
+
+	postID, err := st.Post.CreatePost(ctx, "Title", "Content", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	rootID, err := st.Comment.CreateComment(ctx, "Root", "alice", postID, nil, nil)
+	assert.NoError(t, err)
+
+	replyID, err := st.Comment.CreateComment(ctx, "Reply", "bob", postID, &rootID, &rootID)
+	assert.NoError(t, err)
+
+	_, err = st.Comment.GetCommentByID(ctx, replyID)
+	assert.NoError(t, err)
+	_, err = st.Comment.GetCommentByID(ctx, replyID)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), requests("comment", "hit"))
+
+	_, err = st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	_, err = st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), requests("page", "hit"))
+
+	assert.NoError(t, st.Comment.UpdateComment(ctx, rootID, "Edited", nil))
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	for _, comment := range comments {
+		if comment.ID == rootID {
+			assert.Equal(t, "Edited", comment.Content)
+		}
+	}
+	assert.Equal(t, float64(2), requests("page", "miss"))
+
+	// Deleting the root cascades to the reply, which was cached.
+	assert.NoError(t, st.Comment.DeleteComment(ctx, rootID, nil))
+
+	_, err = st.Comment.GetCommentByID(ctx, replyID)
+	assert.True(t, errors.Is(err, storageErrors.ErrCommentNotFound))
+}
+
+func TestDeletePostInvalidatesComments(t *testing.T) {
+	ctx := context.Background()
+	st, _, _ := newTestStorage(t)
+
+	postID, err := st.Post.CreatePost(ctx, "Title", "Content", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	commentID, err := st.Comment.CreateComment(ctx, "Comment", "alice", postID, nil, nil)
+	assert.NoError(t, err)
+
+	_, err = st.Comment.GetCommentByID(ctx, commentID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		if err := tx.Comment.DeleteCommentsByPostID(ctx, postID); err != nil {
+			return err
+		}
+		return tx.Post.DeletePost(ctx, postID, nil)
+	}))
+
+	_, err = st.Comment.GetCommentByID(ctx, commentID)
+	assert.True(t, errors.Is(err, storageErrors.ErrCommentNotFound))
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func TestTransactionsBypassCache(t *testing.T) {
+	ctx := context.Background()
+	st, backend, _ := newTestStorage(t)
+
+	id, err := st.Post.CreatePost(ctx, "Title", "Content", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	_, err = st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+
+	// A write the decorator does not see stays hidden until the TTL runs
+	// out, but transactions read through to the backend.
+	assert.NoError(t, backend.Post.UpdatePost(ctx, id, "Updated", "Content", nil))
+
+	post, err := st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Title", post.Title)
+
+	assert.NoError(t, st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		post, err := tx.Post.GetPostByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Updated", post.Title)
+
+		return tx.Post.UpdatePost(ctx, id, "In tx", "Content", nil)
+	}))
+
+	post, err = st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "In tx", post.Title)
+}
+
+// laggingPosts serves the posts in stale, as a replica behind the primary
+// would, to reads not made with storage.WithPrimary.
+type laggingPosts struct {
+	storage.PostStorage
+	stale map[int64]models.Post
+}
+
+func (p laggingPosts) GetPostByID(ctx context.Context, id int64) (models.Post, error) {
+	if post, ok := p.stale[id]; ok && !storage.PrimaryFromContext(ctx) {
+		return post, nil
+	}
+
+	return p.PostStorage.GetPostByID(ctx, id)
+}
+
+type pinnedClients map[string]bool
+
+func (p pinnedClients) Pinned(ctx context.Context) bool {
+	client, _ := storage.ClientFromContext(ctx)
+	return p[client]
+}
+
+func TestReplicaReadsAreNotCached(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := memory.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := laggingPosts{PostStorage: backend.Post, stale: map[int64]models.Post{}}
+	pinned := pinnedClients{}
+	backend.Post = posts
+	backend.Replicas = pinned
+
+	st := NewStorage(backend, Caches{Posts: NewLRU(100, time.Minute)})
+
+	id, err := st.Post.CreatePost(ctx, "Title", "Content", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	posts.stale[id], err = backend.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+
+	alice := storage.WithClient(ctx, "alice")
+	bob := storage.WithClient(ctx, "bob")
+
+	assert.NoError(t, st.Post.UpdatePost(alice, id, "Updated", "Content", nil))
+	pinned["alice"] = true
+
+	post, err := st.Post.GetPostByID(bob, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Title", post.Title)
+
+	// The stale read was not cached under the new generation, so the writer
+	// and version checks see the write.
+	post, err = st.Post.GetPostByID(alice, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", post.Title)
+
+	post, err = st.Post.GetPostByID(storage.WithPrimary(bob), id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", post.Title)
+
+	// Values read from the primary are cached for the other clients.
+	post, err = st.Post.GetPostByID(bob, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", post.Title)
+
+	// Pinned clients skip the cache.
+	assert.NoError(t, backend.Post.UpdatePost(ctx, id, "Behind the cache", "Content", nil))
+
+	post, err = st.Post.GetPostByID(alice, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Behind the cache", post.Title)
+}
@@ -0,0 +1,487 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Caches holds the cache of each kind of entry. Keys never collide across
+// kinds, so one Cache may serve all three.
+type Caches struct {
+	Posts    Cache
+	Comments Cache
+	// Pages holds the root comment pages of GetCommentsByPostID.
+	Pages Cache
+}
+
+// NewStorage returns st with GetPostByID, GetCommentByID and
+// GetCommentsByPostID served from caches. Reads inside transactions bypass
+// the cache.
+//
+// Entries are never deleted. Each is stamped with generations, tokens kept
+// in the cache next to it, and every write replaces the generations it
+// affects, which invalidates exactly the entries stamped with the old
+// ones. Generations are read before the backend, so a read racing a write
+// cannot cache the old value under the new generation. Writes made in a
+// transaction invalidate once it is over.
+//
+// Over replicas, only values read from the primary are cached, as a lagging
+// replica could serve the old value after the write. Reads made with
+// storage.WithPrimary or by a client pinned to the primary skip the cache.
+func NewStorage(st *storage.Storage, caches Caches) *storage.Storage {
+	c := &cacheSet{
+		Caches:   caches,
+		replicas: st.Replicas,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "storage_cache_requests_total",
+			Help: "Cached storage reads by entry kind and result.",
+		}, []string{"cache", "result"}),
+	}
+
+	cached := *st
+	cached.Post = postStorage{next: st.Post, c: c}
+	cached.Comment = commentStorage{next: st.Comment, c: c}
+	cached.Collector = storage.Collectors{st.Collector, c.requests}
+
+	if st.Transactor != nil {
+		cached.Transactor = transactor{next: st.Transactor, c: c}
+	}
+
+	return &cached
+}
+
+type cacheSet struct {
+	Caches
+	// replicas is nil when the backend reads from the primary only.
+	replicas storage.Replicas
+	requests *prometheus.CounterVec
+}
+
+// route returns the context to read the backend with, whether a cached
+// value may be served and whether the value read may be cached. Reads that
+// must see the primary skip the cache and go to the primary, so their
+// values are the only ones cached over replicas.
+func (c *cacheSet) route(ctx context.Context) (next context.Context, cached, keep bool) {
+	if storage.PrimaryFromContext(ctx) || c.replicas != nil && c.replicas.Pinned(ctx) {
+		return storage.WithPrimary(ctx), false, true
+	}
+
+	return ctx, true, c.replicas == nil
+}
+
+type entry[T any] struct {
+	Stamp string `json:"stamp"`
+	Value T      `json:"value"`
+}
+
+func lookup[T any](ctx context.Context, cache Cache, key string) (entry[T], bool) {
+	var e entry[T]
+
+	data, ok := cache.Get(ctx, key)
+	if !ok || json.Unmarshal(data, &e) != nil {
+		return entry[T]{}, false
+	}
+
+	return e, true
+}
+
+func store[T any](ctx context.Context, cache Cache, key, stamp string, value T) {
+	data, err := json.Marshal(entry[T]{Stamp: stamp, Value: value})
+	if err != nil {
+		return
+	}
+
+	cache.Set(ctx, key, data)
+}
+
+// generation returns the current generation of key, starting a new one
+// when there is none, for instance because it was evicted.
+func generation(ctx context.Context, cache Cache, key string) string {
+	if gen, ok := cache.Get(ctx, key); ok {
+		return string(gen)
+	}
+
+	return bump(ctx, cache, key)
+}
+
+func bump(ctx context.Context, cache Cache, key string) string {
+	gen := strconv.FormatUint(rand.Uint64(), 36)
+	cache.Set(ctx, key, []byte(gen))
+
+	return gen
+}
+
+func (c *cacheSet) count(kind string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	c.requests.WithLabelValues(kind, result).Inc()
+}
+
+// The generations of a post: its own, the one of its comments, replaced
+// when deletes cascade to them, and the one of its comment pages, replaced
+// by every comment write.
+func postGeneration(id int64) string    { return fmt.Sprintf("gen:post:%d", id) }
+func threadGeneration(id int64) string  { return fmt.Sprintf("gen:thread:%d", id) }
+func pagesGeneration(id int64) string   { return fmt.Sprintf("gen:pages:%d", id) }
+func commentGeneration(id int64) string { return fmt.Sprintf("gen:comment:%d", id) }
+func postKey(id int64) string           { return fmt.Sprintf("post:%d", id) }
+func commentKey(id int64) string        { return fmt.Sprintf("comment:%d", id) }
+func pageKey(postID int64, gen string, limit, offset *int32) string {
+	key := fmt.Sprintf("page:%d:%s", postID, gen)
+
+	// The backends page only when both are given.
+	if limit != nil && offset != nil {
+		key += fmt.Sprintf(":%d:%d", *limit, *offset)
+	}
+
+	return key
+}
+
+// invalidator runs invalidations right away, or collects them until the
+// transaction is over.
+type invalidator struct {
+	pending *[]func()
+}
+
+func (i invalidator) invalidate(fn func()) {
+	if i.pending != nil {
+		*i.pending = append(*i.pending, fn)
+		return
+	}
+
+	fn()
+}
+
+func (i invalidator) inTx() bool {
+	return i.pending != nil
+}
+
+type transactor struct {
+	next storage.Transactor
+	c    *cacheSet
+}
+
+func (t transactor) WithTx(ctx context.Context, fn func(ctx context.Context, tx storage.Storage) error) error {
+	var pending []func()
+
+	defer func() {
+		for _, invalidate := range pending {
+			invalidate()
+		}
+	}()
+
+	return t.next.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		bound := invalidator{pending: &pending}
+
+		tx.Post = postStorage{next: tx.Post, c: t.c, invalidator: bound}
+		tx.Comment = commentStorage{next: tx.Comment, c: t.c, invalidator: bound}
+
+		return fn(ctx, tx)
+	})
+}
+
+type postStorage struct {
+	next storage.PostStorage
+	c    *cacheSet
+	invalidator
+}
+
+func (s postStorage) CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error) {
+	return s.next.CreatePost(ctx, title, content, author, status, commentsDisabled)
+}
+
+func (s postStorage) ImportPost(ctx context.Context, post models.Post) (int64, error) {
+	return s.next.ImportPost(ctx, post)
+}
+
+func (s postStorage) GetPostByID(ctx context.Context, id int64) (models.Post, error) {
+	if s.inTx() {
+		return s.next.GetPostByID(ctx, id)
+	}
+
+	next, cached, keep := s.c.route(ctx)
+	gen := generation(ctx, s.c.Posts, postGeneration(id))
+
+	if cached {
+		if e, ok := lookup[models.Post](ctx, s.c.Posts, postKey(id)); ok && e.Stamp == gen {
+			s.c.count("post", true)
+			return e.Value, nil
+		}
+	}
+
+	s.c.count("post", false)
+
+	post, err := s.next.GetPostByID(next, id)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	if keep {
+		store(ctx, s.c.Posts, postKey(id), gen, post)
+	}
+
+	return post, nil
+}
+
+func (s postStorage) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	return s.next.GetAllPosts(ctx)
+}
+
+func (s postStorage) UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error {
+	err := s.next.UpdatePost(ctx, id, title, content, expectedVersion)
+	s.invalidatePost(ctx, id)
+
+	return err
+}
+
+func (s postStorage) SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error {
+	err := s.next.SetCommentsDisabled(ctx, id, disabled, expectedVersion)
+	s.invalidatePost(ctx, id)
+
+	return err
+}
+
+func (s postStorage) SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error {
+	err := s.next.SetPostStatus(ctx, id, status, publishAt, expectedVersion)
+	s.invalidatePost(ctx, id)
+
+	return err
+}
+
+func (s postStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]int64, error) {
+	published, err := s.next.PublishDuePosts(ctx, now)
+
+	for _, id := range published {
+		s.invalidatePost(ctx, id)
+	}
+
+	return published, err
+}
+
+// DeletePost also invalidates the post's comments, which backends with
+// foreign keys delete along with it.
+func (s postStorage) DeletePost(ctx context.Context, id int64, expectedVersion *int64) error {
+	err := s.next.DeletePost(ctx, id, expectedVersion)
+
+	s.invalidatePost(ctx, id)
+	s.invalidate(func() {
+		bump(ctx, s.c.Comments, threadGeneration(id))
+		bump(ctx, s.c.Pages, pagesGeneration(id))
+	})
+
+	return err
+}
+
+// invalidatePost runs even when the write failed, as a failure may come
+// after the backend applied it.
+func (s postStorage) invalidatePost(ctx context.Context, id int64) {
+	s.invalidate(func() {
+		bump(ctx, s.c.Posts, postGeneration(id))
+	})
+}
+
+type commentStorage struct {
+	next storage.CommentStorage
+	c    *cacheSet
+	invalidator
+}
+
+func (s commentStorage) CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error) {
+	id, err := s.next.CreateComment(ctx, content, author, postID, parentID, replyToID)
+	s.invalidatePages(ctx, postID)
+
+	return id, err
+}
+
+func (s commentStorage) ImportComment(ctx context.Context, comment models.Comment) (int64, error) {
+	id, err := s.next.ImportComment(ctx, comment)
+	s.invalidatePages(ctx, comment.PostID)
+
+	return id, err
+}
+
+// GetCommentByID stamps the comment with its own generation and the one of
+// its post's comments. The latter is only known after reading the comment,
+// so a delete cascading from an ancestor while the comment is read can
+// leave it cached until the TTL runs out.
+func (s commentStorage) GetCommentByID(ctx context.Context, id int64) (models.Comment, error) {
+	if s.inTx() {
+		return s.next.GetCommentByID(ctx, id)
+	}
+
+	next, cached, keep := s.c.route(ctx)
+	gen := generation(ctx, s.c.Comments, commentGeneration(id))
+
+	if cached {
+		if e, ok := lookup[models.Comment](ctx, s.c.Comments, commentKey(id)); ok && e.Stamp == gen+"/"+generation(ctx, s.c.Comments, threadGeneration(e.Value.PostID)) {
+			s.c.count("comment", true)
+			return e.Value, nil
+		}
+	}
+
+	s.c.count("comment", false)
+
+	comment, err := s.next.GetCommentByID(next, id)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	if keep {
+		stamp := gen + "/" + generation(ctx, s.c.Comments, threadGeneration(comment.PostID))
+		store(ctx, s.c.Comments, commentKey(id), stamp, comment)
+	}
+
+	return comment, nil
+}
+
+func (s commentStorage) GetCommentsByParentID(ctx context.Context, parentID int64) ([]models.Comment, error) {
+	return s.next.GetCommentsByParentID(ctx, parentID)
+}
+
+func (s commentStorage) GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) ([]models.Comment, error) {
+	if s.inTx() {
+		return s.next.GetCommentsByPostID(ctx, postID, limit, offset)
+	}
+
+	next, cached, keep := s.c.route(ctx)
+	key := pageKey(postID, generation(ctx, s.c.Pages, pagesGeneration(postID)), limit, offset)
+
+	if cached {
+		if e, ok := lookup[[]models.Comment](ctx, s.c.Pages, key); ok {
+			s.c.count("page", true)
+			return e.Value, nil
+		}
+	}
+
+	s.c.count("page", false)
+
+	comments, err := s.next.GetCommentsByPostID(next, postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if keep {
+		store(ctx, s.c.Pages, key, "", comments)
+	}
+
+	return comments, nil
+}
+
+func (s commentStorage) GetThread(ctx context.Context, postID int64, rootID *int64, maxDepth, limit int) ([]models.ThreadComment, error) {
+	return s.next.GetThread(ctx, postID, rootID, maxDepth, limit)
+}
+
+func (s commentStorage) UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error {
+	postID, found := s.postOf(ctx, id)
+
+	err := s.next.UpdateComment(ctx, id, content, expectedVersion)
+
+	s.invalidateComment(ctx, id)
+	if found {
+		s.invalidatePages(ctx, postID)
+	}
+
+	return err
+}
+
+// DeleteComment invalidates every comment of the post, as the delete
+// cascades to replies and clears replyToID of others.
+func (s commentStorage) DeleteComment(ctx context.Context, id int64, expectedVersion *int64) error {
+	postID, found := s.postOf(ctx, id)
+
+	err := s.next.DeleteComment(ctx, id, expectedVersion)
+
+	s.invalidateComment(ctx, id)
+	if found {
+		s.invalidateThread(ctx, postID)
+	}
+
+	return err
+}
+
+func (s commentStorage) DeleteCommentsByPostID(ctx context.Context, postID int64) error {
+	err := s.next.DeleteCommentsByPostID(ctx, postID)
+	s.invalidateThread(ctx, postID)
+
+	return err
+}
+
+func (s commentStorage) LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error {
+	return s.next.LockComment(ctx, id, reason, lockedBy, expiresAt)
+}
+
+func (s commentStorage) UnlockComment(ctx context.Context, id int64) error {
+	return s.next.UnlockComment(ctx, id)
+}
+
+func (s commentStorage) FindActiveLock(ctx context.Context, id int64, now time.Time) (models.CommentLock, error) {
+	return s.next.FindActiveLock(ctx, id, now)
+}
+
+func (s commentStorage) PinComment(ctx context.Context, postID, commentID int64, maxPins int) error {
+	err := s.next.PinComment(ctx, postID, commentID, maxPins)
+
+	s.invalidateComment(ctx, commentID)
+	s.invalidatePages(ctx, postID)
+
+	return err
+}
+
+func (s commentStorage) UnpinComment(ctx context.Context, postID, commentID int64) error {
+	err := s.next.UnpinComment(ctx, postID, commentID)
+
+	s.invalidateComment(ctx, commentID)
+	s.invalidatePages(ctx, postID)
+
+	return err
+}
+
+func (s commentStorage) GetPinnedComments(ctx context.Context, postID int64) ([]models.Comment, error) {
+	return s.next.GetPinnedComments(ctx, postID)
+}
+
+// postOf finds the post of a comment about to be written. A comment never
+// moves, so any cached copy will do. Otherwise the comment is read from the
+// primary, where a comment created a moment ago is sure to be found.
+func (s commentStorage) postOf(ctx context.Context, id int64) (int64, bool) {
+	if e, ok := lookup[models.Comment](ctx, s.c.Comments, commentKey(id)); ok {
+		return e.Value.PostID, true
+	}
+
+	comment, err := s.next.GetCommentByID(storage.WithPrimary(ctx), id)
+	if err != nil {
+		return 0, false
+	}
+
+	return comment.PostID, true
+}
+
+func (s commentStorage) invalidateComment(ctx context.Context, id int64) {
+	s.invalidate(func() {
+		bump(ctx, s.c.Comments, commentGeneration(id))
+	})
+}
+
+func (s commentStorage) invalidatePages(ctx context.Context, postID int64) {
+	s.invalidate(func() {
+		bump(ctx, s.c.Pages, pagesGeneration(postID))
+	})
+}
+
+func (s commentStorage) invalidateThread(ctx context.Context, postID int64) {
+	s.invalidate(func() {
+		bump(ctx, s.c.Comments, threadGeneration(postID))
+		bump(ctx, s.c.Pages, pagesGeneration(postID))
+	})
+}
@@ -0,0 +1,33 @@
+package storage
+
+import "context"
+
+type (
+	clientKey  struct{}
+	primaryKey struct{}
+)
+
+// WithClient tells storages who the calls made with ctx are for. Backends
+// reading from replicas use it to show clients their own writes.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func ClientFromContext(ctx context.Context) (string, bool) {
+	client, ok := ctx.Value(clientKey{}).(string)
+	return client, ok && client != ""
+}
+
+// WithPrimary makes backends with read replicas serve the reads made with
+// ctx from the primary, skipping caches. Mutations use it for authorization
+// checks and reads of versions, so that a lagging replica can not grant
+// access that was revoked or hand out a version that was replaced. Queries
+// read from replicas and rely on WithClient to see their own writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func PrimaryFromContext(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
@@ -6,5 +6,11 @@ var (
 	ErrUnknownTypeOfStorage = errors.New("unknown type of storage")
 	ErrCommentNotFound      = errors.New("comment not found")
 	ErrPostNotFound         = errors.New("post not found")
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrLockNotFound         = errors.New("lock not found")
+	ErrPinNotFound          = errors.New("pin not found")
+	ErrPinLimitReached      = errors.New("pin limit reached")
+	ErrVersionConflict      = errors.New("version conflict")
+	ErrSchemaBehind         = errors.New("database schema is behind")
 	ErrCanNotCreate         = errors.New("can not create object")
 )
@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var entitiesDesc = prometheus.NewDesc(
+	"memory_storage_entities",
+	"Number of entities held by the memory storage.",
+	[]string{"entity"}, nil,
+)
+
+// collector reports how many entities each memory storage holds, as that is
+// what the process memory grows with.
+type collector struct {
+	posts         *PostMemoryStorage
+	comments      *CommentMemoryStorage
+	notifications *NotificationMemoryStorage
+	webhooks      *WebhookMemoryStorage
+	idempotency   *IdempotencyMemoryStorage
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- entitiesDesc
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	entity := func(name string, count int) {
+		ch <- prometheus.MustNewConstMetric(entitiesDesc, prometheus.GaugeValue, float64(count), name)
+	}
+
+	c.posts.mu.RLock()
+	entity("posts", len(c.posts.posts))
+	c.posts.mu.RUnlock()
+
+	c.comments.mu.RLock()
+	entity("comments", len(c.comments.comments))
+	entity("comment_locks", len(c.comments.locks))
+	c.comments.mu.RUnlock()
+
+	c.notifications.mu.RLock()
+	entity("notifications", len(c.notifications.notifications))
+	c.notifications.mu.RUnlock()
+
+	c.webhooks.mu.RLock()
+	entity("webhook_deliveries", len(c.webhooks.deliveries))
+	c.webhooks.mu.RUnlock()
+
+	c.idempotency.mu.Lock()
+	entity("idempotency_keys", len(c.idempotency.keys))
+	c.idempotency.mu.Unlock()
+}
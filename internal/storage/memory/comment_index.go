@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+// commentKey orders comments by creation time, oldest first, breaking ties
+// by ID.
+type commentKey struct {
+	createdAt time.Time
+	id        int64
+}
+
+func keyOf(comment models.Comment) commentKey {
+	return commentKey{createdAt: comment.CreatedAt.Round(0), id: comment.ID}
+}
+
+func compareKeys(a, b commentKey) int {
+	if c := a.createdAt.Compare(b.createdAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.id, b.id)
+}
+
+// commentIndex keeps the root comments of every post and the replies to
+// every comment in creation order, and the comments that reply to each
+// comment, so that reads and deletes never scan the whole store.
+type commentIndex struct {
+	roots    map[int64][]commentKey
+	children map[int64][]commentKey
+	replyTos map[int64]map[int64]struct{}
+}
+
+func newCommentIndex() commentIndex {
+	return commentIndex{
+		roots:    make(map[int64][]commentKey),
+		children: make(map[int64][]commentKey),
+		replyTos: make(map[int64]map[int64]struct{}),
+	}
+}
+
+func (ix commentIndex) add(comment models.Comment) {
+	if comment.ParentID == nil {
+		ix.roots[comment.PostID] = insertKey(ix.roots[comment.PostID], keyOf(comment))
+	} else {
+		ix.children[*comment.ParentID] = insertKey(ix.children[*comment.ParentID], keyOf(comment))
+	}
+
+	if comment.ReplyToID != nil {
+		ids, exists := ix.replyTos[*comment.ReplyToID]
+		if !exists {
+			ids = make(map[int64]struct{})
+			ix.replyTos[*comment.ReplyToID] = ids
+		}
+		ids[comment.ID] = struct{}{}
+	}
+}
+
+func (ix commentIndex) remove(comment models.Comment) {
+	if comment.ParentID == nil {
+		removeKey(ix.roots, comment.PostID, keyOf(comment))
+	} else {
+		removeKey(ix.children, *comment.ParentID, keyOf(comment))
+	}
+
+	if comment.ReplyToID != nil {
+		ids := ix.replyTos[*comment.ReplyToID]
+		delete(ids, comment.ID)
+
+		if len(ids) == 0 {
+			delete(ix.replyTos, *comment.ReplyToID)
+		}
+	}
+}
+
+// indexed reports whether a and b sit at the same place in the index.
+func indexed(a, b models.Comment) bool {
+	return a.PostID == b.PostID &&
+		equalIDs(a.ParentID, b.ParentID) &&
+		equalIDs(a.ReplyToID, b.ReplyToID) &&
+		compareKeys(keyOf(a), keyOf(b)) == 0
+}
+
+func equalIDs(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// insertKey adds key to the ordered keys. New comments sort last, so this
+// is usually an append.
+func insertKey(keys []commentKey, key commentKey) []commentKey {
+	if n := len(keys); n == 0 || compareKeys(keys[n-1], key) < 0 {
+		return append(keys, key)
+	}
+
+	i, found := slices.BinarySearchFunc(keys, key, compareKeys)
+	if found {
+		return keys
+	}
+
+	return slices.Insert(keys, i, key)
+}
+
+func removeKey(lists map[int64][]commentKey, owner int64, key commentKey) {
+	keys := lists[owner]
+
+	i, found := slices.BinarySearchFunc(keys, key, compareKeys)
+	if !found {
+		return
+	}
+
+	if len(keys) == 1 {
+		delete(lists, owner)
+		return
+	}
+
+	lists[owner] = slices.Delete(keys, i, i+1)
+}
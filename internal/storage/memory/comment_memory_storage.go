@@ -2,49 +2,130 @@ package memory
 
 import (
 	"context"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/constants"
 	"github.com/Pacahar/graphql-comments/internal/models"
 	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
 )
 
 type CommentMemoryStorage struct {
 	mu        sync.RWMutex
+	gate      *sync.RWMutex
+	journal   *journal
+	wal       *wal
+	pending   pending
 	comments  map[int64]models.Comment
+	index     commentIndex
+	locks     map[int64]models.CommentLock
+	pins      map[int64][]int64
 	currentID int64
 }
 
 func NewCommentMemoryStorage() (*CommentMemoryStorage, error) {
 	return &CommentMemoryStorage{
 		mu:        sync.RWMutex{},
+		gate:      &sync.RWMutex{},
 		comments:  make(map[int64]models.Comment),
+		index:     newCommentIndex(),
+		locks:     make(map[int64]models.CommentLock),
+		pins:      make(map[int64][]int64),
 		currentID: 1,
 	}, nil
 }
 
-func (cs *CommentMemoryStorage) CreateComment(ctx context.Context, content string, postID int64, parentID *int64) (int64, error) {
+func (cs *CommentMemoryStorage) CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error) {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.createComment(ctx, content, author, postID, parentID, replyToID)
+}
+
+func (cs *CommentMemoryStorage) createComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
 	id := cs.currentID
 
-	var safeParentID *int64
+	depth := 0
 	if parentID != nil {
-		val := *parentID
-		safeParentID = &val
+		parent, exists := cs.comments[*parentID]
+		if !exists || parent.PostID != postID {
+			return 0, storageErrors.ErrCommentNotFound
+		}
+		depth = parent.Depth + 1
 	}
 
-	cs.comments[id] = models.Comment{
+	cs.saveComment(id)
+	cs.put(copyComment(models.Comment{
 		ID:        id,
 		PostID:    postID,
-		ParentID:  safeParentID,
+		ParentID:  parentID,
+		ReplyToID: replyToID,
+		Depth:     depth,
+		Author:    author,
 		Content:   content,
+		Status:    constants.CommentVisible,
 		CreatedAt: time.Now(),
+		Version:   1,
+	}))
+
+	cs.currentID++
+
+	if err := cs.persist(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (cs *CommentMemoryStorage) ImportComment(ctx context.Context, comment models.Comment) (int64, error) {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.importComment(ctx, comment)
+}
+
+func (cs *CommentMemoryStorage) importComment(ctx context.Context, comment models.Comment) (int64, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	id := cs.currentID
+
+	comment = copyComment(comment)
+	comment.ID = id
+	comment.Depth = 0
+	comment.Pinned = false
+	comment.Version = 1
+
+	if comment.Status == "" {
+		comment.Status = constants.CommentVisible
 	}
 
+	if comment.ParentID != nil {
+		parent, exists := cs.comments[*comment.ParentID]
+		if !exists || parent.PostID != comment.PostID {
+			return 0, storageErrors.ErrCommentNotFound
+		}
+		comment.Depth = parent.Depth + 1
+	}
+
+	if comment.ReplyToID != nil {
+		if _, exists := cs.comments[*comment.ReplyToID]; !exists {
+			return 0, storageErrors.ErrCommentNotFound
+		}
+	}
+
+	cs.saveComment(id)
+	cs.put(comment)
 	cs.currentID++
 
+	if err := cs.persist(); err != nil {
+		return 0, err
+	}
+
 	return id, nil
 }
 
@@ -57,121 +138,523 @@ func (cs *CommentMemoryStorage) GetCommentByID(ctx context.Context, id int64) (m
 		return models.Comment{}, storageErrors.ErrCommentNotFound
 	}
 
-	var parentID *int64
-	if comment.ParentID != nil {
-		val := *comment.ParentID
-		parentID = &val
-	}
-
-	copy := models.Comment{
-		ID:        comment.ID,
-		PostID:    comment.PostID,
-		ParentID:  parentID,
-		Content:   comment.Content,
-		CreatedAt: comment.CreatedAt,
-	}
-
-	return copy, nil
+	return copyComment(comment), nil
 }
 
 func (cs *CommentMemoryStorage) GetCommentsByParentID(ctx context.Context, ParentID int64) ([]models.Comment, error) {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	filtered := make([]models.Comment, 0)
+	return cs.load(cs.index.children[ParentID]), nil
+}
 
-	for _, comment := range cs.comments {
-		if comment.ParentID != nil && *comment.ParentID == ParentID {
-			var parentID *int64
-			if comment.ParentID != nil {
-				val := *comment.ParentID
-				parentID = &val
-			}
+func (cs *CommentMemoryStorage) GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) ([]models.Comment, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 
-			copy := models.Comment{
-				ID:        comment.ID,
-				PostID:    comment.PostID,
-				ParentID:  parentID,
-				Content:   comment.Content,
-				CreatedAt: comment.CreatedAt,
-			}
+	keys := cs.index.roots[postID]
+
+	// Like the SQL backends, only page when both limit and offset are given.
+	if limit != nil && offset != nil {
+		start := min(max(int(*offset), 0), len(keys))
 
-			filtered = append(filtered, copy)
+		end := len(keys)
+		if *limit >= 0 {
+			end = min(start+int(*limit), end)
 		}
+
+		keys = keys[start:end]
 	}
 
-	return filtered, nil
+	return cs.load(keys), nil
 }
 
-func (cs *CommentMemoryStorage) GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) ([]models.Comment, error) {
+func (cs *CommentMemoryStorage) GetThread(ctx context.Context, postID int64, rootID *int64, maxDepth, limit int) ([]models.ThreadComment, error) {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	filtered := make([]models.Comment, 0)
+	top := cs.index.roots[postID]
+	if rootID != nil {
+		root, exists := cs.comments[*rootID]
+		if !exists || root.PostID != postID {
+			return nil, storageErrors.ErrCommentNotFound
+		}
+		top = []commentKey{keyOf(root)}
+	}
 
-	for _, comment := range cs.comments {
-		if comment.PostID == postID {
-			var parentID *int64
-			if comment.ParentID != nil {
-				val := *comment.ParentID
-				parentID = &val
-			}
+	level := make([]models.ThreadComment, 0, len(top))
+	for _, key := range top {
+		level = append(level, cs.threadComment(key.id, 0, nil))
+	}
 
-			copy := models.Comment{
-				ID:        comment.ID,
-				PostID:    comment.PostID,
-				ParentID:  parentID,
-				Content:   comment.Content,
-				CreatedAt: comment.CreatedAt,
-			}
+	thread := make([]models.ThreadComment, 0, len(level))
 
-			filtered = append(filtered, copy)
+	// Walk the thread a level at a time, sorting each level by creation
+	// time like the SQL backends do.
+	for depth := 0; len(level) > 0; depth++ {
+		if limit != 0 && len(thread)+len(level) >= limit {
+			return append(thread, level[:limit-len(thread)]...), nil
 		}
+
+		thread = append(thread, level...)
+
+		if maxDepth != 0 && depth >= maxDepth {
+			break
+		}
+
+		var next []models.ThreadComment
+		for _, parent := range level {
+			for _, key := range cs.index.children[parent.Comment.ID] {
+				next = append(next, cs.threadComment(key.id, depth+1, parent.Path))
+			}
+		}
+
+		slices.SortFunc(next, func(a, b models.ThreadComment) int {
+			return compareKeys(keyOf(a.Comment), keyOf(b.Comment))
+		})
+
+		level = next
 	}
 
-	start := int32(0)
-	if offset != nil && *offset >= 0 && *offset < int32(len(filtered)) {
-		start = *offset
+	return thread, nil
+}
+
+// threadComment lists the comment at depth below the comment at the end of
+// parentPath. The caller must hold the lock.
+func (cs *CommentMemoryStorage) threadComment(id int64, depth int, parentPath []int64) models.ThreadComment {
+	return models.ThreadComment{
+		Comment: copyComment(cs.comments[id]),
+		Depth:   depth,
+		Path:    append(slices.Clip(parentPath), id),
 	}
+}
+
+func (cs *CommentMemoryStorage) UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
 
-	end := int32(len(filtered))
-	if limit != nil && (start+*limit) < end {
-		end = start + *limit
+	return cs.updateComment(ctx, id, content, expectedVersion)
+}
+
+func (cs *CommentMemoryStorage) updateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	comment, err := cs.commentForUpdate(id, expectedVersion)
+	if err != nil {
+		return err
 	}
 
-	return filtered[start:end], nil
+	cs.saveComment(id)
+	comment.Content = content
+	comment.Version++
+	cs.put(comment)
+
+	return cs.persist()
 }
 
-func (cs *CommentMemoryStorage) DeleteComment(ctx context.Context, id int64) error {
+func (cs *CommentMemoryStorage) DeleteComment(ctx context.Context, id int64, expectedVersion *int64) error {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.deleteComment(ctx, id, expectedVersion)
+}
+
+func (cs *CommentMemoryStorage) deleteComment(ctx context.Context, id int64, expectedVersion *int64) error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
-	var deleteRecursive func(commentID int64)
+	if expectedVersion != nil {
+		if _, err := cs.commentForUpdate(id, expectedVersion); err != nil {
+			return err
+		}
+	}
+
+	if _, exists := cs.comments[id]; !exists {
+		return nil
+	}
 
-	deleteRecursive = func(commentID int64) {
-		for childID, comment := range cs.comments {
+	thread := cs.descendants([]int64{id})
 
-			if comment.ParentID != nil && *comment.ParentID == commentID {
-				deleteRecursive(childID)
-			}
+	for _, commentID := range thread {
+		cs.saveComment(commentID)
+		if comment := cs.comments[commentID]; comment.Pinned {
+			cs.savePins(comment.PostID)
+			cs.removePin(comment.PostID, commentID)
 		}
-		delete(cs.comments, commentID)
+		cs.drop(commentID)
+		delete(cs.locks, commentID)
 	}
 
-	deleteRecursive(id)
+	// Replies that survive in other threads no longer point anywhere.
+	for _, commentID := range thread {
+		for replyID := range cs.index.replyTos[commentID] {
+			cs.saveComment(replyID)
+			reply := cs.comments[replyID]
+			reply.ReplyToID = nil
+			cs.put(reply)
+		}
+	}
 
-	return nil
+	return cs.persist()
 }
 
 func (cs *CommentMemoryStorage) DeleteCommentsByPostID(ctx context.Context, postID int64) error {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.deleteCommentsByPostID(ctx, postID)
+}
+
+func (cs *CommentMemoryStorage) deleteCommentsByPostID(ctx context.Context, postID int64) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	roots := make([]int64, 0, len(cs.index.roots[postID]))
+	for _, key := range cs.index.roots[postID] {
+		roots = append(roots, key.id)
+	}
+
+	for _, id := range cs.descendants(roots) {
+		cs.saveComment(id)
+		cs.drop(id)
+		delete(cs.locks, id)
+	}
+
+	cs.savePins(postID)
+	delete(cs.pins, postID)
+
+	return cs.persist()
+}
+
+func (cs *CommentMemoryStorage) LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.lockComment(ctx, id, reason, lockedBy, expiresAt)
+}
+
+func (cs *CommentMemoryStorage) lockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, exists := cs.comments[id]; !exists {
+		return storageErrors.ErrCommentNotFound
+	}
+
+	var safeExpiresAt *time.Time
+	if expiresAt != nil {
+		val := *expiresAt
+		safeExpiresAt = &val
+	}
+
+	cs.saveComment(id)
+	cs.locks[id] = models.CommentLock{
+		CommentID: id,
+		Reason:    reason,
+		LockedBy:  lockedBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: safeExpiresAt,
+	}
+
+	return cs.persist()
+}
+
+func (cs *CommentMemoryStorage) UnlockComment(ctx context.Context, id int64) error {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.unlockComment(ctx, id)
+}
+
+func (cs *CommentMemoryStorage) unlockComment(ctx context.Context, id int64) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, exists := cs.locks[id]; !exists {
+		return storageErrors.ErrLockNotFound
+	}
+
+	cs.saveComment(id)
+	delete(cs.locks, id)
+
+	return cs.persist()
+}
+
+func (cs *CommentMemoryStorage) FindActiveLock(ctx context.Context, id int64, now time.Time) (models.CommentLock, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	for {
+		if lock, exists := cs.locks[id]; exists && (lock.ExpiresAt == nil || lock.ExpiresAt.After(now)) {
+			return copyLock(lock), nil
+		}
+
+		comment, exists := cs.comments[id]
+		if !exists || comment.ParentID == nil {
+			return models.CommentLock{}, storageErrors.ErrLockNotFound
+		}
+
+		id = *comment.ParentID
+	}
+}
+
+func (cs *CommentMemoryStorage) PinComment(ctx context.Context, postID, commentID int64, maxPins int) error {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.pinComment(ctx, postID, commentID, maxPins)
+}
+
+func (cs *CommentMemoryStorage) pinComment(ctx context.Context, postID, commentID int64, maxPins int) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	comment, exists := cs.comments[commentID]
+	if !exists || comment.PostID != postID {
+		return storageErrors.ErrCommentNotFound
+	}
+
+	if comment.Pinned {
+		return nil
+	}
+
+	if maxPins > 0 && len(cs.pins[postID]) >= maxPins {
+		return storageErrors.ErrPinLimitReached
+	}
+
+	cs.saveComment(commentID)
+	cs.savePins(postID)
+	cs.pins[postID] = append(cs.pins[postID], commentID)
+	comment.Pinned = true
+	cs.put(comment)
+
+	return cs.persist()
+}
+
+func (cs *CommentMemoryStorage) UnpinComment(ctx context.Context, postID, commentID int64) error {
+	cs.gate.RLock()
+	defer cs.gate.RUnlock()
+
+	return cs.unpinComment(ctx, postID, commentID)
+}
+
+func (cs *CommentMemoryStorage) unpinComment(ctx context.Context, postID, commentID int64) error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
-	for id, comment := range cs.comments {
-		if comment.PostID == postID {
-			delete(cs.comments, id)
+	comment, exists := cs.comments[commentID]
+	if !exists || comment.PostID != postID || !comment.Pinned {
+		return storageErrors.ErrPinNotFound
+	}
+
+	cs.saveComment(commentID)
+	cs.savePins(postID)
+	cs.removePin(postID, commentID)
+	comment.Pinned = false
+	cs.put(comment)
+
+	return cs.persist()
+}
+
+func (cs *CommentMemoryStorage) GetPinnedComments(ctx context.Context, postID int64) ([]models.Comment, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	pinned := make([]models.Comment, 0, len(cs.pins[postID]))
+
+	for _, id := range cs.pins[postID] {
+		pinned = append(pinned, copyComment(cs.comments[id]))
+	}
+
+	return pinned, nil
+}
+
+// put stores the comment and keeps the index in step. The caller must hold
+// the write lock.
+func (cs *CommentMemoryStorage) put(comment models.Comment) {
+	old, exists := cs.comments[comment.ID]
+	cs.comments[comment.ID] = comment
+
+	if exists && indexed(old, comment) {
+		return
+	}
+
+	if exists {
+		cs.index.remove(old)
+	}
+	cs.index.add(comment)
+}
+
+// drop deletes the comment and its index entries, see put.
+func (cs *CommentMemoryStorage) drop(id int64) {
+	if comment, exists := cs.comments[id]; exists {
+		cs.index.remove(comment)
+		delete(cs.comments, id)
+	}
+}
+
+// load returns copies of the comments behind keys.
+func (cs *CommentMemoryStorage) load(keys []commentKey) []models.Comment {
+	comments := make([]models.Comment, 0, len(keys))
+
+	for _, key := range keys {
+		comments = append(comments, copyComment(cs.comments[key.id]))
+	}
+
+	return comments
+}
+
+// descendants returns ids and every reply below them, breadth first. The
+// caller must hold the lock.
+func (cs *CommentMemoryStorage) descendants(ids []int64) []int64 {
+	for i := 0; i < len(ids); i++ {
+		for _, key := range cs.index.children[ids[i]] {
+			ids = append(ids, key.id)
 		}
 	}
 
-	return nil
+	return ids
+}
+
+func (cs *CommentMemoryStorage) removePin(postID, commentID int64) {
+	pins := cs.pins[postID]
+
+	for i, id := range pins {
+		if id == commentID {
+			cs.pins[postID] = append(pins[:i:i], pins[i+1:]...)
+			break
+		}
+	}
+
+	if len(cs.pins[postID]) == 0 {
+		delete(cs.pins, postID)
+	}
+}
+
+// saveComment journals the current state of the comment, its lock and the
+// ID counter so that a rolled back transaction can restore them, and queues
+// the comment for the write-ahead log. The caller must hold the write lock.
+func (cs *CommentMemoryStorage) saveComment(id int64) {
+	if cs.journal == nil && cs.wal == nil {
+		return
+	}
+
+	comment, commentExists := cs.comments[id]
+	lock, lockExists := cs.locks[id]
+	currentID := cs.currentID
+
+	undo := func() {
+		if commentExists {
+			cs.put(comment)
+		} else {
+			cs.drop(id)
+		}
+
+		if lockExists {
+			cs.locks[id] = lock
+		} else {
+			delete(cs.locks, id)
+		}
+
+		cs.currentID = currentID
+	}
+
+	if cs.journal != nil {
+		cs.journal.add(undo)
+	}
+
+	if cs.wal != nil {
+		cs.pending.add(func() walRecord { return cs.record(id) }, undo)
+	}
+}
+
+// savePins journals the pins of the post, see saveComment.
+func (cs *CommentMemoryStorage) savePins(postID int64) {
+	if cs.journal == nil && cs.wal == nil {
+		return
+	}
+
+	pins, exists := cs.pins[postID]
+	pins = append([]int64(nil), pins...)
+
+	undo := func() {
+		if exists {
+			cs.pins[postID] = pins
+		} else {
+			delete(cs.pins, postID)
+		}
+	}
+
+	if cs.journal != nil {
+		cs.journal.add(undo)
+	}
+
+	if cs.wal != nil {
+		cs.pending.add(func() walRecord { return cs.pinsRecord(postID) }, undo)
+	}
+}
+
+// persist logs the comments and pins saved by the running write. The
+// caller must hold the write lock.
+func (cs *CommentMemoryStorage) persist() error {
+	return cs.pending.flush(cs.wal, cs.journal)
+}
+
+func (cs *CommentMemoryStorage) record(id int64) walRecord {
+	record := &commentRecord{ID: id, NextID: cs.currentID}
+
+	if comment, exists := cs.comments[id]; exists {
+		comment = copyComment(comment)
+		record.Comment = &comment
+	}
+
+	if lock, exists := cs.locks[id]; exists {
+		lock = copyLock(lock)
+		record.Lock = &lock
+	}
+
+	return walRecord{Comment: record}
+}
+
+func (cs *CommentMemoryStorage) pinsRecord(postID int64) walRecord {
+	return walRecord{Pins: &pinsRecord{PostID: postID, Pins: append([]int64(nil), cs.pins[postID]...)}}
+}
+
+// commentForUpdate returns the comment if its version matches
+// expectedVersion. The caller must hold the write lock.
+func (cs *CommentMemoryStorage) commentForUpdate(id int64, expectedVersion *int64) (models.Comment, error) {
+	comment, exists := cs.comments[id]
+	if !exists {
+		return models.Comment{}, storageErrors.ErrCommentNotFound
+	}
+
+	if expectedVersion != nil && *expectedVersion != comment.Version {
+		return models.Comment{}, storageErrors.ErrVersionConflict
+	}
+
+	return comment, nil
+}
+
+func copyComment(comment models.Comment) models.Comment {
+	if comment.ParentID != nil {
+		val := *comment.ParentID
+		comment.ParentID = &val
+	}
+
+	if comment.ReplyToID != nil {
+		val := *comment.ReplyToID
+		comment.ReplyToID = &val
+	}
+
+	return comment
+}
+
+func copyLock(lock models.CommentLock) models.CommentLock {
+	if lock.ExpiresAt != nil {
+		val := *lock.ExpiresAt
+		lock.ExpiresAt = &val
+	}
+
+	return lock
 }
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+type idempotencyScopeKey struct {
+	scope string
+	key   string
+}
+
+type IdempotencyMemoryStorage struct {
+	mu   sync.Mutex
+	keys map[idempotencyScopeKey]models.IdempotencyKey
+}
+
+func NewIdempotencyMemoryStorage() (*IdempotencyMemoryStorage, error) {
+	return &IdempotencyMemoryStorage{
+		mu:   sync.Mutex{},
+		keys: make(map[idempotencyScopeKey]models.IdempotencyKey),
+	}, nil
+}
+
+func (is *IdempotencyMemoryStorage) ReserveKey(ctx context.Context, scope, key, requestHash string, expiresAt time.Time) (models.IdempotencyKey, bool, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	now := time.Now()
+	id := idempotencyScopeKey{scope: scope, key: key}
+
+	if existing, exists := is.keys[id]; exists && existing.ExpiresAt.After(now) {
+		return existing, false, nil
+	}
+
+	record := models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+	}
+
+	is.keys[id] = record
+
+	return record, true, nil
+}
+
+func (is *IdempotencyMemoryStorage) CompleteKey(ctx context.Context, scope, key string, resourceID int64, expiresAt time.Time) error {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	id := idempotencyScopeKey{scope: scope, key: key}
+
+	if record, exists := is.keys[id]; exists {
+		record.ResourceID = resourceID
+		record.ExpiresAt = expiresAt
+		is.keys[id] = record
+	}
+
+	return nil
+}
+
+func (is *IdempotencyMemoryStorage) ReleaseKey(ctx context.Context, scope, key string) error {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	id := idempotencyScopeKey{scope: scope, key: key}
+
+	if record, exists := is.keys[id]; exists && record.ResourceID == 0 {
+		delete(is.keys, id)
+	}
+
+	return nil
+}
+
+func (is *IdempotencyMemoryStorage) DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	var deleted int64
+
+	for id, record := range is.keys {
+		if !record.ExpiresAt.After(now) {
+			delete(is.keys, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -21,8 +21,42 @@ func NewMemoryStorage() (*storage.Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &storage.Storage{
-		Post:    postStorage,
-		Comment: commentStorage,
-	}, nil
+	notificationStorage, err := NewNotificationMemoryStorage()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	webhookStorage, err := NewWebhookMemoryStorage()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	idempotencyStorage, err := NewIdempotencyMemoryStorage()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	postStorage.comments = commentStorage
+	postStorage.notifications = notificationStorage
+
+	st := &storage.Storage{
+		Post:         postStorage,
+		Comment:      commentStorage,
+		Notification: notificationStorage,
+		Webhook:      webhookStorage,
+		Idempotency:  idempotencyStorage,
+	}
+	st.Transactor = newTransactor(postStorage, commentStorage, *st)
+	st.Collector = &collector{
+		posts:         postStorage,
+		comments:      commentStorage,
+		notifications: notificationStorage,
+		webhooks:      webhookStorage,
+		idempotency:   idempotencyStorage,
+	}
+
+	return st, nil
 }
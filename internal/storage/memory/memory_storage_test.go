@@ -2,19 +2,52 @@ package memory
 
 import (
 	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/storage"
 	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/Pacahar/graphql-comments/internal/storage/storagetest"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *storage.Storage {
+		st, err := NewMemoryStorage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return st
+	})
+}
+
+func TestPersistentConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *storage.Storage {
+		st, err := NewPersistentMemoryStorage(t.TempDir(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { st.Close() })
+
+		return st
+	})
+}
+
 func TestCreateAndGetPost(t *testing.T) {
 	ctx := context.Background()
 
 	storage, err := NewPostMemoryStorage()
 	assert.NoError(t, err)
 
-	id, err := storage.CreatePost(ctx, "Title 1", "Content 1", false)
+	id, err := storage.CreatePost(ctx, "Title 1", "Content 1", "", constants.PostPublished, false)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), id)
 
@@ -31,10 +64,10 @@ func TestGetAllPosts(t *testing.T) {
 	storage, err := NewPostMemoryStorage()
 	assert.NoError(t, err)
 
-	_, err = storage.CreatePost(ctx, "Post1", "Content1", false)
+	_, err = storage.CreatePost(ctx, "Post1", "Content1", "", constants.PostPublished, false)
 	assert.NoError(t, err)
 
-	_, err = storage.CreatePost(ctx, "Post2", "Content2", true)
+	_, err = storage.CreatePost(ctx, "Post2", "Content2", "", constants.PostPublished, true)
 	assert.NoError(t, err)
 
 	posts, err := storage.GetAllPosts(ctx)
@@ -47,16 +80,43 @@ func TestDeletePost(t *testing.T) {
 	storage, err := NewPostMemoryStorage()
 	assert.NoError(t, err)
 
-	id, err := storage.CreatePost(ctx, "Title", "Content", false)
+	id, err := storage.CreatePost(ctx, "Title", "Content", "", constants.PostPublished, false)
 	assert.NoError(t, err)
 
-	err = storage.DeletePost(ctx, id)
+	err = storage.DeletePost(ctx, id, nil)
 	assert.NoError(t, err)
 
 	_, err = storage.GetPostByID(ctx, id)
 	assert.ErrorIs(t, err, storageErrors.ErrPostNotFound)
 }
 
+func TestPublishDuePosts(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewPostMemoryStorage()
+	assert.NoError(t, err)
+
+	dueID, _ := storage.CreatePost(ctx, "Due", "Content", "", constants.PostDraft, false)
+	laterID, _ := storage.CreatePost(ctx, "Later", "Content", "", constants.PostDraft, false)
+
+	now := time.Now()
+	due := now.Add(time.Minute)
+	later := now.Add(time.Hour)
+
+	assert.NoError(t, storage.SetPostStatus(ctx, dueID, constants.PostScheduled, &due, nil))
+	assert.NoError(t, storage.SetPostStatus(ctx, laterID, constants.PostScheduled, &later, nil))
+	assert.ErrorIs(t, storage.SetPostStatus(ctx, 42, constants.PostScheduled, &due, nil), storageErrors.ErrPostNotFound)
+
+	published, err := storage.PublishDuePosts(ctx, due)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{dueID}, published)
+
+	post, _ := storage.GetPostByID(ctx, dueID)
+	assert.Equal(t, constants.PostPublished, post.Status)
+
+	post, _ = storage.GetPostByID(ctx, laterID)
+	assert.Equal(t, constants.PostScheduled, post.Status)
+}
+
 func TestCreateAndGetComment(t *testing.T) {
 	ctx := context.Background()
 
@@ -64,7 +124,7 @@ func TestCreateAndGetComment(t *testing.T) {
 	assert.NoError(t, err)
 
 	postID := int64(1)
-	commentID, err := storage.CreateComment(ctx, "Comment 1", postID, nil)
+	commentID, err := storage.CreateComment(ctx, "Comment 1", "", postID, nil, nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), commentID)
@@ -84,10 +144,10 @@ func TestGetCommentsByPostID(t *testing.T) {
 
 	postID := int64(1)
 
-	_, err = storage.CreateComment(ctx, "Comment 1", postID, nil)
+	_, err = storage.CreateComment(ctx, "Comment 1", "", postID, nil, nil)
 	assert.NoError(t, err)
 
-	_, err = storage.CreateComment(ctx, "Comment 2", postID, nil)
+	_, err = storage.CreateComment(ctx, "Comment 2", "", postID, nil, nil)
 	assert.NoError(t, err)
 
 	comments, err := storage.GetCommentsByPostID(ctx, postID, nil, nil)
@@ -102,10 +162,10 @@ func TestGetCommentsByParentID(t *testing.T) {
 	assert.NoError(t, err)
 
 	postID := int64(1)
-	parentID, err := storage.CreateComment(ctx, "Parent", postID, nil)
+	parentID, err := storage.CreateComment(ctx, "Parent", "", postID, nil, nil)
 	assert.NoError(t, err)
 
-	childID, err := storage.CreateComment(ctx, "Child", postID, &parentID)
+	childID, err := storage.CreateComment(ctx, "Child", "", postID, &parentID, nil)
 	assert.NoError(t, err)
 
 	children, err := storage.GetCommentsByParentID(ctx, parentID)
@@ -113,6 +173,11 @@ func TestGetCommentsByParentID(t *testing.T) {
 
 	assert.Len(t, children, 1)
 	assert.Equal(t, childID, children[0].ID)
+	assert.Equal(t, 1, children[0].Depth)
+
+	missingParentID := int64(42)
+	_, err = storage.CreateComment(ctx, "Orphan", "", postID, &missingParentID, nil)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
 }
 
 func TestDeleteComment(t *testing.T) {
@@ -121,13 +186,13 @@ func TestDeleteComment(t *testing.T) {
 	assert.NoError(t, err)
 
 	postID := int64(1)
-	parentID, err := storage.CreateComment(ctx, "Parent", postID, nil)
+	parentID, err := storage.CreateComment(ctx, "Parent", "", postID, nil, nil)
 	assert.NoError(t, err)
 
-	_, err = storage.CreateComment(ctx, "Child", postID, &parentID)
+	_, err = storage.CreateComment(ctx, "Child", "", postID, &parentID, nil)
 	assert.NoError(t, err)
 
-	err = storage.DeleteComment(ctx, parentID)
+	err = storage.DeleteComment(ctx, parentID, nil)
 	assert.NoError(t, err)
 
 	_, err = storage.GetCommentByID(ctx, parentID)
@@ -142,13 +207,13 @@ func TestDeleteCommentsByPostID(t *testing.T) {
 	CommentStorage, _ := NewCommentMemoryStorage()
 	PostStorage, _ := NewPostMemoryStorage()
 
-	postID, err := PostStorage.CreatePost(ctx, "Post", "Content", false)
+	postID, err := PostStorage.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
 	assert.NoError(t, err)
 
-	_, err = CommentStorage.CreateComment(ctx, "Comment 1", postID, nil)
+	_, err = CommentStorage.CreateComment(ctx, "Comment 1", "", postID, nil, nil)
 	assert.NoError(t, err)
 
-	_, err = CommentStorage.CreateComment(ctx, "Comment 2", postID, nil)
+	_, err = CommentStorage.CreateComment(ctx, "Comment 2", "", postID, nil, nil)
 	assert.NoError(t, err)
 
 	err = CommentStorage.DeleteCommentsByPostID(ctx, postID)
@@ -157,3 +222,512 @@ func TestDeleteCommentsByPostID(t *testing.T) {
 	comments, _ := CommentStorage.GetCommentsByPostID(ctx, postID, nil, nil)
 	assert.Len(t, comments, 0)
 }
+
+func TestNotificationsByRecipient(t *testing.T) {
+	ctx := context.Background()
+
+	storage, err := NewNotificationMemoryStorage()
+	assert.NoError(t, err)
+
+	first, err := storage.CreateNotification(ctx, "alice", "REPLY", 1, 1)
+	assert.NoError(t, err)
+
+	second, err := storage.CreateNotification(ctx, "alice", "MENTION", 1, 2)
+	assert.NoError(t, err)
+
+	_, err = storage.CreateNotification(ctx, "bob", "MENTION", 1, 2)
+	assert.NoError(t, err)
+
+	notifications, err := storage.GetNotificationsByRecipient(ctx, "alice", false, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 2)
+	assert.Equal(t, second, notifications[0].ID)
+
+	limit := int32(1)
+	page, err := storage.GetNotificationsByRecipient(ctx, "alice", false, &limit, &second)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, first, page[0].ID)
+
+	marked, err := storage.MarkNotificationsRead(ctx, "alice", []int64{first})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), marked)
+
+	unread, err := storage.GetNotificationsByRecipient(ctx, "alice", true, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, unread, 1)
+	assert.Equal(t, second, unread[0].ID)
+
+	marked, err = storage.MarkNotificationsRead(ctx, "alice", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), marked)
+}
+
+func TestFindActiveLock(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewCommentMemoryStorage()
+	assert.NoError(t, err)
+
+	postID := int64(1)
+	rootID, _ := storage.CreateComment(ctx, "Root", "", postID, nil, nil)
+	childID, _ := storage.CreateComment(ctx, "Child", "", postID, &rootID, nil)
+
+	_, err = storage.FindActiveLock(ctx, childID, time.Now())
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+
+	expiresAt := time.Now().Add(time.Hour)
+	err = storage.LockComment(ctx, rootID, "cooling off", "mod", &expiresAt)
+	assert.NoError(t, err)
+
+	lock, err := storage.FindActiveLock(ctx, childID, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, rootID, lock.CommentID)
+	assert.Equal(t, "cooling off", lock.Reason)
+
+	_, err = storage.FindActiveLock(ctx, childID, expiresAt.Add(time.Second))
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+
+	err = storage.LockComment(ctx, 42, "missing", "mod", nil)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	err = storage.DeleteComment(ctx, rootID, nil)
+	assert.NoError(t, err)
+
+	err = storage.UnlockComment(ctx, rootID)
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+}
+
+func TestPinComments(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewCommentMemoryStorage()
+	assert.NoError(t, err)
+
+	postID := int64(1)
+	firstID, _ := storage.CreateComment(ctx, "First", "", postID, nil, nil)
+	secondID, _ := storage.CreateComment(ctx, "Second", "", postID, nil, nil)
+	otherPostCommentID, _ := storage.CreateComment(ctx, "Other", "", 2, nil, nil)
+
+	assert.NoError(t, storage.PinComment(ctx, postID, secondID, 2))
+	assert.NoError(t, storage.PinComment(ctx, postID, firstID, 2))
+	assert.NoError(t, storage.PinComment(ctx, postID, firstID, 2))
+	assert.ErrorIs(t, storage.PinComment(ctx, postID, otherPostCommentID, 2), storageErrors.ErrCommentNotFound)
+
+	pinned, err := storage.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Len(t, pinned, 2)
+	assert.Equal(t, secondID, pinned[0].ID)
+	assert.Equal(t, firstID, pinned[1].ID)
+	assert.True(t, pinned[0].Pinned)
+
+	thirdID, _ := storage.CreateComment(ctx, "Third", "", postID, nil, nil)
+	assert.ErrorIs(t, storage.PinComment(ctx, postID, thirdID, 2), storageErrors.ErrPinLimitReached)
+
+	assert.NoError(t, storage.DeleteComment(ctx, secondID, nil))
+	assert.ErrorIs(t, storage.UnpinComment(ctx, postID, secondID), storageErrors.ErrPinNotFound)
+
+	pinned, err = storage.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Len(t, pinned, 1)
+	assert.Equal(t, firstID, pinned[0].ID)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewIdempotencyMemoryStorage()
+	assert.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	record, created, err := storage.ReserveKey(ctx, "alice", "key", "hash", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Zero(t, record.ResourceID)
+
+	assert.NoError(t, storage.CompleteKey(ctx, "alice", "key", 42, expiresAt))
+	assert.NoError(t, storage.ReleaseKey(ctx, "alice", "key"))
+
+	record, created, err = storage.ReserveKey(ctx, "alice", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "hash", record.RequestHash)
+	assert.Equal(t, int64(42), record.ResourceID)
+
+	_, created, err = storage.ReserveKey(ctx, "bob", "key", "hash", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	deleted, err := storage.DeleteExpiredKeys(ctx, expiresAt)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	_, created, err = storage.ReserveKey(ctx, "alice", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+}
+
+func TestPostVersionCompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewPostMemoryStorage()
+	assert.NoError(t, err)
+
+	id, _ := storage.CreatePost(ctx, "Title", "Content", "", constants.PostPublished, false)
+
+	stale := int64(1)
+	assert.NoError(t, storage.UpdatePost(ctx, id, "Edited", "Content", &stale))
+	assert.ErrorIs(t, storage.UpdatePost(ctx, id, "Stale", "Content", &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, storage.SetCommentsDisabled(ctx, id, true, &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, storage.DeletePost(ctx, id, &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, storage.UpdatePost(ctx, 42, "Missing", "Content", nil), storageErrors.ErrPostNotFound)
+
+	assert.NoError(t, storage.SetCommentsDisabled(ctx, id, true, nil))
+
+	post, err := storage.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited", post.Title)
+	assert.Equal(t, int64(3), post.Version)
+
+	current := post.Version
+	assert.NoError(t, storage.DeletePost(ctx, id, &current))
+}
+
+func TestWithTxRollback(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewMemoryStorage()
+	assert.NoError(t, err)
+
+	postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
+	commentID, _ := st.Comment.CreateComment(ctx, "Comment", "", postID, nil, nil)
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, commentID, 3))
+
+	failure := errors.New("failure")
+
+	err = st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		assert.NoError(t, tx.Post.UpdatePost(ctx, postID, "Edited", "Content", nil))
+		_, err := tx.Comment.CreateComment(ctx, "Reply", "", postID, &commentID, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Comment.DeleteCommentsByPostID(ctx, postID))
+		assert.NoError(t, tx.Post.DeletePost(ctx, postID, nil))
+
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	post, err := st.Post.GetPostByID(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Post", post.Title)
+	assert.Equal(t, int64(1), post.Version)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Len(t, pinned, 1)
+
+	replies, err := st.Comment.GetCommentsByParentID(ctx, commentID)
+	assert.NoError(t, err)
+	assert.Empty(t, replies)
+
+	// The rolled back reply's ID is handed out again.
+	replyID, err := st.Comment.CreateComment(ctx, "Reply", "", postID, &commentID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, commentID+1, replyID)
+
+	err = st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		return tx.Comment.DeleteComment(ctx, replyID, nil)
+	})
+	assert.NoError(t, err)
+
+	_, err = st.Comment.GetCommentByID(ctx, replyID)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+}
+
+func TestPersistentStorageSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	st, err := NewPersistentMemoryStorage(dir, 0)
+	assert.NoError(t, err)
+
+	postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "alice", constants.PostPublished, false)
+	rootID, _ := st.Comment.CreateComment(ctx, "Root", "alice", postID, nil, nil)
+	replyID, _ := st.Comment.CreateComment(ctx, "Reply", "bob", postID, &rootID, &rootID)
+	assert.NoError(t, st.Comment.LockComment(ctx, rootID, "heated", "moderator", nil))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, replyID, 3))
+	assert.NoError(t, st.Post.UpdatePost(ctx, postID, "Edited", "Content", nil))
+
+	deletedID, _ := st.Post.CreatePost(ctx, "Deleted", "Content", "", constants.PostPublished, false)
+	assert.NoError(t, st.Post.DeletePost(ctx, deletedID, nil))
+
+	err = st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		_, err := tx.Comment.CreateComment(ctx, "Rolled back", "", postID, nil, nil)
+		assert.NoError(t, err)
+		return errors.New("failure")
+	})
+	assert.Error(t, err)
+
+	assert.NoError(t, st.Close())
+
+	st, err = NewPersistentMemoryStorage(dir, 0)
+	assert.NoError(t, err)
+
+	post, err := st.Post.GetPostByID(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited", post.Title)
+	assert.Equal(t, int64(2), post.Version)
+
+	_, err = st.Post.GetPostByID(ctx, deletedID)
+	assert.ErrorIs(t, err, storageErrors.ErrPostNotFound)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Len(t, pinned, 1)
+	assert.Equal(t, replyID, pinned[0].ID)
+
+	lock, err := st.Comment.FindActiveLock(ctx, replyID, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, rootID, lock.CommentID)
+
+	roots, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, roots, 1) {
+		assert.Equal(t, rootID, roots[0].ID)
+	}
+
+	replies, err := st.Comment.GetCommentsByParentID(ctx, rootID)
+	assert.NoError(t, err)
+	if assert.Len(t, replies, 1) {
+		assert.Equal(t, replyID, replies[0].ID)
+	}
+
+	// The ID of the deleted post is not handed out again.
+	newPostID, _ := st.Post.CreatePost(ctx, "New", "Content", "", constants.PostPublished, false)
+	assert.Equal(t, deletedID+1, newPostID)
+
+	newCommentID, _ := st.Comment.CreateComment(ctx, "New", "", postID, nil, nil)
+	assert.Equal(t, replyID+1, newCommentID)
+
+	assert.NoError(t, st.Close())
+}
+
+func TestPersistentStorageReplaysLogAfterCrash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	st, err := NewPersistentMemoryStorage(dir, 0)
+	assert.NoError(t, err)
+
+	postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
+	commentID, _ := st.Comment.CreateComment(ctx, "Comment", "", postID, nil, nil)
+
+	err = st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		if err := tx.Comment.DeleteCommentsByPostID(ctx, postID); err != nil {
+			return err
+		}
+		return tx.Post.DeletePost(ctx, postID, nil)
+	})
+	assert.NoError(t, err)
+
+	survivorID, _ := st.Post.CreatePost(ctx, "Survivor", "Content", "", constants.PostPublished, false)
+
+	// Crash without Close: no snapshot, and a write torn halfway.
+	log, err := os.OpenFile(filepath.Join(dir, walFile), os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = log.WriteString(`[{"post":{"id":`)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Close())
+
+	st, err = NewPersistentMemoryStorage(dir, 0)
+	assert.NoError(t, err)
+	defer st.Close()
+
+	_, err = st.Post.GetPostByID(ctx, postID)
+	assert.ErrorIs(t, err, storageErrors.ErrPostNotFound)
+
+	_, err = st.Comment.GetCommentByID(ctx, commentID)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+
+	post, err := st.Post.GetPostByID(ctx, survivorID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Survivor", post.Title)
+
+	newPostID, _ := st.Post.CreatePost(ctx, "New", "Content", "", constants.PostPublished, false)
+	assert.Equal(t, survivorID+1, newPostID)
+}
+
+func TestWALRefusesAppendsAfterFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _, _, err := openWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	record := []walRecord{{Pins: &pinsRecord{PostID: 1}}}
+	assert.NoError(t, w.append(record))
+
+	// A read-only handle fails the write and cutting it off, like a bad
+	// disk would.
+	readOnly, err := os.Open(filepath.Join(dir, walFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := w.file
+	w.file = readOnly
+	assert.Error(t, w.append(record))
+	readOnly.Close()
+
+	w.file = file
+	assert.Error(t, w.append(record))
+
+	_, err = file.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+
+	entries, _, err := readWAL(file)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Compaction empties the log, after which it takes appends again.
+	assert.NoError(t, w.compact(snapshot{}))
+	assert.NoError(t, w.append(record))
+}
+
+// The benchmarks share a store of a million comments: benchPosts posts
+// with benchRoots threads of a root and benchReplies replies each.
+const (
+	benchPosts   = 100
+	benchRoots   = 1000
+	benchReplies = 9
+)
+
+var benchStorage = sync.OnceValue(func() *storage.Storage {
+	ctx := context.Background()
+
+	st, err := NewMemoryStorage()
+	if err != nil {
+		panic(err)
+	}
+
+	for range benchPosts {
+		postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "alice", constants.PostPublished, false)
+
+		for range benchRoots {
+			rootID, _ := st.Comment.CreateComment(ctx, "Root", "alice", postID, nil, nil)
+
+			for range benchReplies {
+				st.Comment.CreateComment(ctx, "Reply", "bob", postID, &rootID, nil)
+			}
+		}
+	}
+
+	return st
+})
+
+// benchComments is the number of comments in benchStorage.
+const benchComments = benchPosts * benchRoots * (1 + benchReplies)
+
+func BenchmarkGetCommentByID(b *testing.B) {
+	st := benchStorage()
+	ctx := context.Background()
+
+	b.ResetTimer()
+
+	for i := range b.N {
+		if _, err := st.Comment.GetCommentByID(ctx, int64(i%benchComments)+1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetCommentsByParentID(b *testing.B) {
+	st := benchStorage()
+	ctx := context.Background()
+
+	b.ResetTimer()
+
+	for i := range b.N {
+		// Every root is followed by its replies.
+		rootID := int64(i%(benchPosts*benchRoots))*(1+benchReplies) + 1
+
+		replies, err := st.Comment.GetCommentsByParentID(ctx, rootID)
+		if err != nil || len(replies) != benchReplies {
+			b.Fatalf("got %d replies: %v", len(replies), err)
+		}
+	}
+}
+
+func BenchmarkGetCommentsByPostIDPage(b *testing.B) {
+	st := benchStorage()
+	ctx := context.Background()
+
+	limit, offset := int32(20), int32(benchRoots/2)
+
+	b.ResetTimer()
+
+	for i := range b.N {
+		comments, err := st.Comment.GetCommentsByPostID(ctx, int64(i%benchPosts)+1, &limit, &offset)
+		if err != nil || len(comments) != int(limit) {
+			b.Fatalf("got %d comments: %v", len(comments), err)
+		}
+	}
+}
+
+func BenchmarkCreateAndDeleteThread(b *testing.B) {
+	st := benchStorage()
+	ctx := context.Background()
+
+	b.ResetTimer()
+
+	for i := range b.N {
+		postID := int64(i%benchPosts) + 1
+
+		rootID, err := st.Comment.CreateComment(ctx, "Root", "alice", postID, nil, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := st.Comment.CreateComment(ctx, "Reply", "bob", postID, &rootID, &rootID); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := st.Comment.DeleteComment(ctx, rootID, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWebhookDeliveryRetention(t *testing.T) {
+	ctx := context.Background()
+	ws, err := NewWebhookMemoryStorage()
+	assert.NoError(t, err)
+	ws.keepFinished = 2
+
+	ids := make([]int64, 4)
+	for i := range ids {
+		ids[i], err = ws.EnqueueDelivery(ctx, constants.EventPostCreated, "http://example.com", []byte("{}"))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, ws.MarkDeliverySucceeded(ctx, ids[0]))
+	assert.NoError(t, ws.MarkDeliveryFailed(ctx, ids[1], "gone", nil))
+	retryAt := time.Now()
+	assert.NoError(t, ws.MarkDeliveryFailed(ctx, ids[2], "retry", &retryAt))
+	assert.NoError(t, ws.MarkDeliverySucceeded(ctx, ids[3]))
+
+	// Only the oldest finished delivery is dropped; the retried one stays
+	// pending and is the only one claimed.
+	deliveries, err := ws.GetDeliveries(ctx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 3)
+	assert.Equal(t, ids[3], deliveries[0].ID)
+	assert.Equal(t, ids[1], deliveries[2].ID)
+
+	claimed, err := ws.ClaimDueDeliveries(ctx, time.Now(), time.Minute, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, claimed, 1) {
+		assert.Equal(t, ids[2], claimed[0].ID)
+	}
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+)
+
+type NotificationMemoryStorage struct {
+	mu            sync.RWMutex
+	notifications map[int64]models.Notification
+	currentID     int64
+}
+
+func NewNotificationMemoryStorage() (*NotificationMemoryStorage, error) {
+	return &NotificationMemoryStorage{
+		mu:            sync.RWMutex{},
+		notifications: make(map[int64]models.Notification),
+		currentID:     1,
+	}, nil
+}
+
+func (ns *NotificationMemoryStorage) CreateNotification(ctx context.Context, recipient, notificationType string, postID, commentID int64) (int64, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	id := ns.currentID
+
+	ns.notifications[id] = models.Notification{
+		ID:        id,
+		Recipient: recipient,
+		Type:      notificationType,
+		PostID:    postID,
+		CommentID: commentID,
+		CreatedAt: time.Now(),
+	}
+
+	ns.currentID++
+
+	return id, nil
+}
+
+func (ns *NotificationMemoryStorage) GetNotificationByID(ctx context.Context, id int64) (models.Notification, error) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	notification, exists := ns.notifications[id]
+	if !exists {
+		return models.Notification{}, storageErrors.ErrNotificationNotFound
+	}
+
+	return copyNotification(notification), nil
+}
+
+// GetNotificationsByRecipient returns notifications newest first. after is an
+// exclusive cursor: only notifications with a smaller ID are returned.
+func (ns *NotificationMemoryStorage) GetNotificationsByRecipient(ctx context.Context, recipient string, unreadOnly bool, first *int32, after *int64) ([]models.Notification, error) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	filtered := make([]models.Notification, 0)
+
+	for _, notification := range ns.notifications {
+		if notification.Recipient != recipient {
+			continue
+		}
+		if unreadOnly && notification.ReadAt != nil {
+			continue
+		}
+		if after != nil && notification.ID >= *after {
+			continue
+		}
+
+		filtered = append(filtered, copyNotification(notification))
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].ID > filtered[j].ID
+	})
+
+	if first != nil && *first >= 0 && int(*first) < len(filtered) {
+		filtered = filtered[:*first]
+	}
+
+	return filtered, nil
+}
+
+// MarkNotificationsRead marks the recipient's notifications with the given IDs
+// as read, or all of them when ids is nil. It returns the number of
+// notifications that changed state.
+func (ns *NotificationMemoryStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int64) (int64, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	now := time.Now()
+	var marked int64
+
+	mark := func(id int64) {
+		notification, exists := ns.notifications[id]
+		if !exists || notification.Recipient != recipient || notification.ReadAt != nil {
+			return
+		}
+
+		readAt := now
+		notification.ReadAt = &readAt
+		ns.notifications[id] = notification
+		marked++
+	}
+
+	if ids == nil {
+		for id := range ns.notifications {
+			mark(id)
+		}
+		return marked, nil
+	}
+
+	for _, id := range ids {
+		mark(id)
+	}
+
+	return marked, nil
+}
+
+func copyNotification(notification models.Notification) models.Notification {
+	if notification.ReadAt != nil {
+		readAt := *notification.ReadAt
+		notification.ReadAt = &readAt
+	}
+
+	return notification
+}
+
+// deleteByPostID deletes the notifications about the post. Inside a
+// transaction j restores them on rollback.
+func (ns *NotificationMemoryStorage) deleteByPostID(postID int64, j *journal) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	var deleted []models.Notification
+
+	for id, notification := range ns.notifications {
+		if notification.PostID == postID {
+			deleted = append(deleted, notification)
+			delete(ns.notifications, id)
+		}
+	}
+
+	if j == nil || len(deleted) == 0 {
+		return
+	}
+
+	j.add(func() {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+
+		for _, notification := range deleted {
+			ns.notifications[notification.ID] = notification
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// NewPersistentMemoryStorage is NewMemoryStorage with posts and comments
+// kept in dir across restarts. Every write is appended to a write-ahead log
+// before it returns, and every snapshotInterval the log is compacted into
+// a snapshot. Both are replayed here at startup. Notifications, webhook
+// deliveries and idempotency keys stay in memory only.
+func NewPersistentMemoryStorage(dir string, snapshotInterval time.Duration) (*storage.Storage, error) {
+	const op = "storage.memory.NewPersistentMemoryStorage"
+
+	st, err := NewMemoryStorage()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	w, state, entries, err := openWAL(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	t := st.Transactor.(*transactor)
+
+	t.posts.restore(state)
+	t.comments.restore(state)
+
+	for _, records := range entries {
+		for _, record := range records {
+			t.posts.replay(record)
+			t.comments.replay(record)
+		}
+	}
+
+	p := &persistence{
+		wal:      w,
+		gate:     t.gate,
+		posts:    t.posts,
+		comments: t.comments,
+	}
+
+	// Start from a compacted log, so replay time does not build up over
+	// restarts.
+	if len(entries) > 0 {
+		if err := p.compact(); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	t.wal = w
+	t.posts.wal = w
+	t.comments.wal = w
+
+	if snapshotInterval > 0 {
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.run(snapshotInterval)
+	}
+
+	st.Pinger = p
+	st.Closer = p
+
+	return st, nil
+}
+
+// persistence compacts the log in the background and on Close.
+type persistence struct {
+	wal      *wal
+	gate     *sync.RWMutex
+	posts    *PostMemoryStorage
+	comments *CommentMemoryStorage
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (p *persistence) run(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			err := p.compact()
+
+			p.mu.Lock()
+			p.err = err
+			p.mu.Unlock()
+		}
+	}
+}
+
+// compact snapshots posts and comments. Holding the gate keeps every write
+// and transaction out, so the snapshot covers exactly the log it replaces.
+func (p *persistence) compact() error {
+	p.gate.Lock()
+	defer p.gate.Unlock()
+
+	state := snapshot{Pins: make(map[int64][]int64)}
+
+	p.posts.mu.RLock()
+	for _, post := range p.posts.posts {
+		state.Posts = append(state.Posts, copyPost(post))
+	}
+	state.PostNextID = p.posts.currentID
+	p.posts.mu.RUnlock()
+
+	p.comments.mu.RLock()
+	for _, comment := range p.comments.comments {
+		state.Comments = append(state.Comments, copyComment(comment))
+	}
+	for _, lock := range p.comments.locks {
+		state.Locks = append(state.Locks, copyLock(lock))
+	}
+	for postID, pins := range p.comments.pins {
+		state.Pins[postID] = append([]int64(nil), pins...)
+	}
+	state.CommentNextID = p.comments.currentID
+	p.comments.mu.RUnlock()
+
+	return p.wal.compact(state)
+}
+
+// Ping reports the last failed background compaction. Writes keep going to
+// the log meanwhile, but it grows until a compaction succeeds.
+func (p *persistence) Ping(ctx context.Context) error {
+	const op = "storage.memory.Ping"
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return fmt.Errorf("%s: snapshot failed: %w", op, p.err)
+	}
+
+	return nil
+}
+
+// Close takes a final snapshot and closes the log.
+func (p *persistence) Close() error {
+	const op = "storage.memory.Close"
+
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+	}
+
+	err := p.compact()
+
+	if closeErr := p.wal.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (ps *PostMemoryStorage) restore(state snapshot) {
+	for _, post := range state.Posts {
+		ps.posts[post.ID] = post
+	}
+
+	ps.currentID = max(ps.currentID, state.PostNextID)
+}
+
+func (ps *PostMemoryStorage) replay(record walRecord) {
+	if record.Post == nil {
+		return
+	}
+
+	if record.Post.Post != nil {
+		ps.posts[record.Post.ID] = *record.Post.Post
+	} else {
+		delete(ps.posts, record.Post.ID)
+	}
+
+	// The counter is logged with every post, so IDs of deleted posts are
+	// not handed out again.
+	ps.currentID = max(ps.currentID, record.Post.NextID)
+}
+
+func (cs *CommentMemoryStorage) restore(state snapshot) {
+	for _, comment := range state.Comments {
+		cs.put(comment)
+	}
+
+	for _, lock := range state.Locks {
+		cs.locks[lock.CommentID] = lock
+	}
+
+	for postID, pins := range state.Pins {
+		cs.pins[postID] = pins
+	}
+
+	cs.currentID = max(cs.currentID, state.CommentNextID)
+}
+
+func (cs *CommentMemoryStorage) replay(record walRecord) {
+	if record.Pins != nil {
+		if len(record.Pins.Pins) > 0 {
+			cs.pins[record.Pins.PostID] = record.Pins.Pins
+		} else {
+			delete(cs.pins, record.Pins.PostID)
+		}
+	}
+
+	if record.Comment == nil {
+		return
+	}
+
+	id := record.Comment.ID
+
+	if record.Comment.Comment != nil {
+		cs.put(*record.Comment.Comment)
+	} else {
+		cs.drop(id)
+	}
+
+	if record.Comment.Lock != nil {
+		cs.locks[id] = *record.Comment.Lock
+	} else {
+		delete(cs.locks, id)
+	}
+
+	cs.currentID = max(cs.currentID, record.Comment.NextID)
+}
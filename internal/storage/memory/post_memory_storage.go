@@ -2,43 +2,107 @@ package memory
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/constants"
 	"github.com/Pacahar/graphql-comments/internal/models"
 	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
 )
 
 type PostMemoryStorage struct {
 	mu        sync.RWMutex
+	gate      *sync.RWMutex
+	journal   *journal
+	wal       *wal
+	pending   pending
 	posts     map[int64]models.Post
 	currentID int64
+	// comments and notifications, when set, are deleted along with their
+	// post, as the SQL schema cascades.
+	comments      *CommentMemoryStorage
+	notifications *NotificationMemoryStorage
 }
 
 func NewPostMemoryStorage() (*PostMemoryStorage, error) {
 	return &PostMemoryStorage{
 		mu:        sync.RWMutex{},
+		gate:      &sync.RWMutex{},
 		posts:     make(map[int64]models.Post),
 		currentID: 1,
 	}, nil
 }
 
-func (ps *PostMemoryStorage) CreatePost(ctx context.Context, title, content string, commentsDisabled bool) (int64, error) {
+func (ps *PostMemoryStorage) CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error) {
+	ps.gate.RLock()
+	defer ps.gate.RUnlock()
+
+	return ps.createPost(ctx, title, content, author, status, commentsDisabled)
+}
+
+func (ps *PostMemoryStorage) createPost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
 	id := ps.currentID
+	ps.savePost(id)
+
+	now := time.Now()
+
+	var publishAt *time.Time
+	if status == constants.PostPublished {
+		publishAt = &now
+	}
 
 	ps.posts[id] = models.Post{
 		ID:               id,
 		Title:            title,
 		Content:          content,
+		Author:           author,
+		Status:           status,
+		PublishAt:        publishAt,
 		CommentsDisabled: commentsDisabled,
-		CreatedAt:        time.Now(),
+		CreatedAt:        now,
+		Version:          1,
 	}
 
 	ps.currentID++
 
+	if err := ps.persist(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (ps *PostMemoryStorage) ImportPost(ctx context.Context, post models.Post) (int64, error) {
+	ps.gate.RLock()
+	defer ps.gate.RUnlock()
+
+	return ps.importPost(ctx, post)
+}
+
+func (ps *PostMemoryStorage) importPost(ctx context.Context, post models.Post) (int64, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	id := ps.currentID
+	ps.savePost(id)
+
+	post = copyPost(post)
+	post.ID = id
+	post.Version = 1
+
+	ps.posts[id] = post
+	ps.currentID++
+
+	if err := ps.persist(); err != nil {
+		return 0, err
+	}
+
 	return id, nil
 }
 
@@ -50,7 +114,7 @@ func (ps *PostMemoryStorage) GetPostByID(ctx context.Context, id int64) (models.
 	if !exists {
 		return models.Post{}, storageErrors.ErrPostNotFound
 	}
-	return post, nil
+	return copyPost(post), nil
 }
 
 func (ps *PostMemoryStorage) GetAllPosts(ctx context.Context) ([]models.Post, error) {
@@ -60,21 +124,237 @@ func (ps *PostMemoryStorage) GetAllPosts(ctx context.Context) ([]models.Post, er
 	posts := make([]models.Post, 0, len(ps.posts))
 
 	for _, post := range ps.posts {
-		posts = append(posts, post)
+		posts = append(posts, copyPost(post))
 	}
 
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+		}
+		return posts[i].ID < posts[j].ID
+	})
+
 	return posts, nil
 }
 
-func (ps *PostMemoryStorage) DeletePost(ctx context.Context, id int64) error {
+func (ps *PostMemoryStorage) UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error {
+	ps.gate.RLock()
+	defer ps.gate.RUnlock()
+
+	return ps.updatePost(ctx, id, title, content, expectedVersion)
+}
+
+func (ps *PostMemoryStorage) updatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	// if _, exists := ps.posts[id]; !exists {
-	// 	return storageErrors.ErrPostNotFound
-	// }
+	post, err := ps.postForUpdate(id, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	ps.savePost(id)
+	post.Title = title
+	post.Content = content
+	post.Version++
+	ps.posts[id] = post
+
+	return ps.persist()
+}
+
+func (ps *PostMemoryStorage) SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error {
+	ps.gate.RLock()
+	defer ps.gate.RUnlock()
+
+	return ps.setCommentsDisabled(ctx, id, disabled, expectedVersion)
+}
+
+func (ps *PostMemoryStorage) setCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	post, err := ps.postForUpdate(id, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	ps.savePost(id)
+	post.CommentsDisabled = disabled
+	post.Version++
+	ps.posts[id] = post
+
+	return ps.persist()
+}
+
+func (ps *PostMemoryStorage) SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error {
+	ps.gate.RLock()
+	defer ps.gate.RUnlock()
+
+	return ps.setPostStatus(ctx, id, status, publishAt, expectedVersion)
+}
+
+func (ps *PostMemoryStorage) setPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	post, err := ps.postForUpdate(id, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	ps.savePost(id)
+	post.Status = status
+	if publishAt != nil {
+		val := *publishAt
+		post.PublishAt = &val
+	}
+	post.Version++
+	ps.posts[id] = post
+
+	return ps.persist()
+}
+
+func (ps *PostMemoryStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]int64, error) {
+	ps.gate.RLock()
+	defer ps.gate.RUnlock()
+
+	return ps.publishDuePosts(ctx, now)
+}
 
+func (ps *PostMemoryStorage) publishDuePosts(ctx context.Context, now time.Time) ([]int64, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	published := make([]int64, 0)
+
+	for id, post := range ps.posts {
+		if post.Status != constants.PostScheduled || post.PublishAt == nil || post.PublishAt.After(now) {
+			continue
+		}
+
+		ps.savePost(id)
+		post.Status = constants.PostPublished
+		post.Version++
+		ps.posts[id] = post
+		published = append(published, id)
+	}
+
+	if err := ps.persist(); err != nil {
+		return nil, err
+	}
+
+	slices.Sort(published)
+
+	return published, nil
+}
+
+func (ps *PostMemoryStorage) DeletePost(ctx context.Context, id int64, expectedVersion *int64) error {
+	ps.gate.RLock()
+	defer ps.gate.RUnlock()
+
+	return ps.deletePost(ctx, id, expectedVersion)
+}
+
+func (ps *PostMemoryStorage) deletePost(ctx context.Context, id int64, expectedVersion *int64) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, err := ps.postForUpdate(id, expectedVersion); err != nil {
+		if expectedVersion == nil && errors.Is(err, storageErrors.ErrPostNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Outside a transaction the comments are logged on their own and go
+	// first, so a failure in between leaves a post without comments rather
+	// than comments without a post.
+	if ps.comments != nil {
+		if err := ps.comments.deleteCommentsByPostID(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	ps.savePost(id)
 	delete(ps.posts, id)
 
+	if err := ps.persist(); err != nil {
+		return err
+	}
+
+	if ps.notifications != nil {
+		ps.notifications.deleteByPostID(id, ps.journal)
+	}
+
 	return nil
 }
+
+// postForUpdate returns the post if its version matches expectedVersion.
+// The caller must hold the write lock.
+func (ps *PostMemoryStorage) postForUpdate(id int64, expectedVersion *int64) (models.Post, error) {
+	post, exists := ps.posts[id]
+	if !exists {
+		return models.Post{}, storageErrors.ErrPostNotFound
+	}
+
+	if expectedVersion != nil && *expectedVersion != post.Version {
+		return models.Post{}, storageErrors.ErrVersionConflict
+	}
+
+	return post, nil
+}
+
+// savePost journals the current state of the post and the ID counter so
+// that a rolled back transaction can restore them, and queues the post for
+// the write-ahead log. The caller must hold the write lock.
+func (ps *PostMemoryStorage) savePost(id int64) {
+	if ps.journal == nil && ps.wal == nil {
+		return
+	}
+
+	post, exists := ps.posts[id]
+	currentID := ps.currentID
+
+	undo := func() {
+		if exists {
+			ps.posts[id] = post
+		} else {
+			delete(ps.posts, id)
+		}
+		ps.currentID = currentID
+	}
+
+	if ps.journal != nil {
+		ps.journal.add(undo)
+	}
+
+	if ps.wal != nil {
+		ps.pending.add(func() walRecord { return ps.record(id) }, undo)
+	}
+}
+
+// persist logs the posts saved by the running write. The caller must hold
+// the write lock.
+func (ps *PostMemoryStorage) persist() error {
+	return ps.pending.flush(ps.wal, ps.journal)
+}
+
+func (ps *PostMemoryStorage) record(id int64) walRecord {
+	record := &postRecord{ID: id, NextID: ps.currentID}
+
+	if post, exists := ps.posts[id]; exists {
+		post = copyPost(post)
+		record.Post = &post
+	}
+
+	return walRecord{Post: record}
+}
+
+func copyPost(post models.Post) models.Post {
+	if post.PublishAt != nil {
+		val := *post.PublishAt
+		post.PublishAt = &val
+	}
+
+	return post
+}
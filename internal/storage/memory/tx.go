@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// journal collects the undo actions of the running transaction and, when
+// the storage is persistent, the log records written on commit.
+type journal struct {
+	undo    []func()
+	records []walRecord
+}
+
+func (j *journal) add(fn func()) {
+	j.undo = append(j.undo, fn)
+}
+
+func (j *journal) rollback() {
+	for i := len(j.undo) - 1; i >= 0; i-- {
+		j.undo[i]()
+	}
+}
+
+// transactor makes posts and comments transactional. Writes outside a
+// transaction hold the shared side of gate, a transaction holds it
+// exclusively, so transactions are serialized with every other write while
+// reads keep going and may observe uncommitted changes. Notifications,
+// webhooks and idempotency keys are not part of the transaction, except
+// that notifications deleted with their post come back on rollback.
+type transactor struct {
+	gate     *sync.RWMutex
+	posts    *PostMemoryStorage
+	comments *CommentMemoryStorage
+	base     storage.Storage
+	wal      *wal
+}
+
+func newTransactor(posts *PostMemoryStorage, comments *CommentMemoryStorage, base storage.Storage) *transactor {
+	gate := &sync.RWMutex{}
+	posts.gate = gate
+	comments.gate = gate
+
+	base.Post = postMemoryTx{posts}
+	base.Comment = commentMemoryTx{comments}
+	base.Transactor = nil
+
+	return &transactor{
+		gate:     gate,
+		posts:    posts,
+		comments: comments,
+		base:     base,
+	}
+}
+
+func (t *transactor) WithTx(ctx context.Context, fn func(ctx context.Context, tx storage.Storage) error) error {
+	const op = "storage.memory.WithTx"
+
+	t.gate.Lock()
+	defer t.gate.Unlock()
+
+	j := &journal{}
+	t.posts.journal = j
+	t.comments.journal = j
+
+	committed := false
+
+	defer func() {
+		t.posts.journal = nil
+		t.comments.journal = nil
+
+		if committed {
+			return
+		}
+
+		t.posts.mu.Lock()
+		t.comments.mu.Lock()
+		j.rollback()
+		t.comments.mu.Unlock()
+		t.posts.mu.Unlock()
+	}()
+
+	if err := fn(ctx, t.base); err != nil {
+		return err
+	}
+
+	if t.wal != nil {
+		if err := t.wal.append(j.records); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	committed = true
+
+	return nil
+}
+
+// postMemoryTx writes posts without taking the gate, which the running
+// transaction already holds.
+type postMemoryTx struct {
+	*PostMemoryStorage
+}
+
+func (tx postMemoryTx) CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error) {
+	return tx.createPost(ctx, title, content, author, status, commentsDisabled)
+}
+
+func (tx postMemoryTx) ImportPost(ctx context.Context, post models.Post) (int64, error) {
+	return tx.importPost(ctx, post)
+}
+
+func (tx postMemoryTx) UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error {
+	return tx.updatePost(ctx, id, title, content, expectedVersion)
+}
+
+func (tx postMemoryTx) SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error {
+	return tx.setCommentsDisabled(ctx, id, disabled, expectedVersion)
+}
+
+func (tx postMemoryTx) SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error {
+	return tx.setPostStatus(ctx, id, status, publishAt, expectedVersion)
+}
+
+func (tx postMemoryTx) PublishDuePosts(ctx context.Context, now time.Time) ([]int64, error) {
+	return tx.publishDuePosts(ctx, now)
+}
+
+func (tx postMemoryTx) DeletePost(ctx context.Context, id int64, expectedVersion *int64) error {
+	return tx.deletePost(ctx, id, expectedVersion)
+}
+
+// commentMemoryTx is postMemoryTx for comments.
+type commentMemoryTx struct {
+	*CommentMemoryStorage
+}
+
+func (tx commentMemoryTx) CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error) {
+	return tx.createComment(ctx, content, author, postID, parentID, replyToID)
+}
+
+func (tx commentMemoryTx) ImportComment(ctx context.Context, comment models.Comment) (int64, error) {
+	return tx.importComment(ctx, comment)
+}
+
+func (tx commentMemoryTx) UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error {
+	return tx.updateComment(ctx, id, content, expectedVersion)
+}
+
+func (tx commentMemoryTx) DeleteComment(ctx context.Context, id int64, expectedVersion *int64) error {
+	return tx.deleteComment(ctx, id, expectedVersion)
+}
+
+func (tx commentMemoryTx) DeleteCommentsByPostID(ctx context.Context, postID int64) error {
+	return tx.deleteCommentsByPostID(ctx, postID)
+}
+
+func (tx commentMemoryTx) LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error {
+	return tx.lockComment(ctx, id, reason, lockedBy, expiresAt)
+}
+
+func (tx commentMemoryTx) UnlockComment(ctx context.Context, id int64) error {
+	return tx.unlockComment(ctx, id)
+}
+
+func (tx commentMemoryTx) PinComment(ctx context.Context, postID, commentID int64, maxPins int) error {
+	return tx.pinComment(ctx, postID, commentID, maxPins)
+}
+
+func (tx commentMemoryTx) UnpinComment(ctx context.Context, postID, commentID int64) error {
+	return tx.unpinComment(ctx, postID, commentID)
+}
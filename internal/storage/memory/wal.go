@@ -0,0 +1,315 @@
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.json"
+)
+
+// walRecord holds the state of one post, comment or pin list after a
+// write. Records replace state rather than describe operations, so
+// replaying a record twice is harmless.
+type walRecord struct {
+	Post    *postRecord    `json:"post,omitempty"`
+	Comment *commentRecord `json:"comment,omitempty"`
+	Pins    *pinsRecord    `json:"pins,omitempty"`
+}
+
+// postRecord is a post as it is after the write, or nil when deleted.
+type postRecord struct {
+	ID     int64        `json:"id"`
+	Post   *models.Post `json:"post,omitempty"`
+	NextID int64        `json:"next_id"`
+}
+
+type commentRecord struct {
+	ID      int64               `json:"id"`
+	Comment *models.Comment     `json:"comment,omitempty"`
+	Lock    *models.CommentLock `json:"lock,omitempty"`
+	NextID  int64               `json:"next_id"`
+}
+
+type pinsRecord struct {
+	PostID int64   `json:"post_id"`
+	Pins   []int64 `json:"pins,omitempty"`
+}
+
+type snapshot struct {
+	Posts         []models.Post        `json:"posts"`
+	PostNextID    int64                `json:"post_next_id"`
+	Comments      []models.Comment     `json:"comments"`
+	Locks         []models.CommentLock `json:"locks"`
+	Pins          map[int64][]int64    `json:"pins"`
+	CommentNextID int64                `json:"comment_next_id"`
+}
+
+// pending collects the changes of the running write until it is logged.
+// records build the walRecords from the state after the write, undo
+// reverts the write should logging fail.
+type pending struct {
+	records []func() walRecord
+	undo    []func()
+}
+
+func (p *pending) add(record func() walRecord, undo func()) {
+	p.records = append(p.records, record)
+	p.undo = append(p.undo, undo)
+}
+
+// flush logs the pending changes. Inside a transaction they are handed to
+// the journal and logged on commit. Outside one they are logged right away
+// and a failed write undoes them, so memory never gets ahead of the log.
+func (p *pending) flush(w *wal, j *journal) error {
+	if w == nil || len(p.records) == 0 {
+		return nil
+	}
+
+	records := make([]walRecord, 0, len(p.records))
+	for _, record := range p.records {
+		records = append(records, record())
+	}
+
+	undo := p.undo
+	*p = pending{}
+
+	if j != nil {
+		j.records = append(j.records, records...)
+		return nil
+	}
+
+	if err := w.append(records); err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// wal appends the writes to posts and comments to a log file in dir, one
+// line per write or transaction, and compacts the log into a snapshot.
+type wal struct {
+	mu   sync.Mutex
+	dir  string
+	file *os.File
+	// size is where the complete entries of the log end.
+	size int64
+	// err is set when a failed append could not be cut off the log. The
+	// log is refused further appends until a compaction empties it.
+	err error
+}
+
+// openWAL reads the snapshot and the log in dir, creating dir when
+// missing, and opens the log for appending. A torn last line, left by a
+// crash in the middle of a write, is cut off.
+func openWAL(dir string) (*wal, snapshot, [][]walRecord, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, snapshot{}, nil, err
+	}
+
+	state, err := readSnapshot(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return nil, snapshot{}, nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, walFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, snapshot{}, nil, err
+	}
+
+	entries, size, err := readWAL(file)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, snapshot{}, nil, err
+	}
+
+	return &wal{dir: dir, file: file, size: size}, state, entries, nil
+}
+
+func readSnapshot(path string) (snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot{}, nil
+	}
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	var state snapshot
+	if err := json.Unmarshal(data, &state); err != nil {
+		return snapshot{}, fmt.Errorf("corrupt snapshot %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// readWAL returns the complete entries of the log and the size they take.
+func readWAL(file *os.File) ([][]walRecord, int64, error) {
+	reader := bufio.NewReader(file)
+
+	var entries [][]walRecord
+	var size int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Anything after the last newline is a torn write.
+			return entries, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var records []walRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &records); err != nil {
+			return nil, 0, fmt.Errorf("corrupt wal entry at offset %d: %w", size, err)
+		}
+
+		entries = append(entries, records)
+		size += int64(len(line))
+	}
+}
+
+// append writes records as one entry and waits for it to reach the disk.
+// A failed entry is cut off again, so that the entries written after it
+// are not lost behind a torn line on replay.
+func (w *wal) append(records []walRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	line, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return fmt.Errorf("wal failed: %w", w.err)
+	}
+
+	line = append(line, '\n')
+
+	_, err = w.file.Write(line)
+	if err == nil {
+		err = w.file.Sync()
+	}
+
+	if err != nil {
+		if cutErr := w.cut(); cutErr != nil {
+			w.err = errors.Join(err, cutErr)
+		}
+		return err
+	}
+
+	w.size += int64(len(line))
+
+	return nil
+}
+
+// cut truncates the log to its complete entries.
+func (w *wal) cut() error {
+	if err := w.file.Truncate(w.size); err != nil {
+		return err
+	}
+
+	if _, err := w.file.Seek(w.size, io.SeekStart); err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+// compact replaces the snapshot with state and empties the log. The caller
+// must keep writes out until it returns. A crash between the two steps
+// leaves a log that is already part of the snapshot, which replays to the
+// same state.
+func (w *wal) compact(state snapshot) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(w.dir, snapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(w.dir, snapshotFile)); err != nil {
+		return err
+	}
+
+	// The rename must be on disk before the log is emptied, or a crash
+	// could leave the old snapshot and an empty log.
+	if err := syncDir(w.dir); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.size = 0
+
+	if err := w.cut(); err != nil {
+		w.err = err
+		return err
+	}
+
+	w.err = nil
+
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func (w *wal) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
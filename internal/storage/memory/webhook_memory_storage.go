@@ -0,0 +1,195 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+// maxFinishedDeliveries is how many delivered and failed deliveries are
+// kept for the deliveries query before the oldest are dropped.
+const maxFinishedDeliveries = 10_000
+
+type WebhookMemoryStorage struct {
+	mu         sync.RWMutex
+	deliveries map[int64]models.WebhookDelivery
+	currentID  int64
+	// pending holds the IDs of the pending deliveries, so that claims do
+	// not scan finished ones.
+	pending map[int64]struct{}
+	// finished holds the IDs of the finished deliveries in the order they
+	// finished. Past keepFinished the oldest are dropped.
+	finished     []int64
+	keepFinished int
+}
+
+func NewWebhookMemoryStorage() (*WebhookMemoryStorage, error) {
+	return &WebhookMemoryStorage{
+		mu:           sync.RWMutex{},
+		deliveries:   make(map[int64]models.WebhookDelivery),
+		currentID:    1,
+		pending:      make(map[int64]struct{}),
+		keepFinished: maxFinishedDeliveries,
+	}, nil
+}
+
+func (ws *WebhookMemoryStorage) EnqueueDelivery(ctx context.Context, event, endpoint string, payload []byte) (int64, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	id := ws.currentID
+	now := time.Now()
+
+	ws.deliveries[id] = models.WebhookDelivery{
+		ID:            id,
+		Event:         event,
+		Endpoint:      endpoint,
+		Payload:       append([]byte(nil), payload...),
+		Status:        constants.WebhookDeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	ws.pending[id] = struct{}{}
+
+	ws.currentID++
+
+	return id, nil
+}
+
+func (ws *WebhookMemoryStorage) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	due := make([]models.WebhookDelivery, 0)
+
+	for id := range ws.pending {
+		if delivery := ws.deliveries[id]; !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].ID < due[j].ID
+	})
+
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i, delivery := range due {
+		delivery.NextAttemptAt = now.Add(lease)
+		ws.deliveries[delivery.ID] = delivery
+		due[i] = copyWebhookDelivery(delivery)
+	}
+
+	return due, nil
+}
+
+func (ws *WebhookMemoryStorage) MarkDeliverySucceeded(ctx context.Context, id int64) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	delivery, exists := ws.deliveries[id]
+	if !exists {
+		return nil
+	}
+
+	now := time.Now()
+	delivery.Status = constants.WebhookDeliveryDelivered
+	delivery.Attempts++
+	delivery.LastError = ""
+	delivery.DeliveredAt = &now
+	ws.deliveries[id] = delivery
+	ws.finish(id)
+
+	return nil
+}
+
+func (ws *WebhookMemoryStorage) MarkDeliveryFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	delivery, exists := ws.deliveries[id]
+	if !exists {
+		return nil
+	}
+
+	delivery.Attempts++
+	delivery.LastError = lastError
+
+	if nextAttemptAt == nil {
+		delivery.Status = constants.WebhookDeliveryFailed
+	} else {
+		delivery.NextAttemptAt = *nextAttemptAt
+	}
+
+	ws.deliveries[id] = delivery
+
+	if nextAttemptAt == nil {
+		ws.finish(id)
+	}
+
+	return nil
+}
+
+// finish stops claims from seeing the delivery and drops the oldest
+// finished deliveries past keepFinished.
+func (ws *WebhookMemoryStorage) finish(id int64) {
+	if _, pending := ws.pending[id]; !pending {
+		return
+	}
+
+	delete(ws.pending, id)
+	ws.finished = append(ws.finished, id)
+
+	for len(ws.finished) > ws.keepFinished {
+		delete(ws.deliveries, ws.finished[0])
+		ws.finished = ws.finished[1:]
+	}
+}
+
+func (ws *WebhookMemoryStorage) GetDeliveries(ctx context.Context, status *string, limit *int32, offset *int32) ([]models.WebhookDelivery, error) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	filtered := make([]models.WebhookDelivery, 0)
+
+	for _, delivery := range ws.deliveries {
+		if status != nil && delivery.Status != *status {
+			continue
+		}
+
+		filtered = append(filtered, copyWebhookDelivery(delivery))
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].ID > filtered[j].ID
+	})
+
+	start := int32(0)
+	if offset != nil && *offset > 0 {
+		start = min(*offset, int32(len(filtered)))
+	}
+
+	end := int32(len(filtered))
+	if limit != nil && *limit >= 0 && (start+*limit) < end {
+		end = start + *limit
+	}
+
+	return filtered[start:end], nil
+}
+
+func copyWebhookDelivery(delivery models.WebhookDelivery) models.WebhookDelivery {
+	delivery.Payload = append([]byte(nil), delivery.Payload...)
+
+	if delivery.DeliveredAt != nil {
+		deliveredAt := *delivery.DeliveredAt
+		delivery.DeliveredAt = &deliveredAt
+	}
+
+	return delivery
+}
@@ -5,54 +5,65 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/Pacahar/graphql-comments/internal/models"
 )
 
 type CommentPostgresStorage struct {
-	db *sql.DB
+	db storageDB
+	// reads serves the comment lookups and listings, which may go to a
+	// replica.
+	reads storageDB
 }
 
-func NewPostgresCommentStorage(db *sql.DB) (*CommentPostgresStorage, error) {
-	const op = "storage.postgres.NewPostgresCommentStorage"
+func NewPostgresCommentStorage(db *sql.DB) *CommentPostgresStorage {
+	return &CommentPostgresStorage{db: traced(db), reads: traced(db)}
+}
+
+func (cs *CommentPostgresStorage) CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error) {
+	const op = "storage.postgres.comment.CreateComment"
 
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS comment(
-			id SERIAL PRIMARY KEY,
-			post_id INTEGER NOT NULL,
-			parent_id INTEGER NULL,
-			content TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT NOW() NOT NULL,
-			FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE,
-			FOREIGN KEY (parent_id) REFERENCES comment(id) ON DELETE CASCADE
-		);
-		CREATE INDEX IF NOT EXISTS idx_comment_post_id ON comment(post_id);
-		CREATE INDEX IF NOT EXISTS idx_comment_parent_id ON comment(parent_id);
-		CREATE INDEX IF NOT EXISTS idx_comment_created_at ON comment(created_at);
-	`)
+	var id int64
+	err := cs.db.QueryRowContext(ctx, `
+		INSERT INTO comment (content, author, post_id, parent_id, reply_to_id, depth)
+		SELECT $1, $2, $3, $4, $5, COALESCE((SELECT depth + 1 FROM comment WHERE id = $4), 0)
+		WHERE $4::INTEGER IS NULL OR EXISTS(SELECT 1 FROM comment WHERE id = $4 AND post_id = $3)
+		RETURNING id`,
+		content, author, postID, parentID, replyToID,
+	).Scan(&id)
 
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storageErrors.ErrCommentNotFound
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &CommentPostgresStorage{db: db}, nil
+	return id, nil
 }
 
-func (cs *CommentPostgresStorage) CreateComment(ctx context.Context, content string, postID int64, parentID *int64) (int64, error) {
-	const op = "storage.postgres.comment.CreateComment"
+func (cs *CommentPostgresStorage) ImportComment(ctx context.Context, comment models.Comment) (int64, error) {
+	const op = "storage.postgres.comment.ImportComment"
 
 	var id int64
 	err := cs.db.QueryRowContext(ctx, `
-		INSERT INTO comment (content, post_id, parent_id)
-		VALUES ($1, $2, $3)
+		INSERT INTO comment (content, author, post_id, parent_id, reply_to_id, depth, status, created_at)
+		SELECT $1, $2, $3, $4, $5, COALESCE((SELECT depth + 1 FROM comment WHERE id = $4), 0), COALESCE(NULLIF($6, ''), 'VISIBLE'), $7
+		WHERE $4::INTEGER IS NULL OR EXISTS(SELECT 1 FROM comment WHERE id = $4 AND post_id = $3)
 		RETURNING id`,
-		content, postID, parentID,
+		comment.Content, comment.Author, comment.PostID, comment.ParentID, comment.ReplyToID, comment.Status, comment.CreatedAt.UTC(),
 	).Scan(&id)
 
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storageErrors.ErrCommentNotFound
+		}
+
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -64,10 +75,11 @@ func (cs *CommentPostgresStorage) GetCommentByID(ctx context.Context, id int64)
 
 	comment := models.Comment{}
 
-	row := cs.db.QueryRowContext(ctx, `
-		SELECT id, post_id, parent_id, content, created_at 
+	row := cs.reads.QueryRowContext(ctx, `
+		SELECT id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned 
 		FROM comment 
-		WHERE id=$1`,
+		WHERE id=$1 `+rowLock(cs.reads),
 		id,
 	)
 
@@ -75,8 +87,14 @@ func (cs *CommentPostgresStorage) GetCommentByID(ctx context.Context, id int64)
 		&comment.ID,
 		&comment.PostID,
 		&comment.ParentID,
+		&comment.ReplyToID,
+		&comment.Depth,
+		&comment.Author,
 		&comment.Content,
+		&comment.Status,
 		&comment.CreatedAt,
+		&comment.Version,
+		&comment.Pinned,
 	)
 
 	if err != nil {
@@ -92,11 +110,12 @@ func (cs *CommentPostgresStorage) GetCommentByID(ctx context.Context, id int64)
 func (cs *CommentPostgresStorage) GetCommentsByParentID(ctx context.Context, ParentID int64) ([]models.Comment, error) {
 	const op = "storage.postgres.comment.GetCommentsByParentID"
 
-	rows, err := cs.db.QueryContext(ctx, `
-		SELECT id, post_id, parent_id, content, created_at
+	rows, err := cs.reads.QueryContext(ctx, `
+		SELECT id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned
 		FROM comment
 		WHERE parent_id = $1
-		ORDER BY created_at ASC`,
+		ORDER BY created_at ASC, id ASC`,
 		ParentID,
 	)
 
@@ -114,8 +133,14 @@ func (cs *CommentPostgresStorage) GetCommentsByParentID(ctx context.Context, Par
 			&comment.ID,
 			&comment.PostID,
 			&comment.ParentID,
+			&comment.ReplyToID,
+			&comment.Depth,
+			&comment.Author,
 			&comment.Content,
+			&comment.Status,
 			&comment.CreatedAt,
+			&comment.Version,
+			&comment.Pinned,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
@@ -134,26 +159,28 @@ func (cs *CommentPostgresStorage) GetCommentsByParentID(ctx context.Context, Par
 func (cs *CommentPostgresStorage) GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) ([]models.Comment, error) {
 	const op = "storage.postgres.comment.GetCommentsByPostID"
 
-	var rows *sql.Rows
+	var rows sqlRows
 	var err error
 
 	if limit != nil && offset != nil {
-		rows, err = cs.db.QueryContext(ctx, `
-		SELECT id, post_id, parent_id, content, created_at
+		rows, err = cs.reads.QueryContext(ctx, `
+		SELECT id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned
 		FROM comment
 		WHERE post_id = $1
 		AND parent_id IS NULL
-		ORDER BY created_at ASC
+		ORDER BY created_at ASC, id ASC
 		LIMIT $2
 		OFFSET $3
 	`, postID, *limit, *offset)
 	} else {
-		rows, err = cs.db.QueryContext(ctx, `
-		SELECT id, post_id, parent_id, content, created_at
+		rows, err = cs.reads.QueryContext(ctx, `
+		SELECT id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned
 		FROM comment
 		WHERE post_id = $1
 		AND parent_id IS NULL
-		ORDER BY created_at ASC`, postID)
+		ORDER BY created_at ASC, id ASC`, postID)
 	}
 
 	if err != nil {
@@ -170,8 +197,14 @@ func (cs *CommentPostgresStorage) GetCommentsByPostID(ctx context.Context, postI
 			&comment.ID,
 			&comment.PostID,
 			&comment.ParentID,
+			&comment.ReplyToID,
+			&comment.Depth,
+			&comment.Author,
 			&comment.Content,
+			&comment.Status,
 			&comment.CreatedAt,
+			&comment.Version,
+			&comment.Pinned,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
@@ -187,20 +220,138 @@ func (cs *CommentPostgresStorage) GetCommentsByPostID(ctx context.Context, postI
 	return comments, nil
 }
 
-func (cs *CommentPostgresStorage) DeleteComment(ctx context.Context, id int64) error {
+func (cs *CommentPostgresStorage) GetThread(ctx context.Context, postID int64, rootID *int64, maxDepth, limit int) ([]models.ThreadComment, error) {
+	const op = "storage.postgres.comment.GetThread"
+
+	rows, err := cs.reads.QueryContext(ctx, `
+		WITH RECURSIVE thread AS (
+			SELECT id, 0 AS level, ARRAY[id] AS path
+			FROM comment
+			WHERE post_id = $1
+			AND (($2::INTEGER IS NULL AND parent_id IS NULL) OR id = $2)
+			UNION ALL
+			SELECT comment.id, thread.level + 1, thread.path || comment.id
+			FROM comment
+			JOIN thread ON comment.parent_id = thread.id
+			WHERE $3::INTEGER = 0 OR thread.level < $3
+		)
+		SELECT comment.id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned,
+			thread.level, thread.path
+		FROM thread
+		JOIN comment ON comment.id = thread.id
+		ORDER BY thread.level ASC, created_at ASC, comment.id ASC
+		LIMIT NULLIF($4::INTEGER, 0)`,
+		postID, rootID, maxDepth, limit,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	thread := make([]models.ThreadComment, 0)
+
+	for rows.Next() {
+		var comment models.ThreadComment
+		err := rows.Scan(
+			&comment.Comment.ID,
+			&comment.Comment.PostID,
+			&comment.Comment.ParentID,
+			&comment.Comment.ReplyToID,
+			&comment.Comment.Depth,
+			&comment.Comment.Author,
+			&comment.Comment.Content,
+			&comment.Comment.Status,
+			&comment.Comment.CreatedAt,
+			&comment.Comment.Version,
+			&comment.Comment.Pinned,
+			&comment.Depth,
+			pq.Array(&comment.Path),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		thread = append(thread, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	// The root is always listed when it exists.
+	if rootID != nil && len(thread) == 0 {
+		return nil, storageErrors.ErrCommentNotFound
+	}
+
+	return thread, nil
+}
+
+func (cs *CommentPostgresStorage) UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error {
+	const op = "storage.postgres.comment.UpdateComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		UPDATE comment
+		SET content = $2, version = version + 1
+		WHERE id=$1
+		AND ($3::BIGINT IS NULL OR version = $3)`,
+		id, content, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return cs.checkUpdated(ctx, op, result, id)
+}
+
+func (cs *CommentPostgresStorage) DeleteComment(ctx context.Context, id int64, expectedVersion *int64) error {
 	const op = "storage.postgres.comment.DeleteComment"
 
-	_, err := cs.db.ExecContext(ctx, `
+	result, err := cs.db.ExecContext(ctx, `
 		DELETE FROM comment
-		WHERE id=$1`,
-		id,
+		WHERE id=$1
+		AND ($2::BIGINT IS NULL OR version = $2)`,
+		id, expectedVersion,
 	)
 
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	if expectedVersion == nil {
+		return nil
+	}
+
+	return cs.checkUpdated(ctx, op, result, id)
+}
+
+// checkUpdated tells apart the two reasons a version guarded statement can
+// affect no rows: the comment is gone, or its version has moved on.
+func (cs *CommentPostgresStorage) checkUpdated(ctx context.Context, op string, result sql.Result, id int64) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = cs.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM comment WHERE id=$1)`, id).Scan(&exists)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if exists {
+		return storageErrors.ErrVersionConflict
+	}
+
+	return storageErrors.ErrCommentNotFound
 }
 
 func (cs *CommentPostgresStorage) DeleteCommentsByPostID(ctx context.Context, postID int64) error {
@@ -218,3 +369,241 @@ func (cs *CommentPostgresStorage) DeleteCommentsByPostID(ctx context.Context, po
 
 	return nil
 }
+
+func (cs *CommentPostgresStorage) LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error {
+	const op = "storage.postgres.comment.LockComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		INSERT INTO comment_lock (comment_id, reason, locked_by, expires_at)
+		SELECT id, $2, $3, $4
+		FROM comment
+		WHERE id=$1
+		ON CONFLICT (comment_id) DO UPDATE
+		SET reason = EXCLUDED.reason,
+			locked_by = EXCLUDED.locked_by,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at`,
+		id, reason, lockedBy, expiresAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		return storageErrors.ErrCommentNotFound
+	}
+
+	return nil
+}
+
+func (cs *CommentPostgresStorage) UnlockComment(ctx context.Context, id int64) error {
+	const op = "storage.postgres.comment.UnlockComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		DELETE FROM comment_lock
+		WHERE comment_id=$1`,
+		id,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		return storageErrors.ErrLockNotFound
+	}
+
+	return nil
+}
+
+func (cs *CommentPostgresStorage) FindActiveLock(ctx context.Context, id int64, now time.Time) (models.CommentLock, error) {
+	const op = "storage.postgres.comment.FindActiveLock"
+
+	lock := models.CommentLock{}
+
+	row := cs.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, 0 AS distance
+			FROM comment
+			WHERE id=$1
+			UNION ALL
+			SELECT c.id, c.parent_id, a.distance + 1
+			FROM comment c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT l.comment_id, l.reason, l.locked_by, l.created_at, l.expires_at
+		FROM ancestors a
+		JOIN comment_lock l ON l.comment_id = a.id
+		WHERE l.expires_at IS NULL OR l.expires_at > $2
+		ORDER BY a.distance ASC
+		LIMIT 1`,
+		id, now,
+	)
+
+	err := row.Scan(
+		&lock.CommentID,
+		&lock.Reason,
+		&lock.LockedBy,
+		&lock.CreatedAt,
+		&lock.ExpiresAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.CommentLock{}, storageErrors.ErrLockNotFound
+		}
+		return models.CommentLock{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return lock, nil
+}
+
+func (cs *CommentPostgresStorage) PinComment(ctx context.Context, postID, commentID int64, maxPins int) error {
+	const op = "storage.postgres.comment.PinComment"
+
+	err := inTx(ctx, cs.db, func(tx storageDB) error {
+		// Lock the post row so concurrent pins cannot exceed maxPins.
+		_, err := tx.ExecContext(ctx, `SELECT 1 FROM post WHERE id=$1 FOR UPDATE`, postID)
+		if err != nil {
+			return err
+		}
+
+		var pinned bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM comment_pin WHERE comment_id = comment.id)
+			FROM comment
+			WHERE id=$1 AND post_id=$2`,
+			commentID, postID,
+		).Scan(&pinned)
+
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storageErrors.ErrCommentNotFound
+			}
+			return err
+		}
+
+		if pinned {
+			return nil
+		}
+
+		var count, position int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COUNT(*), COALESCE(MAX(position), 0) + 1
+			FROM comment_pin
+			WHERE post_id=$1`,
+			postID,
+		).Scan(&count, &position)
+
+		if err != nil {
+			return err
+		}
+
+		if maxPins > 0 && count >= maxPins {
+			return storageErrors.ErrPinLimitReached
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO comment_pin (comment_id, post_id, position)
+			VALUES ($1, $2, $3)`,
+			commentID, postID, position,
+		)
+
+		return err
+	})
+
+	if errors.Is(err, storageErrors.ErrCommentNotFound) || errors.Is(err, storageErrors.ErrPinLimitReached) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (cs *CommentPostgresStorage) UnpinComment(ctx context.Context, postID, commentID int64) error {
+	const op = "storage.postgres.comment.UnpinComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		DELETE FROM comment_pin
+		WHERE post_id=$1 AND comment_id=$2`,
+		postID, commentID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		return storageErrors.ErrPinNotFound
+	}
+
+	return nil
+}
+
+func (cs *CommentPostgresStorage) GetPinnedComments(ctx context.Context, postID int64) ([]models.Comment, error) {
+	const op = "storage.postgres.comment.GetPinnedComments"
+
+	rows, err := cs.reads.QueryContext(ctx, `
+		SELECT c.id, c.post_id, c.parent_id, c.reply_to_id, c.depth, c.author, c.content, c.status, c.created_at, c.version, TRUE
+		FROM comment_pin p
+		JOIN comment c ON c.id = p.comment_id
+		WHERE p.post_id = $1
+		ORDER BY p.position ASC`,
+		postID,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	comments := make([]models.Comment, 0)
+
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.ParentID,
+			&comment.ReplyToID,
+			&comment.Depth,
+			&comment.Author,
+			&comment.Content,
+			&comment.Status,
+			&comment.CreatedAt,
+			&comment.Version,
+			&comment.Pinned,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return comments, nil
+}
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+type IdempotencyPostgresStorage struct {
+	db storageDB
+}
+
+func NewPostgresIdempotencyStorage(db *sql.DB) *IdempotencyPostgresStorage {
+	return &IdempotencyPostgresStorage{db: traced(db)}
+}
+
+func (is *IdempotencyPostgresStorage) ReserveKey(ctx context.Context, scope, key, requestHash string, expiresAt time.Time) (models.IdempotencyKey, bool, error) {
+	const op = "storage.postgres.idempotency.ReserveKey"
+
+	var record models.IdempotencyKey
+	created := true
+
+	err := inTx(ctx, is.db, func(tx storageDB) error {
+		// An expired key is taken over by the new request. ON CONFLICT locks
+		// the existing row even when it is not updated, so the SELECT below
+		// reads a row that cannot be released concurrently.
+		var err error
+		record, err = scanIdempotencyKey(tx.QueryRowContext(ctx, `
+			INSERT INTO idempotency_key (scope, key, request_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (scope, key) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash,
+				resource_id = NULL,
+				created_at = NOW(),
+				expires_at = EXCLUDED.expires_at
+			WHERE idempotency_key.expires_at <= NOW()
+			RETURNING scope, key, request_hash, resource_id, created_at, expires_at`,
+			scope, key, requestHash, expiresAt,
+		))
+
+		if errors.Is(err, sql.ErrNoRows) {
+			created = false
+			record, err = scanIdempotencyKey(tx.QueryRowContext(ctx, `
+				SELECT scope, key, request_hash, resource_id, created_at, expires_at
+				FROM idempotency_key
+				WHERE scope=$1 AND key=$2`,
+				scope, key,
+			))
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return models.IdempotencyKey{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return record, created, nil
+}
+
+func (is *IdempotencyPostgresStorage) CompleteKey(ctx context.Context, scope, key string, resourceID int64, expiresAt time.Time) error {
+	const op = "storage.postgres.idempotency.CompleteKey"
+
+	_, err := is.db.ExecContext(ctx, `
+		UPDATE idempotency_key
+		SET resource_id = $3, expires_at = $4
+		WHERE scope=$1 AND key=$2`,
+		scope, key, resourceID, expiresAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (is *IdempotencyPostgresStorage) ReleaseKey(ctx context.Context, scope, key string) error {
+	const op = "storage.postgres.idempotency.ReleaseKey"
+
+	_, err := is.db.ExecContext(ctx, `
+		DELETE FROM idempotency_key
+		WHERE scope=$1 AND key=$2 AND resource_id IS NULL`,
+		scope, key,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (is *IdempotencyPostgresStorage) DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error) {
+	const op = "storage.postgres.idempotency.DeleteExpiredKeys"
+
+	result, err := is.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE expires_at <= $1`, now)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+func scanIdempotencyKey(row *sql.Row) (models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	var resourceID sql.NullInt64
+
+	err := row.Scan(
+		&record.Scope,
+		&record.Key,
+		&record.RequestHash,
+		&resourceID,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+
+	record.ResourceID = resourceID.Int64
+
+	return record, err
+}
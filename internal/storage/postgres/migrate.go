@@ -0,0 +1,374 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID keys the advisory lock that serialises migrations between
+// replicas starting at the same time.
+const migrationLockID int64 = 0x636f6d6d656e7473
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+
+	up   string
+	down string
+}
+
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is nil for pending migrations.
+	AppliedAt *time.Time
+}
+
+// Migrator applies the SQL files embedded under migrations/. Every version
+// has an up and a down file, and applied versions are recorded in
+// schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	const op = "storage.postgres.NewMigrator"
+
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type files struct {
+		migration Migration
+		up, down  bool
+	}
+
+	byVersion := make(map[int64]*files)
+
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		f, exists := byVersion[version]
+		if !exists {
+			f = &files{migration: Migration{Version: version, Name: match[2]}}
+			byVersion[version] = f
+		}
+
+		if f.migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files named %q and %q", version, f.migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			f.up = true
+			f.migration.up = string(content)
+		} else {
+			f.down = true
+			f.migration.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for version := int64(1); version <= int64(len(byVersion)); version++ {
+		f, exists := byVersion[version]
+
+		switch {
+		case !exists:
+			return nil, fmt.Errorf("migration %d is missing", version)
+		case !f.up:
+			return nil, fmt.Errorf("migration %d has no up file", version)
+		case !f.down:
+			return nil, fmt.Errorf("migration %d has no down file", version)
+		}
+
+		migrations = append(migrations, f.migration)
+	}
+
+	return migrations, nil
+}
+
+// Up applies every pending migration and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	const op = "storage.postgres.Migrator.Up"
+
+	var applied []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, exists := done[migration.Version]; exists {
+				continue
+			}
+
+			if err := run(ctx, conn, migration.up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return applied, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return applied, nil
+}
+
+// Down reverts the latest steps applied migrations and returns them. steps
+// must be at least 1.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	const op = "storage.postgres.Migrator.Down"
+
+	if steps < 1 {
+		return nil, fmt.Errorf("%s: steps must be at least 1, got %d", op, steps)
+	}
+
+	var reverted []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			migration, known := m.migration(version)
+			if !known {
+				return fmt.Errorf("migration %d is not known to this binary", version)
+			}
+
+			if err := run(ctx, conn, migration.down,
+				`DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return reverted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reverted, nil
+}
+
+// Status lists the known migrations and when they were applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	const op = "storage.postgres.Migrator.Status"
+
+	done, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+
+		if appliedAt, exists := done[migration.Version]; exists {
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Check returns storageErrors.ErrSchemaBehind when migrations are pending. A schema ahead
+// of the binary passes, so an older replica keeps running during a rollout.
+func (m *Migrator) Check(ctx context.Context) error {
+	const op = "storage.postgres.Migrator.Check"
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("%s: %w: %d pending migrations", op, storageErrors.ErrSchemaBehind, pending)
+	}
+
+	return nil
+}
+
+func (m *Migrator) migration(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+
+	return Migration{}, false
+}
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock, after making sure schema_migrations exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+
+	// Unlock even when ctx is cancelled, or the lock stays with the pooled
+	// connection.
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations(
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT NOW() NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// run executes a migration script and its bookkeeping statement in one
+// transaction.
+func run(ctx context.Context, conn *sql.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !isEmptyScript(script) {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func isEmptyScript(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+
+	return true
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, q querier) (map[int64]time.Time, error) {
+	var exists bool
+
+	if err := q.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]time.Time)
+
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
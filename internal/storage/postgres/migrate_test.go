@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrator.migrations)
+
+	for i, migration := range migrator.migrations {
+		assert.Equal(t, int64(i+1), migration.Version)
+		assert.False(t, isEmptyScript(migration.up), "migration %d has an empty up script", migration.Version)
+	}
+}
+
+func TestDownRejectsInvalidSteps(t *testing.T) {
+	migrator, err := NewMigrator(nil)
+	assert.NoError(t, err)
+
+	for _, steps := range []int{0, -1} {
+		reverted, err := migrator.Down(context.Background(), steps)
+		assert.Error(t, err)
+		assert.Empty(t, reverted)
+	}
+}
+
+func TestLoadMigrationsRejectsBrokenSets(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"m/0001_init.up.sql": file,
+		},
+		"gap": {
+			"m/0001_init.up.sql":   file,
+			"m/0001_init.down.sql": file,
+			"m/0003_next.up.sql":   file,
+			"m/0003_next.down.sql": file,
+		},
+		"name mismatch": {
+			"m/0001_init.up.sql":    file,
+			"m/0001_other.down.sql": file,
+		},
+		"stray file": {
+			"m/0001_init.up.sql":   file,
+			"m/0001_init.down.sql": file,
+			"m/README.md":          file,
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadMigrations(fsys, "m")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIsEmptyScript(t *testing.T) {
+	assert.True(t, isEmptyScript("-- nothing to undo\n\n"))
+	assert.False(t, isEmptyScript("-- drop it\nDROP TABLE post;"))
+}
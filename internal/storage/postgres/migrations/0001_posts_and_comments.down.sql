@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS comment_pin;
+DROP TABLE IF EXISTS comment_lock;
+DROP TABLE IF EXISTS comment;
+DROP TABLE IF EXISTS post;
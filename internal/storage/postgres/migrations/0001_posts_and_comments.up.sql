@@ -0,0 +1,63 @@
+-- Databases created before migrations existed already have these tables,
+-- possibly without the columns added later, so everything here is
+-- idempotent.
+CREATE TABLE IF NOT EXISTS post(
+	id SERIAL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	author VARCHAR(64) NOT NULL DEFAULT '',
+	status VARCHAR(16) NOT NULL DEFAULT 'PUBLISHED',
+	publish_at TIMESTAMP NULL,
+	comments_disabled BOOLEAN NOT NULL,
+	created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	version BIGINT NOT NULL DEFAULT 1
+);
+ALTER TABLE post ADD COLUMN IF NOT EXISTS author VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE post ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'PUBLISHED';
+ALTER TABLE post ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP NULL;
+ALTER TABLE post ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_post_created_at ON post(created_at);
+CREATE INDEX IF NOT EXISTS idx_post_scheduled ON post(publish_at) WHERE status = 'SCHEDULED';
+
+CREATE TABLE IF NOT EXISTS comment(
+	id SERIAL PRIMARY KEY,
+	post_id INTEGER NOT NULL,
+	parent_id INTEGER NULL,
+	reply_to_id INTEGER NULL,
+	depth INTEGER NOT NULL DEFAULT 0,
+	author VARCHAR(64) NOT NULL DEFAULT '',
+	content TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'VISIBLE',
+	created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	version BIGINT NOT NULL DEFAULT 1,
+	FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE,
+	FOREIGN KEY (parent_id) REFERENCES comment(id) ON DELETE CASCADE,
+	FOREIGN KEY (reply_to_id) REFERENCES comment(id) ON DELETE SET NULL
+);
+ALTER TABLE comment ADD COLUMN IF NOT EXISTS author VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE comment ADD COLUMN IF NOT EXISTS reply_to_id INTEGER NULL REFERENCES comment(id) ON DELETE SET NULL;
+ALTER TABLE comment ADD COLUMN IF NOT EXISTS depth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comment ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE comment ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'VISIBLE';
+CREATE INDEX IF NOT EXISTS idx_comment_post_id ON comment(post_id);
+CREATE INDEX IF NOT EXISTS idx_comment_parent_id ON comment(parent_id);
+CREATE INDEX IF NOT EXISTS idx_comment_created_at ON comment(created_at);
+
+CREATE TABLE IF NOT EXISTS comment_lock(
+	comment_id INTEGER PRIMARY KEY,
+	reason TEXT NOT NULL,
+	locked_by VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	expires_at TIMESTAMP NULL,
+	FOREIGN KEY (comment_id) REFERENCES comment(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS comment_pin(
+	comment_id INTEGER PRIMARY KEY,
+	post_id INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	pinned_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	FOREIGN KEY (comment_id) REFERENCES comment(id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_comment_pin_post_id ON comment_pin(post_id, position);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS notification(
+	id SERIAL PRIMARY KEY,
+	recipient VARCHAR(64) NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	post_id INTEGER NOT NULL,
+	comment_id INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	read_at TIMESTAMP NULL,
+	FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE,
+	FOREIGN KEY (comment_id) REFERENCES comment(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_notification_recipient_id ON notification(recipient, id DESC);
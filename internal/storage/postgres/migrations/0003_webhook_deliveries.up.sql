@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webhook_delivery(
+	id BIGSERIAL PRIMARY KEY,
+	event VARCHAR(64) NOT NULL,
+	endpoint TEXT NOT NULL,
+	payload BYTEA NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	delivered_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due ON webhook_delivery(next_attempt_at) WHERE status = 'PENDING';
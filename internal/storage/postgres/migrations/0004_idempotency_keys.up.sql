@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS idempotency_key(
+	scope VARCHAR(64) NOT NULL,
+	key VARCHAR(255) NOT NULL,
+	request_hash VARCHAR(64) NOT NULL,
+	resource_id BIGINT NULL,
+	created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (scope, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_key_expires_at ON idempotency_key(expires_at);
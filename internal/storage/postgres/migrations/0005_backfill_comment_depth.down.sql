@@ -0,0 +1 @@
+-- Correct depths are kept; there is nothing to undo.
@@ -0,0 +1,10 @@
+-- The depth column was added to existing databases with a default of 0,
+-- which is wrong for every reply stored before it.
+WITH RECURSIVE tree AS (
+	SELECT id, 0 AS depth FROM comment WHERE parent_id IS NULL
+	UNION ALL
+	SELECT c.id, tree.depth + 1 FROM comment c JOIN tree ON c.parent_id = tree.id
+)
+UPDATE comment SET depth = tree.depth
+FROM tree
+WHERE comment.id = tree.id AND comment.depth <> tree.depth;
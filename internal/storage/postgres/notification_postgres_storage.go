@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+)
+
+type NotificationPostgresStorage struct {
+	db storageDB
+}
+
+func NewPostgresNotificationStorage(db *sql.DB) *NotificationPostgresStorage {
+	return &NotificationPostgresStorage{db: traced(db)}
+}
+
+func (ns *NotificationPostgresStorage) CreateNotification(ctx context.Context, recipient, notificationType string, postID, commentID int64) (int64, error) {
+	const op = "storage.postgres.notification.CreateNotification"
+
+	var id int64
+	err := ns.db.QueryRowContext(ctx, `
+		INSERT INTO notification (recipient, type, post_id, comment_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		recipient, notificationType, postID, commentID,
+	).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (ns *NotificationPostgresStorage) GetNotificationByID(ctx context.Context, id int64) (models.Notification, error) {
+	const op = "storage.postgres.notification.GetNotificationByID"
+
+	notification := models.Notification{}
+
+	row := ns.db.QueryRowContext(ctx, `
+		SELECT id, recipient, type, post_id, comment_id, created_at, read_at
+		FROM notification
+		WHERE id=$1`,
+		id,
+	)
+
+	err := row.Scan(
+		&notification.ID,
+		&notification.Recipient,
+		&notification.Type,
+		&notification.PostID,
+		&notification.CommentID,
+		&notification.CreatedAt,
+		&notification.ReadAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Notification{}, storageErrors.ErrNotificationNotFound
+		}
+		return models.Notification{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return notification, nil
+}
+
+func (ns *NotificationPostgresStorage) GetNotificationsByRecipient(ctx context.Context, recipient string, unreadOnly bool, first *int32, after *int64) ([]models.Notification, error) {
+	const op = "storage.postgres.notification.GetNotificationsByRecipient"
+
+	rows, err := ns.db.QueryContext(ctx, `
+		SELECT id, recipient, type, post_id, comment_id, created_at, read_at
+		FROM notification
+		WHERE recipient = $1
+		AND (NOT $2 OR read_at IS NULL)
+		AND ($3::BIGINT IS NULL OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4`,
+		recipient, unreadOnly, after, first,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	notifications := make([]models.Notification, 0)
+
+	for rows.Next() {
+		var notification models.Notification
+		err := rows.Scan(
+			&notification.ID,
+			&notification.Recipient,
+			&notification.Type,
+			&notification.PostID,
+			&notification.CommentID,
+			&notification.CreatedAt,
+			&notification.ReadAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return notifications, nil
+}
+
+func (ns *NotificationPostgresStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []int64) (int64, error) {
+	const op = "storage.postgres.notification.MarkNotificationsRead"
+
+	var result sql.Result
+	var err error
+
+	if ids == nil {
+		result, err = ns.db.ExecContext(ctx, `
+		UPDATE notification
+		SET read_at = NOW()
+		WHERE recipient = $1
+		AND read_at IS NULL`, recipient)
+	} else {
+		result, err = ns.db.ExecContext(ctx, `
+		UPDATE notification
+		SET read_at = NOW()
+		WHERE recipient = $1
+		AND read_at IS NULL
+		AND id = ANY($2)`, recipient, pq.Array(ids))
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return marked, nil
+}
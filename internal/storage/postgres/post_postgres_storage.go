@@ -5,45 +5,56 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/Pacahar/graphql-comments/internal/constants"
 	"github.com/Pacahar/graphql-comments/internal/models"
 	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
 )
 
 type PostPostgresStorage struct {
-	db *sql.DB
+	db storageDB
+	// reads serves GetPostByID and GetAllPosts, which may go to a replica.
+	reads storageDB
 }
 
-func NewPostgresPostStorage(db *sql.DB) (*PostPostgresStorage, error) {
-	const op = "storage.postgres.NewPostgresPostStorage"
+func NewPostgresPostStorage(db *sql.DB) *PostPostgresStorage {
+	return &PostPostgresStorage{db: traced(db), reads: traced(db)}
+}
 
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS post(
-			id SERIAL PRIMARY KEY,
-			title VARCHAR(255) NOT NULL,
-			content TEXT NOT NULL,
-			comments_disabled BOOLEAN NOT NULL,
-			created_at TIMESTAMP DEFAULT NOW() NOT NULL
-		);
-		CREATE INDEX IF NOT EXISTS idx_post_created_at ON post(created_at);
-	`)
+func (ps *PostPostgresStorage) CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error) {
+	const op = "storage.postgres.post.CreatePost"
+
+	var id int64
+	err := ps.db.QueryRowContext(ctx, `
+		INSERT INTO post (title, content, author, status, publish_at, comments_disabled)
+		VALUES ($1, $2, $3, $4::VARCHAR, CASE WHEN $4::VARCHAR = 'PUBLISHED' THEN NOW() END, $5)
+		RETURNING id`,
+		title, content, author, status, commentsDisabled,
+	).Scan(&id)
 
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &PostPostgresStorage{db: db}, nil
+	return id, nil
 }
 
-func (ps *PostPostgresStorage) CreatePost(ctx context.Context, title, content string, commentsDisabled bool) (int64, error) {
-	const op = "storage.postgres.post.CreatePost"
+func (ps *PostPostgresStorage) ImportPost(ctx context.Context, post models.Post) (int64, error) {
+	const op = "storage.postgres.post.ImportPost"
+
+	var publishAt *time.Time
+	if post.PublishAt != nil {
+		val := post.PublishAt.UTC()
+		publishAt = &val
+	}
 
 	var id int64
 	err := ps.db.QueryRowContext(ctx, `
-		INSERT INTO post (title, content, comments_disabled)
-		VALUES ($1, $2, $3)
+		INSERT INTO post (title, content, author, status, publish_at, comments_disabled, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id`,
-		title, content, commentsDisabled,
+		post.Title, post.Content, post.Author, post.Status, publishAt, post.CommentsDisabled, post.CreatedAt.UTC(),
 	).Scan(&id)
 
 	if err != nil {
@@ -58,10 +69,10 @@ func (ps *PostPostgresStorage) GetPostByID(ctx context.Context, id int64) (model
 
 	post := models.Post{}
 
-	row := ps.db.QueryRowContext(ctx, `
-		SELECT id, title, content, comments_disabled, created_at 
+	row := ps.reads.QueryRowContext(ctx, `
+		SELECT id, title, content, author, status, publish_at, comments_disabled, created_at, version
 		FROM post 
-		WHERE id=$1`,
+		WHERE id=$1 `+rowLock(ps.reads),
 		id,
 	)
 
@@ -69,8 +80,12 @@ func (ps *PostPostgresStorage) GetPostByID(ctx context.Context, id int64) (model
 		&post.ID,
 		&post.Title,
 		&post.Content,
+		&post.Author,
+		&post.Status,
+		&post.PublishAt,
 		&post.CommentsDisabled,
 		&post.CreatedAt,
+		&post.Version,
 	)
 
 	if err != nil {
@@ -88,10 +103,10 @@ func (ps *PostPostgresStorage) GetAllPosts(ctx context.Context) ([]models.Post,
 
 	posts := make([]models.Post, 0)
 
-	rows, err := ps.db.QueryContext(ctx, `
-		SELECT id, title, content, comments_disabled, created_at
+	rows, err := ps.reads.QueryContext(ctx, `
+		SELECT id, title, content, author, status, publish_at, comments_disabled, created_at, version
 		FROM post
-		ORDER BY created_at ASC`,
+		ORDER BY created_at ASC, id ASC`,
 	)
 
 	if err != nil {
@@ -106,8 +121,12 @@ func (ps *PostPostgresStorage) GetAllPosts(ctx context.Context) ([]models.Post,
 			&post.ID,
 			&post.Title,
 			&post.Content,
+			&post.Author,
+			&post.Status,
+			&post.PublishAt,
 			&post.CommentsDisabled,
 			&post.CreatedAt,
+			&post.Version,
 		)
 
 		if err != nil {
@@ -124,18 +143,139 @@ func (ps *PostPostgresStorage) GetAllPosts(ctx context.Context) ([]models.Post,
 	return posts, nil
 }
 
-func (ps *PostPostgresStorage) DeletePost(ctx context.Context, id int64) error {
+func (ps *PostPostgresStorage) UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error {
+	const op = "storage.postgres.post.UpdatePost"
+
+	result, err := ps.db.ExecContext(ctx, `
+		UPDATE post
+		SET title = $2, content = $3, version = version + 1
+		WHERE id=$1
+		AND ($4::BIGINT IS NULL OR version = $4)`,
+		id, title, content, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+func (ps *PostPostgresStorage) SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error {
+	const op = "storage.postgres.post.SetCommentsDisabled"
+
+	result, err := ps.db.ExecContext(ctx, `
+		UPDATE post
+		SET comments_disabled = $2, version = version + 1
+		WHERE id=$1
+		AND ($3::BIGINT IS NULL OR version = $3)`,
+		id, disabled, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+func (ps *PostPostgresStorage) SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error {
+	const op = "storage.postgres.post.SetPostStatus"
+
+	result, err := ps.db.ExecContext(ctx, `
+		UPDATE post
+		SET status = $2, publish_at = COALESCE($3, publish_at), version = version + 1
+		WHERE id=$1
+		AND ($4::BIGINT IS NULL OR version = $4)`,
+		id, status, publishAt, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+func (ps *PostPostgresStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]int64, error) {
+	const op = "storage.postgres.post.PublishDuePosts"
+
+	rows, err := ps.db.QueryContext(ctx, `
+		UPDATE post
+		SET status = $2, version = version + 1
+		WHERE status = $3
+		AND publish_at <= $1
+		RETURNING id`,
+		now, constants.PostPublished, constants.PostScheduled,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	published := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		published = append(published, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return published, nil
+}
+
+func (ps *PostPostgresStorage) DeletePost(ctx context.Context, id int64, expectedVersion *int64) error {
 	const op = "storage.postgres.post.DeletePost"
 
-	_, err := ps.db.ExecContext(ctx, `
+	result, err := ps.db.ExecContext(ctx, `
 		DELETE FROM post
-		WHERE id=$1`,
-		id,
+		WHERE id=$1
+		AND ($2::BIGINT IS NULL OR version = $2)`,
+		id, expectedVersion,
 	)
 
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	if expectedVersion == nil {
+		return nil
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+// checkUpdated tells apart the two reasons a version guarded statement can
+// affect no rows: the post is gone, or its version has moved on.
+func (ps *PostPostgresStorage) checkUpdated(ctx context.Context, op string, result sql.Result, id int64) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = ps.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM post WHERE id=$1)`, id).Scan(&exists)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if exists {
+		return storageErrors.ErrVersionConflict
+	}
+
+	return storageErrors.ErrPostNotFound
 }
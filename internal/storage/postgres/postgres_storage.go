@@ -1,13 +1,21 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
+	"github.com/Pacahar/graphql-comments/internal/constants"
 	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
-func NewPostgresStorage(dsn string) (*storage.Storage, error) {
+// NewPostgresStorage connects to dsn and brings the schema up to date
+// according to migrations: constants.MigrationsAuto applies pending
+// migrations, constants.MigrationsRequire refuses to start when any are
+// pending and constants.MigrationsOff leaves the schema alone. Reads of
+// posts and comments go to replicas when there are any.
+func NewPostgresStorage(ctx context.Context, dsn string, migrations string, replicaCfg Replicas) (*storage.Storage, error) {
 	const op = "storage.postgres.NewPostgresStorage"
 
 	db, err := sql.Open("postgres", dsn)
@@ -16,18 +24,94 @@ func NewPostgresStorage(dsn string) (*storage.Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	PostgresPostStorage, err := NewPostgresPostStorage(db)
+	migrator, err := prepareSchema(ctx, db, migrations)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	st := &storage.Storage{
+		Post:         NewPostgresPostStorage(db),
+		Comment:      NewPostgresCommentStorage(db),
+		Notification: NewPostgresNotificationStorage(db),
+		Webhook:      NewPostgresWebhookStorage(db),
+		Idempotency:  NewPostgresIdempotencyStorage(db),
+		Transactor:   &transactor{db: db},
+		Pinger:       &pinger{db: db, migrator: migrator},
+		Closer:       db,
+		Collector:    collectors.NewDBStatsCollector(db, "postgres"),
+	}
+
+	if len(replicaCfg.DSNs) == 0 {
+		return st, nil
+	}
+
+	r, err := openReplicas(ctx, db, replicaCfg)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Writes pin their client to the primary, reads go through r. The
+	// other storages stay on the primary.
+	primary := traced(primaryDB{DB: db, replicas: r})
+
+	st.Post = &PostPostgresStorage{db: primary, reads: r}
+	st.Comment = &CommentPostgresStorage{db: primary, reads: r}
+	st.Transactor = &transactor{db: db, replicas: r}
+	st.Closer = r
+	st.Replicas = r
+	st.Collector = r.collector()
+
+	return st, nil
+}
+
+// prepareSchema applies or checks the migrations and returns the migrator
+// for health checks, which is nil when migrations are managed outside the
+// service.
+func prepareSchema(ctx context.Context, db *sql.DB, migrations string) (*Migrator, error) {
+	if migrations == constants.MigrationsOff {
+		return nil, nil
+	}
+
+	migrator, err := NewMigrator(db)
 	if err != nil {
 		return nil, err
 	}
 
-	PostgresCommentStorage, err := NewPostgresCommentStorage(db)
+	switch migrations {
+	case constants.MigrationsAuto, "":
+		_, err = migrator.Up(ctx)
+	case constants.MigrationsRequire:
+		err = migrator.Check(ctx)
+	default:
+		err = fmt.Errorf("unknown migrations mode %q", migrations)
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
-	return &storage.Storage{
-		Post:    PostgresPostStorage,
-		Comment: PostgresCommentStorage,
-	}, nil
+	return migrator, nil
+}
+
+// pinger checks the connection and, unless migrations are managed outside
+// the service, that no migration is pending.
+type pinger struct {
+	db       *sql.DB
+	migrator *Migrator
+}
+
+func (p *pinger) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := p.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if p.migrator == nil {
+		return nil
+	}
+
+	return p.migrator.Check(ctx)
 }
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStorage connects to the database in POSTGRES_TEST_DSN and wipes it.
+// Tests using it are skipped without the variable.
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	st, err := NewPostgresStorage(ctx, dsn, constants.MigrationsAuto, Replicas{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { st.Close() })
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, `
+		TRUNCATE post, comment, comment_lock, comment_pin, notification, webhook_delivery, idempotency_key
+		RESTART IDENTITY CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return st
+}
+
+func TestConformance(t *testing.T) {
+	if os.Getenv("POSTGRES_TEST_DSN") == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	storagetest.Run(t, newTestStorage)
+}
+
+func TestCreatePostStatuses(t *testing.T) {
+	st := newTestStorage(t)
+	ctx := context.Background()
+
+	publishedID, err := st.Post.CreatePost(ctx, "Published", "Content", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	draftID, err := st.Post.CreatePost(ctx, "Draft", "Content", "alice", constants.PostDraft, true)
+	assert.NoError(t, err)
+
+	published, err := st.Post.GetPostByID(ctx, publishedID)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.PostPublished, published.Status)
+	assert.NotNil(t, published.PublishAt)
+
+	draft, err := st.Post.GetPostByID(ctx, draftID)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.PostDraft, draft.Status)
+	assert.Nil(t, draft.PublishAt)
+	assert.True(t, draft.CommentsDisabled)
+}
@@ -0,0 +1,280 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Replicas lists read replicas of the primary database. Without DSNs every
+// query goes to the primary.
+type Replicas struct {
+	DSNs []string
+	// ReadYourWrites is how long a client reads from the primary after it
+	// writes, so that it sees its writes despite the replication lag.
+	// Clients are told apart by storage.WithClient.
+	ReadYourWrites time.Duration
+	// CheckInterval is how often replicas are pinged. Reads skip the ones
+	// that failed the last ping.
+	CheckInterval time.Duration
+}
+
+// replicas routes reads of posts and comments to the replicas in turn. It
+// is a storageDB for those reads only; writes stay on the primary.
+type replicas struct {
+	primary        *sql.DB
+	primaryTraced  storageDB
+	dbs            []*replica
+	next           atomic.Uint64
+	readYourWrites time.Duration
+
+	mu     sync.Mutex
+	pinned map[string]time.Time
+	// pruneAt is the size at which pin forgets expired pins, so that the
+	// map stays bounded without health checks pruning it.
+	pruneAt int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type replica struct {
+	conn    *sql.DB
+	db      storageDB
+	healthy atomic.Bool
+}
+
+func openReplicas(ctx context.Context, primary *sql.DB, cfg Replicas) (*replicas, error) {
+	r := &replicas{
+		primary:        primary,
+		primaryTraced:  traced(primary),
+		readYourWrites: cfg.ReadYourWrites,
+		pinned:         make(map[string]time.Time),
+	}
+
+	for _, dsn := range cfg.DSNs {
+		conn, err := sql.Open("postgres", dsn)
+		if err != nil {
+			r.closeReplicas()
+			return nil, err
+		}
+
+		r.dbs = append(r.dbs, &replica{conn: conn, db: traced(conn)})
+	}
+
+	// A replica that is down at startup is only skipped: the primary can
+	// serve its reads until it is back.
+	r.check(ctx, cfg.CheckInterval)
+
+	if cfg.CheckInterval > 0 {
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go r.run(cfg.CheckInterval)
+	}
+
+	return r, nil
+}
+
+func (r *replicas) run(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.check(context.Background(), interval)
+		}
+	}
+}
+
+// minPruneAt is the smallest pruneAt, so small maps are not pruned on
+// every pin.
+const minPruneAt = 1024
+
+// check pings every replica and forgets expired pins.
+func (r *replicas) check(ctx context.Context, timeout time.Duration) {
+	var wg sync.WaitGroup
+
+	for _, replica := range r.dbs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			pingCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				pingCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			replica.healthy.Store(replica.conn.PingContext(pingCtx) == nil)
+		}()
+	}
+
+	wg.Wait()
+
+	r.prune()
+}
+
+func (r *replicas) prune() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pruneLocked(time.Now())
+}
+
+func (r *replicas) pruneLocked(now time.Time) {
+	for client, until := range r.pinned {
+		if !now.Before(until) {
+			delete(r.pinned, client)
+		}
+	}
+
+	r.pruneAt = max(2*len(r.pinned), minPruneAt)
+}
+
+// pin sends the reads of ctx's client to the primary for a while. Nothing
+// is pinned without replicas or a client.
+func (r *replicas) pin(ctx context.Context) {
+	if r == nil || r.readYourWrites <= 0 {
+		return
+	}
+
+	client, ok := storage.ClientFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pinned) >= r.pruneAt {
+		r.pruneLocked(now)
+	}
+
+	r.pinned[client] = now.Add(r.readYourWrites)
+}
+
+// Pinned reports whether ctx's client is pinned to the primary.
+func (r *replicas) Pinned(ctx context.Context) bool {
+	client, ok := storage.ClientFromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, pinned := r.pinned[client]
+	if pinned && !time.Now().Before(until) {
+		delete(r.pinned, client)
+		return false
+	}
+
+	return pinned
+}
+
+// pick returns the next healthy replica, or the primary when ctx asks for
+// it, ctx's client is pinned to it or no replica is healthy.
+func (r *replicas) pick(ctx context.Context) storageDB {
+	if len(r.dbs) == 0 || storage.PrimaryFromContext(ctx) || r.Pinned(ctx) {
+		return r.primaryTraced
+	}
+
+	start := r.next.Add(1)
+
+	for i := range uint64(len(r.dbs)) {
+		replica := r.dbs[(start+i)%uint64(len(r.dbs))]
+		if replica.healthy.Load() {
+			return replica.db
+		}
+	}
+
+	return r.primaryTraced
+}
+
+func (r *replicas) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return r.primaryTraced.ExecContext(ctx, query, args...)
+}
+
+func (r *replicas) QueryContext(ctx context.Context, query string, args ...any) (sqlRows, error) {
+	return r.pick(ctx).QueryContext(ctx, query, args...)
+}
+
+func (r *replicas) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return r.pick(ctx).QueryRowContext(ctx, query, args...)
+}
+
+func (r *replicas) collector() prometheus.Collector {
+	cs := storage.Collectors{collectors.NewDBStatsCollector(r.primary, "postgres")}
+
+	for i, replica := range r.dbs {
+		cs = append(cs, collectors.NewDBStatsCollector(replica.conn, fmt.Sprintf("postgres_replica_%d", i)))
+	}
+
+	return cs
+}
+
+// Close stops the health checks and closes the primary and the replicas.
+func (r *replicas) Close() error {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+	}
+
+	return errors.Join(r.primary.Close(), r.closeReplicas())
+}
+
+func (r *replicas) closeReplicas() error {
+	var errs []error
+
+	for _, replica := range r.dbs {
+		errs = append(errs, replica.conn.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// primaryDB runs statements on the primary and pins the client to it, so
+// that its next reads see what it wrote.
+type primaryDB struct {
+	*sql.DB
+	replicas *replicas
+}
+
+func (p primaryDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer p.replicas.pin(ctx)
+	return p.DB.ExecContext(ctx, query, args...)
+}
+
+func (p primaryDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer p.replicas.pin(ctx)
+	return p.DB.QueryContext(ctx, query, args...)
+}
+
+func (p primaryDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer p.replicas.pin(ctx)
+	return p.DB.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx pins when the transaction starts, which is close enough for the
+// short transactions of single storage calls. transactor pins on commit.
+func (p primaryDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	defer p.replicas.pin(ctx)
+	return p.DB.BeginTx(ctx, opts)
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type namedDB struct {
+	failingDB
+	name string
+}
+
+func newTestReplicas(names ...string) *replicas {
+	r := &replicas{
+		primaryTraced:  traced(namedDB{name: "primary"}),
+		readYourWrites: time.Minute,
+		pinned:         make(map[string]time.Time),
+	}
+
+	for _, name := range names {
+		replica := &replica{db: traced(namedDB{name: name})}
+		replica.healthy.Store(true)
+		r.dbs = append(r.dbs, replica)
+	}
+
+	return r
+}
+
+func picked(r *replicas, ctx context.Context) string {
+	return unwrap(r.pick(ctx)).(namedDB).name
+}
+
+func TestReplicasRoundRobin(t *testing.T) {
+	ctx := context.Background()
+	r := newTestReplicas("a", "b")
+
+	first := picked(r, ctx)
+	second := picked(r, ctx)
+
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first, picked(r, ctx))
+
+	r.dbs[0].healthy.Store(false)
+
+	assert.Equal(t, "b", picked(r, ctx))
+	assert.Equal(t, "b", picked(r, ctx))
+
+	r.dbs[1].healthy.Store(false)
+
+	assert.Equal(t, "primary", picked(r, ctx))
+}
+
+func TestReplicasReadYourWrites(t *testing.T) {
+	r := newTestReplicas("a")
+
+	alice := storage.WithClient(context.Background(), "alice")
+	bob := storage.WithClient(context.Background(), "bob")
+
+	r.pin(alice)
+	// Requests without a client are never pinned.
+	r.pin(context.Background())
+
+	assert.Equal(t, "primary", picked(r, alice))
+	assert.Equal(t, "a", picked(r, bob))
+	assert.Equal(t, "a", picked(r, context.Background()))
+
+	r.pinned["alice"] = time.Now().Add(-time.Second)
+
+	assert.Equal(t, "a", picked(r, alice))
+	assert.NotContains(t, r.pinned, "alice")
+
+	r.pinned["alice"] = time.Now().Add(-time.Second)
+
+	r.prune()
+	assert.Empty(t, r.pinned)
+}
+
+func TestReplicasPruneWithoutChecks(t *testing.T) {
+	r := newTestReplicas("a")
+	r.readYourWrites = time.Nanosecond
+
+	for i := range 10 * minPruneAt {
+		r.pin(storage.WithClient(context.Background(), fmt.Sprintf("client-%d", i)))
+	}
+
+	assert.LessOrEqual(t, len(r.pinned), minPruneAt)
+}
+
+func TestReplicasPrimaryReads(t *testing.T) {
+	r := newTestReplicas("a")
+
+	assert.Equal(t, "primary", picked(r, storage.WithPrimary(context.Background())))
+	assert.Equal(t, "a", picked(r, context.Background()))
+}
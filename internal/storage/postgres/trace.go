@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Pacahar/graphql-comments/internal/storage/postgres"
+
+// tracedDB opens a span with the SQL text for every statement run on db.
+// Spans are only recorded when a tracer provider is installed.
+type tracedDB struct {
+	db dbtx
+}
+
+func traced(db dbtx) tracedDB {
+	return tracedDB{db: db}
+}
+
+// unwrap returns the *sql.DB or *sql.Tx behind db.
+func unwrap(db storageDB) any {
+	if t, ok := db.(tracedDB); ok {
+		return t.db
+	}
+
+	return db
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+
+	result, err := t.db.ExecContext(ctx, query, args...)
+	recordError(span, err)
+
+	return result, err
+}
+
+// QueryContext returns rows that end the span when they are closed, so the
+// span covers reading them.
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...any) (sqlRows, error) {
+	ctx, span := startQuery(ctx, query)
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		recordError(span, err)
+		span.End()
+		return nil, err
+	}
+
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+// QueryRowContext runs the query right away, so the span covers the round
+// trip even though the row is scanned later.
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+
+	row := t.db.QueryRowContext(ctx, query, args...)
+	recordError(span, row.Err())
+
+	return row
+}
+
+type tracedRows struct {
+	*sql.Rows
+	span trace.Span
+	once sync.Once
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+
+	r.once.Do(func() {
+		recordError(r.span, r.Rows.Err())
+		r.span.End()
+	})
+
+	return err
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "postgres", trace.WithSpanKind(trace.SpanKindClient))
+	if !span.IsRecording() {
+		return ctx, span
+	}
+
+	// The statements are indented raw strings; one line reads better.
+	statement := strings.Join(strings.Fields(query), " ")
+
+	operation, _, _ := strings.Cut(statement, " ")
+	operation = strings.ToUpper(operation)
+
+	span.SetName(operation)
+	span.SetAttributes(
+		semconv.DBSystemNamePostgreSQL,
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(statement),
+	)
+
+	return ctx, span
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
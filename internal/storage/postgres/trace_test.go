@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type failingDB struct{}
+
+func (failingDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return nil
+}
+
+func TestTracedStatements(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	db := traced(failingDB{})
+
+	_, err := db.ExecContext(context.Background(), `
+		delete FROM post
+		WHERE id = $1`, 1)
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+
+	assert.Equal(t, "DELETE", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), attribute.String("db.query.text", "delete FROM post WHERE id = $1"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("db.system.name", "postgresql"))
+
+	assert.Equal(t, failingDB{}, unwrap(db))
+	assert.Equal(t, "", rowLock(db))
+}
+
+// rowsDriver answers every query with the rows 1 and 2.
+type rowsDriver struct{}
+
+func (rowsDriver) Open(name string) (driver.Conn, error) {
+	return rowsConn{}, nil
+}
+
+type rowsConn struct{}
+
+func (rowsConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (rowsConn) Close() error {
+	return nil
+}
+
+func (rowsConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (rowsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{values: []int64{1, 2}}, nil
+}
+
+type fakeRows struct {
+	values []int64
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	dest[0], r.values = r.values[0], r.values[1:]
+
+	return nil
+}
+
+func TestTracedRowsEndSpanOnClose(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	sql.Register("postgres-trace-test", rowsDriver{})
+
+	conn, err := sql.Open("postgres-trace-test", "")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	rows, err := traced(conn).QueryContext(context.Background(), `SELECT id FROM post`)
+	assert.NoError(t, err)
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		assert.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.Empty(t, recorder.Ended(), "the span must cover reading the rows")
+
+	assert.NoError(t, rows.Close())
+	assert.NoError(t, rows.Close())
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "SELECT", spans[0].Name())
+	}
+}
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// dbtx is implemented by both *sql.DB and *sql.Tx, so the same storage code
+// runs standalone and inside Storage.WithTx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// storageDB is a dbtx whose rows may be wrapped, so that the span of a traced
+// query ends when its rows are closed. The storages run their statements
+// through one.
+type storageDB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (sqlRows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqlRows is implemented by *sql.Rows.
+type sqlRows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+// beginner is implemented by *sql.DB and primaryDB.
+type beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// inTx runs fn in a new transaction, or in the surrounding one when db
+// already is a transaction.
+func inTx(ctx context.Context, db storageDB, fn func(tx storageDB) error) error {
+	sqlDB, ok := unwrap(db).(beginner)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(traced(tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rowLock is appended to single-row reads, so that inside a transaction
+// the row read cannot change until commit and checks made on it hold. The
+// lock is exclusive: transactions go on to write the row they read, and two
+// of them upgrading a shared lock deadlock each other. Lock a post before
+// its comments, so that transactions touching both queue in the same order.
+func rowLock(db storageDB) string {
+	if _, ok := unwrap(db).(*sql.Tx); ok {
+		return "FOR UPDATE"
+	}
+
+	return ""
+}
+
+type transactor struct {
+	db *sql.DB
+	// replicas is nil without read replicas.
+	replicas *replicas
+}
+
+func (t *transactor) WithTx(ctx context.Context, fn func(ctx context.Context, tx storage.Storage) error) error {
+	const op = "storage.postgres.WithTx"
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(ctx, bindStorage(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	t.replicas.pin(ctx)
+
+	return nil
+}
+
+// bindStorage returns storages that run every query on tx.
+func bindStorage(tx *sql.Tx) storage.Storage {
+	return storage.Storage{
+		Post:         &PostPostgresStorage{db: traced(tx), reads: traced(tx)},
+		Comment:      &CommentPostgresStorage{db: traced(tx), reads: traced(tx)},
+		Notification: &NotificationPostgresStorage{db: traced(tx)},
+		Webhook:      &WebhookPostgresStorage{db: traced(tx)},
+		Idempotency:  &IdempotencyPostgresStorage{db: traced(tx)},
+	}
+}
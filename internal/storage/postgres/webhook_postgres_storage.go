@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+type WebhookPostgresStorage struct {
+	db storageDB
+}
+
+func NewPostgresWebhookStorage(db *sql.DB) *WebhookPostgresStorage {
+	return &WebhookPostgresStorage{db: traced(db)}
+}
+
+func (ws *WebhookPostgresStorage) EnqueueDelivery(ctx context.Context, event, endpoint string, payload []byte) (int64, error) {
+	const op = "storage.postgres.webhook.EnqueueDelivery"
+
+	var id int64
+	err := ws.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_delivery (event, endpoint, payload, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		event, endpoint, payload, constants.WebhookDeliveryPending,
+	).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (ws *WebhookPostgresStorage) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	const op = "storage.postgres.webhook.ClaimDueDeliveries"
+
+	rows, err := ws.db.QueryContext(ctx, `
+		WITH claimed AS (
+			UPDATE webhook_delivery
+			SET next_attempt_at = $2
+			WHERE id IN (
+				SELECT id
+				FROM webhook_delivery
+				WHERE status = $3
+				AND next_attempt_at <= $1
+				ORDER BY id ASC
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, event, endpoint, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+		)
+		SELECT id, event, endpoint, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+		FROM claimed
+		ORDER BY id ASC`,
+		now, now.Add(lease), constants.WebhookDeliveryPending, limit,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scanWebhookDeliveries(op, rows)
+}
+
+func (ws *WebhookPostgresStorage) MarkDeliverySucceeded(ctx context.Context, id int64) error {
+	const op = "storage.postgres.webhook.MarkDeliverySucceeded"
+
+	_, err := ws.db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = $2, attempts = attempts + 1, last_error = '', delivered_at = NOW()
+		WHERE id = $1`,
+		id, constants.WebhookDeliveryDelivered,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (ws *WebhookPostgresStorage) MarkDeliveryFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error {
+	const op = "storage.postgres.webhook.MarkDeliveryFailed"
+
+	var err error
+
+	if nextAttemptAt == nil {
+		_, err = ws.db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = $3, attempts = attempts + 1, last_error = $2
+		WHERE id = $1`,
+			id, lastError, constants.WebhookDeliveryFailed,
+		)
+	} else {
+		_, err = ws.db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $1`,
+			id, lastError, *nextAttemptAt,
+		)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (ws *WebhookPostgresStorage) GetDeliveries(ctx context.Context, status *string, limit *int32, offset *int32) ([]models.WebhookDelivery, error) {
+	const op = "storage.postgres.webhook.GetDeliveries"
+
+	rows, err := ws.db.QueryContext(ctx, `
+		SELECT id, event, endpoint, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+		FROM webhook_delivery
+		WHERE ($1::VARCHAR IS NULL OR status = $1)
+		ORDER BY id DESC
+		LIMIT $2
+		OFFSET COALESCE($3, 0)`,
+		status, limit, offset,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scanWebhookDeliveries(op, rows)
+}
+
+func scanWebhookDeliveries(op string, rows sqlRows) ([]models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.Event,
+			&delivery.Endpoint,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.LastError,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,553 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+)
+
+type CommentSQLiteStorage struct {
+	db dbtx
+}
+
+func NewSQLiteCommentStorage(db *sql.DB) *CommentSQLiteStorage {
+	return &CommentSQLiteStorage{db: db}
+}
+
+func (cs *CommentSQLiteStorage) CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error) {
+	const op = "storage.sqlite.comment.CreateComment"
+
+	var id int64
+	err := cs.db.QueryRowContext(ctx, `
+		INSERT INTO comment (content, author, post_id, parent_id, reply_to_id, depth, created_at)
+		SELECT ?1, ?2, ?3, ?4, ?5, COALESCE((SELECT depth + 1 FROM comment WHERE id = ?4), 0), ?6
+		WHERE ?4 IS NULL OR EXISTS(SELECT 1 FROM comment WHERE id = ?4 AND post_id = ?3)
+		RETURNING id`,
+		content, author, postID, parentID, replyToID, timestamp(time.Now()),
+	).Scan(&id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storageErrors.ErrCommentNotFound
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (cs *CommentSQLiteStorage) ImportComment(ctx context.Context, comment models.Comment) (int64, error) {
+	const op = "storage.sqlite.comment.ImportComment"
+
+	var id int64
+	err := cs.db.QueryRowContext(ctx, `
+		INSERT INTO comment (content, author, post_id, parent_id, reply_to_id, depth, status, created_at)
+		SELECT ?1, ?2, ?3, ?4, ?5, COALESCE((SELECT depth + 1 FROM comment WHERE id = ?4), 0), COALESCE(NULLIF(?6, ''), 'VISIBLE'), ?7
+		WHERE ?4 IS NULL OR EXISTS(SELECT 1 FROM comment WHERE id = ?4 AND post_id = ?3)
+		RETURNING id`,
+		comment.Content, comment.Author, comment.PostID, comment.ParentID, comment.ReplyToID, comment.Status, timestamp(comment.CreatedAt),
+	).Scan(&id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storageErrors.ErrCommentNotFound
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (cs *CommentSQLiteStorage) GetCommentByID(ctx context.Context, id int64) (models.Comment, error) {
+	const op = "storage.sqlite.comment.GetCommentByID"
+
+	comment := models.Comment{}
+
+	row := cs.db.QueryRowContext(ctx, `
+		SELECT id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned
+		FROM comment
+		WHERE id=?1`,
+		id,
+	)
+
+	err := row.Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.ParentID,
+		&comment.ReplyToID,
+		&comment.Depth,
+		&comment.Author,
+		&comment.Content,
+		&comment.Status,
+		&comment.CreatedAt,
+		&comment.Version,
+		&comment.Pinned,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Comment{}, storageErrors.ErrCommentNotFound
+		}
+		return models.Comment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return comment, nil
+}
+
+func (cs *CommentSQLiteStorage) GetCommentsByParentID(ctx context.Context, parentID int64) ([]models.Comment, error) {
+	const op = "storage.sqlite.comment.GetCommentsByParentID"
+
+	rows, err := cs.db.QueryContext(ctx, `
+		SELECT id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned
+		FROM comment
+		WHERE parent_id = ?1
+		ORDER BY created_at ASC, id ASC`,
+		parentID,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scanComments(op, rows)
+}
+
+// GetCommentsByPostID returns the root comments of the post. Like the
+// Postgres storage, it pages only when both limit and offset are given.
+func (cs *CommentSQLiteStorage) GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) ([]models.Comment, error) {
+	const op = "storage.sqlite.comment.GetCommentsByPostID"
+
+	// A negative LIMIT means no limit in SQLite.
+	pageLimit, pageOffset := int32(-1), int32(0)
+	if limit != nil && offset != nil {
+		pageLimit, pageOffset = *limit, *offset
+	}
+
+	rows, err := cs.db.QueryContext(ctx, `
+		SELECT id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned
+		FROM comment
+		WHERE post_id = ?1
+		AND parent_id IS NULL
+		ORDER BY created_at ASC, id ASC
+		LIMIT ?2
+		OFFSET ?3`,
+		postID, pageLimit, pageOffset,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scanComments(op, rows)
+}
+
+func (cs *CommentSQLiteStorage) GetThread(ctx context.Context, postID int64, rootID *int64, maxDepth, limit int) ([]models.ThreadComment, error) {
+	const op = "storage.sqlite.comment.GetThread"
+
+	// SQLite has no arrays, so the path is built as comma separated IDs.
+	rows, err := cs.db.QueryContext(ctx, `
+		WITH RECURSIVE thread(id, level, path) AS (
+			SELECT id, 0, CAST(id AS TEXT)
+			FROM comment
+			WHERE post_id = ?1
+			AND ((?2 IS NULL AND parent_id IS NULL) OR id = ?2)
+			UNION ALL
+			SELECT comment.id, thread.level + 1, thread.path || ',' || comment.id
+			FROM comment
+			JOIN thread ON comment.parent_id = thread.id
+			WHERE ?3 = 0 OR thread.level < ?3
+		)
+		SELECT comment.id, post_id, parent_id, reply_to_id, depth, author, content, status, created_at, version,
+			EXISTS(SELECT 1 FROM comment_pin WHERE comment_pin.comment_id = comment.id) AS pinned,
+			thread.level, thread.path
+		FROM thread
+		JOIN comment ON comment.id = thread.id
+		ORDER BY thread.level ASC, created_at ASC, comment.id ASC
+		LIMIT CASE WHEN ?4 = 0 THEN -1 ELSE ?4 END`,
+		postID, rootID, maxDepth, limit,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	thread := make([]models.ThreadComment, 0)
+
+	for rows.Next() {
+		var comment models.ThreadComment
+		var path string
+
+		err := rows.Scan(
+			&comment.Comment.ID,
+			&comment.Comment.PostID,
+			&comment.Comment.ParentID,
+			&comment.Comment.ReplyToID,
+			&comment.Comment.Depth,
+			&comment.Comment.Author,
+			&comment.Comment.Content,
+			&comment.Comment.Status,
+			&comment.Comment.CreatedAt,
+			&comment.Comment.Version,
+			&comment.Comment.Pinned,
+			&comment.Depth,
+			&path,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, id := range strings.Split(path, ",") {
+			parsed, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			comment.Path = append(comment.Path, parsed)
+		}
+
+		thread = append(thread, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	// The root is always listed when it exists.
+	if rootID != nil && len(thread) == 0 {
+		return nil, storageErrors.ErrCommentNotFound
+	}
+
+	return thread, nil
+}
+
+func (cs *CommentSQLiteStorage) UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error {
+	const op = "storage.sqlite.comment.UpdateComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		UPDATE comment
+		SET content = ?2, version = version + 1
+		WHERE id=?1
+		AND (?3 IS NULL OR version = ?3)`,
+		id, content, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return cs.checkUpdated(ctx, op, result, id)
+}
+
+func (cs *CommentSQLiteStorage) DeleteComment(ctx context.Context, id int64, expectedVersion *int64) error {
+	const op = "storage.sqlite.comment.DeleteComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		DELETE FROM comment
+		WHERE id=?1
+		AND (?2 IS NULL OR version = ?2)`,
+		id, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if expectedVersion == nil {
+		return nil
+	}
+
+	return cs.checkUpdated(ctx, op, result, id)
+}
+
+// checkUpdated tells apart the two reasons a version guarded statement can
+// affect no rows: the comment is gone, or its version has moved on.
+func (cs *CommentSQLiteStorage) checkUpdated(ctx context.Context, op string, result sql.Result, id int64) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = cs.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM comment WHERE id=?1)`, id).Scan(&exists)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if exists {
+		return storageErrors.ErrVersionConflict
+	}
+
+	return storageErrors.ErrCommentNotFound
+}
+
+func (cs *CommentSQLiteStorage) DeleteCommentsByPostID(ctx context.Context, postID int64) error {
+	const op = "storage.sqlite.comment.DeleteCommentsByPostID"
+
+	_, err := cs.db.ExecContext(ctx, `
+		DELETE FROM comment
+		WHERE post_id=?1`,
+		postID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (cs *CommentSQLiteStorage) LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error {
+	const op = "storage.sqlite.comment.LockComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		INSERT INTO comment_lock (comment_id, reason, locked_by, created_at, expires_at)
+		SELECT id, ?2, ?3, ?5, ?4
+		FROM comment
+		WHERE id=?1
+		ON CONFLICT (comment_id) DO UPDATE
+		SET reason = excluded.reason,
+			locked_by = excluded.locked_by,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at`,
+		id, reason, lockedBy, nullTimestamp(expiresAt), timestamp(time.Now()),
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		return storageErrors.ErrCommentNotFound
+	}
+
+	return nil
+}
+
+func (cs *CommentSQLiteStorage) UnlockComment(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.comment.UnlockComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		DELETE FROM comment_lock
+		WHERE comment_id=?1`,
+		id,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		return storageErrors.ErrLockNotFound
+	}
+
+	return nil
+}
+
+func (cs *CommentSQLiteStorage) FindActiveLock(ctx context.Context, id int64, now time.Time) (models.CommentLock, error) {
+	const op = "storage.sqlite.comment.FindActiveLock"
+
+	lock := models.CommentLock{}
+
+	row := cs.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, 0 AS distance
+			FROM comment
+			WHERE id=?1
+			UNION ALL
+			SELECT c.id, c.parent_id, a.distance + 1
+			FROM comment c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT l.comment_id, l.reason, l.locked_by, l.created_at, l.expires_at
+		FROM ancestors a
+		JOIN comment_lock l ON l.comment_id = a.id
+		WHERE l.expires_at IS NULL OR l.expires_at > ?2
+		ORDER BY a.distance ASC
+		LIMIT 1`,
+		id, timestamp(now),
+	)
+
+	err := row.Scan(
+		&lock.CommentID,
+		&lock.Reason,
+		&lock.LockedBy,
+		&lock.CreatedAt,
+		&lock.ExpiresAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.CommentLock{}, storageErrors.ErrLockNotFound
+		}
+		return models.CommentLock{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return lock, nil
+}
+
+func (cs *CommentSQLiteStorage) PinComment(ctx context.Context, postID, commentID int64, maxPins int) error {
+	const op = "storage.sqlite.comment.PinComment"
+
+	// The transaction holds the database write lock, so concurrent pins
+	// cannot exceed maxPins.
+	err := inTx(ctx, cs.db, func(tx dbtx) error {
+		var pinned bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM comment_pin WHERE comment_id = comment.id)
+			FROM comment
+			WHERE id=?1 AND post_id=?2`,
+			commentID, postID,
+		).Scan(&pinned)
+
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storageErrors.ErrCommentNotFound
+			}
+			return err
+		}
+
+		if pinned {
+			return nil
+		}
+
+		var count, position int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COUNT(*), COALESCE(MAX(position), 0) + 1
+			FROM comment_pin
+			WHERE post_id=?1`,
+			postID,
+		).Scan(&count, &position)
+
+		if err != nil {
+			return err
+		}
+
+		if maxPins > 0 && count >= maxPins {
+			return storageErrors.ErrPinLimitReached
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO comment_pin (comment_id, post_id, position, pinned_at)
+			VALUES (?1, ?2, ?3, ?4)`,
+			commentID, postID, position, timestamp(time.Now()),
+		)
+
+		return err
+	})
+
+	if errors.Is(err, storageErrors.ErrCommentNotFound) || errors.Is(err, storageErrors.ErrPinLimitReached) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (cs *CommentSQLiteStorage) UnpinComment(ctx context.Context, postID, commentID int64) error {
+	const op = "storage.sqlite.comment.UnpinComment"
+
+	result, err := cs.db.ExecContext(ctx, `
+		DELETE FROM comment_pin
+		WHERE post_id=?1 AND comment_id=?2`,
+		postID, commentID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		return storageErrors.ErrPinNotFound
+	}
+
+	return nil
+}
+
+func (cs *CommentSQLiteStorage) GetPinnedComments(ctx context.Context, postID int64) ([]models.Comment, error) {
+	const op = "storage.sqlite.comment.GetPinnedComments"
+
+	rows, err := cs.db.QueryContext(ctx, `
+		SELECT c.id, c.post_id, c.parent_id, c.reply_to_id, c.depth, c.author, c.content, c.status, c.created_at, c.version, TRUE
+		FROM comment_pin p
+		JOIN comment c ON c.id = p.comment_id
+		WHERE p.post_id = ?1
+		ORDER BY p.position ASC`,
+		postID,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scanComments(op, rows)
+}
+
+func scanComments(op string, rows *sql.Rows) ([]models.Comment, error) {
+	defer rows.Close()
+
+	comments := make([]models.Comment, 0)
+
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.ParentID,
+			&comment.ReplyToID,
+			&comment.Depth,
+			&comment.Author,
+			&comment.Content,
+			&comment.Status,
+			&comment.CreatedAt,
+			&comment.Version,
+			&comment.Pinned,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return comments, nil
+}
@@ -0,0 +1,273 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+)
+
+type PostSQLiteStorage struct {
+	db dbtx
+}
+
+func NewSQLitePostStorage(db *sql.DB) *PostSQLiteStorage {
+	return &PostSQLiteStorage{db: db}
+}
+
+func (ps *PostSQLiteStorage) CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error) {
+	const op = "storage.sqlite.post.CreatePost"
+
+	var id int64
+	err := ps.db.QueryRowContext(ctx, `
+		INSERT INTO post (title, content, author, status, publish_at, comments_disabled)
+		VALUES (?1, ?2, ?3, ?4, CASE WHEN ?4 = 'PUBLISHED' THEN ?6 END, ?5)
+		RETURNING id`,
+		title, content, author, status, commentsDisabled, timestamp(time.Now()),
+	).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (ps *PostSQLiteStorage) ImportPost(ctx context.Context, post models.Post) (int64, error) {
+	const op = "storage.sqlite.post.ImportPost"
+
+	var id int64
+	err := ps.db.QueryRowContext(ctx, `
+		INSERT INTO post (title, content, author, status, publish_at, comments_disabled, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
+		RETURNING id`,
+		post.Title, post.Content, post.Author, post.Status, nullTimestamp(post.PublishAt), post.CommentsDisabled, timestamp(post.CreatedAt),
+	).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (ps *PostSQLiteStorage) GetPostByID(ctx context.Context, id int64) (models.Post, error) {
+	const op = "storage.sqlite.post.GetPostByID"
+
+	post := models.Post{}
+
+	row := ps.db.QueryRowContext(ctx, `
+		SELECT id, title, content, author, status, publish_at, comments_disabled, created_at, version
+		FROM post
+		WHERE id=?1`,
+		id,
+	)
+
+	err := row.Scan(
+		&post.ID,
+		&post.Title,
+		&post.Content,
+		&post.Author,
+		&post.Status,
+		&post.PublishAt,
+		&post.CommentsDisabled,
+		&post.CreatedAt,
+		&post.Version,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Post{}, storageErrors.ErrPostNotFound
+		}
+		return models.Post{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return post, nil
+}
+
+func (ps *PostSQLiteStorage) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	const op = "storage.sqlite.post.GetAllPosts"
+
+	posts := make([]models.Post, 0)
+
+	rows, err := ps.db.QueryContext(ctx, `
+		SELECT id, title, content, author, status, publish_at, comments_disabled, created_at, version
+		FROM post
+		ORDER BY created_at ASC, id ASC`,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(
+			&post.ID,
+			&post.Title,
+			&post.Content,
+			&post.Author,
+			&post.Status,
+			&post.PublishAt,
+			&post.CommentsDisabled,
+			&post.CreatedAt,
+			&post.Version,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return posts, nil
+}
+
+func (ps *PostSQLiteStorage) UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error {
+	const op = "storage.sqlite.post.UpdatePost"
+
+	result, err := ps.db.ExecContext(ctx, `
+		UPDATE post
+		SET title = ?2, content = ?3, version = version + 1
+		WHERE id=?1
+		AND (?4 IS NULL OR version = ?4)`,
+		id, title, content, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+func (ps *PostSQLiteStorage) SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error {
+	const op = "storage.sqlite.post.SetCommentsDisabled"
+
+	result, err := ps.db.ExecContext(ctx, `
+		UPDATE post
+		SET comments_disabled = ?2, version = version + 1
+		WHERE id=?1
+		AND (?3 IS NULL OR version = ?3)`,
+		id, disabled, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+func (ps *PostSQLiteStorage) SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error {
+	const op = "storage.sqlite.post.SetPostStatus"
+
+	result, err := ps.db.ExecContext(ctx, `
+		UPDATE post
+		SET status = ?2, publish_at = COALESCE(?3, publish_at), version = version + 1
+		WHERE id=?1
+		AND (?4 IS NULL OR version = ?4)`,
+		id, status, nullTimestamp(publishAt), expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+func (ps *PostSQLiteStorage) PublishDuePosts(ctx context.Context, now time.Time) ([]int64, error) {
+	const op = "storage.sqlite.post.PublishDuePosts"
+
+	rows, err := ps.db.QueryContext(ctx, `
+		UPDATE post
+		SET status = ?2, version = version + 1
+		WHERE status = ?3
+		AND publish_at <= ?1
+		RETURNING id`,
+		timestamp(now), constants.PostPublished, constants.PostScheduled,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	published := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		published = append(published, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return published, nil
+}
+
+func (ps *PostSQLiteStorage) DeletePost(ctx context.Context, id int64, expectedVersion *int64) error {
+	const op = "storage.sqlite.post.DeletePost"
+
+	result, err := ps.db.ExecContext(ctx, `
+		DELETE FROM post
+		WHERE id=?1
+		AND (?2 IS NULL OR version = ?2)`,
+		id, expectedVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if expectedVersion == nil {
+		return nil
+	}
+
+	return ps.checkUpdated(ctx, op, result, id)
+}
+
+// checkUpdated tells apart the two reasons a version guarded statement can
+// affect no rows: the post is gone, or its version has moved on.
+func (ps *PostSQLiteStorage) checkUpdated(ctx context.Context, op string, result sql.Result, id int64) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = ps.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM post WHERE id=?1)`, id).Scan(&exists)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if exists {
+		return storageErrors.ErrVersionConflict
+	}
+
+	return storageErrors.ErrPostNotFound
+}
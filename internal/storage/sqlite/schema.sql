@@ -0,0 +1,92 @@
+-- Timestamps are UTC text in the fixed width layout of timeLayout, so that
+-- they compare correctly as strings. Defaults produce the same layout.
+CREATE TABLE IF NOT EXISTS post(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	author VARCHAR(64) NOT NULL DEFAULT '',
+	status VARCHAR(16) NOT NULL DEFAULT 'PUBLISHED',
+	publish_at TIMESTAMP NULL,
+	comments_disabled BOOLEAN NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	version INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS idx_post_created_at ON post(created_at);
+CREATE INDEX IF NOT EXISTS idx_post_scheduled ON post(publish_at) WHERE status = 'SCHEDULED';
+
+CREATE TABLE IF NOT EXISTS comment(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	post_id INTEGER NOT NULL,
+	parent_id INTEGER NULL,
+	reply_to_id INTEGER NULL,
+	depth INTEGER NOT NULL DEFAULT 0,
+	author VARCHAR(64) NOT NULL DEFAULT '',
+	content TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'VISIBLE',
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	version INTEGER NOT NULL DEFAULT 1,
+	FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE,
+	FOREIGN KEY (parent_id) REFERENCES comment(id) ON DELETE CASCADE,
+	FOREIGN KEY (reply_to_id) REFERENCES comment(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_comment_post_id ON comment(post_id);
+CREATE INDEX IF NOT EXISTS idx_comment_parent_id ON comment(parent_id);
+CREATE INDEX IF NOT EXISTS idx_comment_reply_to_id ON comment(reply_to_id);
+CREATE INDEX IF NOT EXISTS idx_comment_created_at ON comment(created_at);
+
+CREATE TABLE IF NOT EXISTS comment_lock(
+	comment_id INTEGER PRIMARY KEY,
+	reason TEXT NOT NULL,
+	locked_by VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	expires_at TIMESTAMP NULL,
+	FOREIGN KEY (comment_id) REFERENCES comment(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS comment_pin(
+	comment_id INTEGER PRIMARY KEY,
+	post_id INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	pinned_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	FOREIGN KEY (comment_id) REFERENCES comment(id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_comment_pin_post_id ON comment_pin(post_id, position);
+
+CREATE TABLE IF NOT EXISTS notification(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recipient VARCHAR(64) NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	post_id INTEGER NOT NULL,
+	comment_id INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	read_at TIMESTAMP NULL,
+	FOREIGN KEY (post_id) REFERENCES post(id) ON DELETE CASCADE,
+	FOREIGN KEY (comment_id) REFERENCES comment(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_notification_recipient_id ON notification(recipient, id DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event VARCHAR(64) NOT NULL,
+	endpoint TEXT NOT NULL,
+	payload BLOB NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	delivered_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due ON webhook_delivery(next_attempt_at) WHERE status = 'PENDING';
+
+CREATE TABLE IF NOT EXISTS idempotency_key(
+	scope VARCHAR(64) NOT NULL,
+	key VARCHAR(255) NOT NULL,
+	request_hash VARCHAR(64) NOT NULL,
+	resource_id INTEGER NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+	expires_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (scope, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_key_expires_at ON idempotency_key(expires_at);
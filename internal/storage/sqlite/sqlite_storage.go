@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed schema.sql
+var schema string
+
+// timeLayout is fixed width, so timestamps stored as text compare in time
+// order. The driver parses it back into time.Time for TIMESTAMP columns.
+const timeLayout = "2006-01-02 15:04:05.000000"
+
+// NewSQLiteStorage opens the database file at path, creating it and its
+// schema when missing. The database runs in WAL mode with foreign keys
+// enforced, and every transaction takes the write lock when it begins, so
+// transactions are serialized like writes while reads continue.
+func NewSQLiteStorage(ctx context.Context, path string) (*storage.Storage, error) {
+	const op = "storage.sqlite.NewSQLiteStorage"
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_txlock", "immediate")
+
+	// SQLite decodes the escaped path, so a '?' or '#' in it is not taken
+	// for the start of the parameters.
+	db, err := sql.Open("sqlite", "file:"+url.PathEscape(path)+"?"+params.Encode())
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &storage.Storage{
+		Post:         NewSQLitePostStorage(db),
+		Comment:      NewSQLiteCommentStorage(db),
+		Notification: NewSQLiteNotificationStorage(db),
+		Webhook:      NewSQLiteWebhookStorage(db),
+		Idempotency:  NewSQLiteIdempotencyStorage(db),
+		Transactor:   &transactor{db: db},
+		Pinger:       &pinger{db: db},
+		Closer:       db,
+		Collector:    collectors.NewDBStatsCollector(db, "sqlite"),
+	}, nil
+}
+
+type pinger struct {
+	db *sql.DB
+}
+
+func (p *pinger) Ping(ctx context.Context) error {
+	const op = "storage.sqlite.Ping"
+
+	if err := p.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func nullTimestamp(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return timestamp(*t)
+}
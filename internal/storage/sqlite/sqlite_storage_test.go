@@ -0,0 +1,287 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/Pacahar/graphql-comments/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStorage(t *testing.T) *storage.Storage {
+	st, err := NewSQLiteStorage(context.Background(), filepath.Join(t.TempDir(), "comments.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { st.Close() })
+
+	return st
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, newTestStorage)
+}
+
+func TestPathIsEscaped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comments 100%?mode=ro#1.db")
+
+	st, err := NewSQLiteStorage(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	_, err = st.Post.CreatePost(context.Background(), "Post", "Content", "", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestPostsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStorage(t)
+
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC)
+	publishAt := createdAt.Add(time.Hour)
+
+	imported, err := st.Post.ImportPost(ctx, models.Post{
+		Title:     "Imported",
+		Content:   "Content",
+		Author:    "alice",
+		Status:    constants.PostScheduled,
+		PublishAt: &publishAt,
+		CreatedAt: createdAt,
+	})
+	assert.NoError(t, err)
+
+	created, err := st.Post.CreatePost(ctx, "Created", "Content", "bob", constants.PostPublished, true)
+	assert.NoError(t, err)
+
+	post, err := st.Post.GetPostByID(ctx, imported)
+	assert.NoError(t, err)
+	assert.True(t, createdAt.Equal(post.CreatedAt))
+	assert.True(t, publishAt.Equal(*post.PublishAt))
+	assert.False(t, post.CommentsDisabled)
+
+	post, err = st.Post.GetPostByID(ctx, created)
+	assert.NoError(t, err)
+	assert.True(t, post.CommentsDisabled)
+	assert.NotNil(t, post.PublishAt)
+
+	posts, err := st.Post.GetAllPosts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{imported, created}, []int64{posts[0].ID, posts[1].ID})
+
+	published, err := st.Post.PublishDuePosts(ctx, publishAt)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{imported}, published)
+
+	_, err = st.Post.GetPostByID(ctx, 42)
+	assert.ErrorIs(t, err, storageErrors.ErrPostNotFound)
+}
+
+func TestPostVersionCompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStorage(t)
+
+	id, err := st.Post.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	stale := int64(1)
+	assert.NoError(t, st.Post.UpdatePost(ctx, id, "Edited", "Content", &stale))
+	assert.ErrorIs(t, st.Post.UpdatePost(ctx, id, "Again", "Content", &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, st.Post.DeletePost(ctx, id, &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, st.Post.UpdatePost(ctx, 42, "Edited", "Content", nil), storageErrors.ErrPostNotFound)
+
+	post, err := st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited", post.Title)
+	assert.Equal(t, int64(2), post.Version)
+}
+
+func TestCommentsCascade(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStorage(t)
+
+	postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
+	rootID, err := st.Comment.CreateComment(ctx, "Root", "alice", postID, nil, nil)
+	assert.NoError(t, err)
+	otherID, _ := st.Comment.CreateComment(ctx, "Other", "bob", postID, nil, nil)
+	replyID, err := st.Comment.CreateComment(ctx, "Reply", "bob", postID, &rootID, &rootID)
+	assert.NoError(t, err)
+	answerID, _ := st.Comment.CreateComment(ctx, "Answer", "carol", postID, &otherID, &replyID)
+
+	reply, err := st.Comment.GetCommentByID(ctx, replyID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reply.Depth)
+
+	roots, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{rootID, otherID}, []int64{roots[0].ID, roots[1].ID})
+
+	limit, offset := int32(1), int32(1)
+	page, err := st.Comment.GetCommentsByPostID(ctx, postID, &limit, &offset)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, otherID, page[0].ID)
+
+	// Deleting a comment removes its replies and clears replies to it.
+	assert.NoError(t, st.Comment.DeleteComment(ctx, rootID, nil))
+
+	_, err = st.Comment.GetCommentByID(ctx, replyID)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	answer, err := st.Comment.GetCommentByID(ctx, answerID)
+	assert.NoError(t, err)
+	assert.Nil(t, answer.ReplyToID)
+
+	assert.NoError(t, st.Post.DeletePost(ctx, postID, nil))
+
+	_, err = st.Comment.GetCommentByID(ctx, otherID)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+}
+
+func TestLocksAndPins(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStorage(t)
+
+	postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
+	rootID, _ := st.Comment.CreateComment(ctx, "Root", "", postID, nil, nil)
+	replyID, _ := st.Comment.CreateComment(ctx, "Reply", "", postID, &rootID, nil)
+	otherID, _ := st.Comment.CreateComment(ctx, "Other", "", postID, nil, nil)
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	assert.NoError(t, st.Comment.LockComment(ctx, rootID, "heated", "moderator", &expiresAt))
+	assert.ErrorIs(t, st.Comment.LockComment(ctx, 42, "heated", "moderator", nil), storageErrors.ErrCommentNotFound)
+
+	lock, err := st.Comment.FindActiveLock(ctx, replyID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, rootID, lock.CommentID)
+	assert.Equal(t, "heated", lock.Reason)
+
+	_, err = st.Comment.FindActiveLock(ctx, replyID, expiresAt)
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, otherID, 1))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, otherID, 1))
+	assert.ErrorIs(t, st.Comment.PinComment(ctx, postID, rootID, 1), storageErrors.ErrPinLimitReached)
+	assert.ErrorIs(t, st.Comment.PinComment(ctx, postID+1, rootID, 1), storageErrors.ErrCommentNotFound)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Len(t, pinned, 1)
+	assert.True(t, pinned[0].Pinned)
+
+	other, err := st.Comment.GetCommentByID(ctx, otherID)
+	assert.NoError(t, err)
+	assert.True(t, other.Pinned)
+
+	assert.NoError(t, st.Comment.UnpinComment(ctx, postID, otherID))
+	assert.ErrorIs(t, st.Comment.UnpinComment(ctx, postID, otherID), storageErrors.ErrPinNotFound)
+}
+
+func TestNotificationsAndWebhooks(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStorage(t)
+
+	postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
+	commentID, _ := st.Comment.CreateComment(ctx, "Comment", "", postID, nil, nil)
+
+	first, _ := st.Notification.CreateNotification(ctx, "alice", constants.NotificationReply, postID, commentID)
+	second, _ := st.Notification.CreateNotification(ctx, "alice", constants.NotificationReply, postID, commentID)
+
+	marked, err := st.Notification.MarkNotificationsRead(ctx, "alice", []int64{first})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), marked)
+
+	unread, err := st.Notification.GetNotificationsByRecipient(ctx, "alice", true, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, unread, 1)
+	assert.Equal(t, second, unread[0].ID)
+
+	now := time.Now()
+
+	id, err := st.Webhook.EnqueueDelivery(ctx, "comment.created", "http://example.com", []byte(`{}`))
+	assert.NoError(t, err)
+
+	claimed, err := st.Webhook.ClaimDueDeliveries(ctx, now.Add(time.Second), time.Minute, 10)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, id, claimed[0].ID)
+	assert.Equal(t, []byte(`{}`), claimed[0].Payload)
+
+	claimed, err = st.Webhook.ClaimDueDeliveries(ctx, now.Add(time.Second), time.Minute, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	assert.NoError(t, st.Webhook.MarkDeliverySucceeded(ctx, id))
+
+	status := constants.WebhookDeliveryDelivered
+	deliveries, err := st.Webhook.GetDeliveries(ctx, &status, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStorage(t)
+
+	now := time.Now()
+
+	record, created, err := st.Idempotency.ReserveKey(ctx, "createPost", "key", "hash", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "hash", record.RequestHash)
+
+	assert.NoError(t, st.Idempotency.CompleteKey(ctx, "createPost", "key", 7, now.Add(time.Hour)))
+
+	record, created, err = st.Idempotency.ReserveKey(ctx, "createPost", "key", "other", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "hash", record.RequestHash)
+	assert.Equal(t, int64(7), record.ResourceID)
+
+	deleted, err := st.Idempotency.DeleteExpiredKeys(ctx, now.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+func TestWithTxRollback(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStorage(t)
+
+	postID, _ := st.Post.CreatePost(ctx, "Post", "Content", "", constants.PostPublished, false)
+
+	failure := errors.New("failure")
+
+	err := st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		assert.NoError(t, tx.Post.UpdatePost(ctx, postID, "Edited", "Content", nil))
+		commentID, err := tx.Comment.CreateComment(ctx, "Comment", "", postID, nil, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Comment.PinComment(ctx, postID, commentID, 3))
+
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	post, err := st.Post.GetPostByID(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Post", post.Title)
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+}
@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// dbtx is implemented by both *sql.DB and *sql.Tx, so the same storage code
+// runs standalone and inside Storage.WithTx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx runs fn in a new transaction, or in the surrounding one when db
+// already is a transaction. Transactions begin immediate, so fn holds the
+// database write lock throughout and needs no row locks.
+func inTx(ctx context.Context, db dbtx, fn func(tx dbtx) error) error {
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type transactor struct {
+	db *sql.DB
+}
+
+func (t *transactor) WithTx(ctx context.Context, fn func(ctx context.Context, tx storage.Storage) error) error {
+	const op = "storage.sqlite.WithTx"
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(ctx, bindStorage(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// bindStorage returns storages that run every query on tx.
+func bindStorage(tx *sql.Tx) storage.Storage {
+	return storage.Storage{
+		Post:         &PostSQLiteStorage{db: tx},
+		Comment:      &CommentSQLiteStorage{db: tx},
+		Notification: &NotificationSQLiteStorage{db: tx},
+		Webhook:      &WebhookSQLiteStorage{db: tx},
+		Idempotency:  &IdempotencySQLiteStorage{db: tx},
+	}
+}
@@ -0,0 +1,218 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+)
+
+type WebhookSQLiteStorage struct {
+	db dbtx
+}
+
+func NewSQLiteWebhookStorage(db *sql.DB) *WebhookSQLiteStorage {
+	return &WebhookSQLiteStorage{db: db}
+}
+
+func (ws *WebhookSQLiteStorage) EnqueueDelivery(ctx context.Context, event, endpoint string, payload []byte) (int64, error) {
+	const op = "storage.sqlite.webhook.EnqueueDelivery"
+
+	now := timestamp(time.Now())
+
+	var id int64
+	err := ws.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_delivery (event, endpoint, payload, status, next_attempt_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?5)
+		RETURNING id`,
+		event, endpoint, payload, constants.WebhookDeliveryPending, now,
+	).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (ws *WebhookSQLiteStorage) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	const op = "storage.sqlite.webhook.ClaimDueDeliveries"
+
+	var deliveries []models.WebhookDelivery
+
+	// The transaction holds the database write lock, which stands in for
+	// SKIP LOCKED: concurrent claims run one after another and never see
+	// the same due delivery.
+	err := inTx(ctx, ws.db, func(tx dbtx) error {
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE webhook_delivery
+			SET next_attempt_at = ?2
+			WHERE id IN (
+				SELECT id
+				FROM webhook_delivery
+				WHERE status = ?3
+				AND next_attempt_at <= ?1
+				ORDER BY id ASC
+				LIMIT ?4
+			)
+			RETURNING id`,
+			timestamp(now), timestamp(now.Add(lease)), constants.WebhookDeliveryPending, limit,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		ids, err := scanIDs(rows)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(ids)
+		if err != nil {
+			return err
+		}
+
+		// RETURNING loses the column types the driver needs to parse
+		// timestamps, so the claimed rows are read back separately.
+		rows, err = tx.QueryContext(ctx, `
+			SELECT id, event, endpoint, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+			FROM webhook_delivery
+			WHERE id IN (SELECT value FROM json_each(?1))
+			ORDER BY id ASC`,
+			string(encoded),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		deliveries, err = scanWebhookDeliveries(op, rows)
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+func (ws *WebhookSQLiteStorage) MarkDeliverySucceeded(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.webhook.MarkDeliverySucceeded"
+
+	_, err := ws.db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = ?2, attempts = attempts + 1, last_error = '', delivered_at = ?3
+		WHERE id = ?1`,
+		id, constants.WebhookDeliveryDelivered, timestamp(time.Now()),
+	)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (ws *WebhookSQLiteStorage) MarkDeliveryFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error {
+	const op = "storage.sqlite.webhook.MarkDeliveryFailed"
+
+	var err error
+
+	if nextAttemptAt == nil {
+		_, err = ws.db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = ?3, attempts = attempts + 1, last_error = ?2
+		WHERE id = ?1`,
+			id, lastError, constants.WebhookDeliveryFailed,
+		)
+	} else {
+		_, err = ws.db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET attempts = attempts + 1, last_error = ?2, next_attempt_at = ?3
+		WHERE id = ?1`,
+			id, lastError, timestamp(*nextAttemptAt),
+		)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (ws *WebhookSQLiteStorage) GetDeliveries(ctx context.Context, status *string, limit *int32, offset *int32) ([]models.WebhookDelivery, error) {
+	const op = "storage.sqlite.webhook.GetDeliveries"
+
+	rows, err := ws.db.QueryContext(ctx, `
+		SELECT id, event, endpoint, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+		FROM webhook_delivery
+		WHERE (?1 IS NULL OR status = ?1)
+		ORDER BY id DESC
+		LIMIT COALESCE(?2, -1)
+		OFFSET COALESCE(?3, 0)`,
+		status, limit, offset,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scanWebhookDeliveries(op, rows)
+}
+
+func scanWebhookDeliveries(op string, rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.Event,
+			&delivery.Endpoint,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.LastError,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iteration failed: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+func scanIDs(rows *sql.Rows) ([]int64, error) {
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -2,27 +2,183 @@ package storage
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Storage struct {
-	Post    PostStorage
-	Comment CommentStorage
+	Post         PostStorage
+	Comment      CommentStorage
+	Notification NotificationStorage
+	Webhook      WebhookStorage
+	Idempotency  IdempotencyStorage
+	Transactor   Transactor
+	Pinger       Pinger
+	Closer       io.Closer
+	// Replicas is nil when every read goes to the primary.
+	Replicas Replicas
+	// Collector exports backend specific metrics, such as the connection
+	// pool statistics. It is nil when the backend has none.
+	Collector prometheus.Collector
+}
+
+// Close releases the backend's resources, such as its connection pool.
+// The storage must not be used afterwards.
+func (s *Storage) Close() error {
+	if s.Closer == nil {
+		return nil
+	}
+
+	return s.Closer.Close()
+}
+
+// Collectors exports the metrics of several collectors as one, skipping
+// nil ones.
+type Collectors []prometheus.Collector
+
+func (cs Collectors) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range cs {
+		if c != nil {
+			c.Describe(ch)
+		}
+	}
+}
+
+func (cs Collectors) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range cs {
+		if c != nil {
+			c.Collect(ch)
+		}
+	}
+}
+
+// Replicas is implemented by backends that serve reads from replicas.
+type Replicas interface {
+	// Pinned reports whether ctx's client reads from the primary to see its
+	// own writes.
+	Pinned(ctx context.Context) bool
+}
+
+// Pinger checks that the backend can serve requests.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping returns nil when the backend is ready. Backends without a Pinger,
+// such as memory, are always ready.
+func (s *Storage) Ping(ctx context.Context) error {
+	if s.Pinger == nil {
+		return nil
+	}
+
+	return s.Pinger.Ping(ctx)
+}
+
+// Transactor runs fn in one transaction across all storages. fn receives
+// the context to make its calls with, which carries the transaction's span,
+// and storages bound to the transaction; returning an error rolls it back.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context, tx Storage) error) error
+}
+
+// WithTx runs fn atomically when the backend supports transactions and
+// directly on s otherwise. Calling WithTx on the storage passed to fn runs
+// in the same transaction. Posts and comments read by GetPostByID and
+// GetCommentByID inside fn can not be changed by others until fn returns,
+// so checks made on them still hold when fn writes.
+func (s *Storage) WithTx(ctx context.Context, fn func(ctx context.Context, tx Storage) error) error {
+	if s.Transactor == nil {
+		return fn(ctx, *s)
+	}
+
+	return s.Transactor.WithTx(ctx, fn)
 }
 
 type PostStorage interface {
-	CreatePost(ctx context.Context, title, content string, commentsDisabled bool) (int64, error)
+	CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (int64, error)
+	// ImportPost stores a post from another system, keeping its status and
+	// timestamps. post.ID is ignored and the new ID is returned.
+	ImportPost(ctx context.Context, post models.Post) (int64, error)
 	GetPostByID(ctx context.Context, id int64) (models.Post, error)
 	GetAllPosts(ctx context.Context) ([]models.Post, error)
-	DeletePost(ctx context.Context, id int64) error
+	// Every update bumps the post version. When expectedVersion is not nil the
+	// update is applied only if it matches the stored version, otherwise
+	// ErrVersionConflict is returned.
+	UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) error
+	SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) error
+	SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) error
+	// PublishDuePosts publishes every scheduled post whose publishAt is not
+	// after now and returns their IDs.
+	PublishDuePosts(ctx context.Context, now time.Time) ([]int64, error)
+	DeletePost(ctx context.Context, id int64, expectedVersion *int64) error
 }
 
 type CommentStorage interface {
-	CreateComment(ctx context.Context, content string, postID int64, parentID *int64) (int64, error)
+	// CreateComment stores the comment one level below parentID. replyToID is
+	// the comment actually replied to when the reply was re-parented to stay
+	// within the maximum thread depth.
+	CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (int64, error)
+	// ImportComment is ImportPost for comments. PostID, ParentID and
+	// ReplyToID must refer to stored records.
+	ImportComment(ctx context.Context, comment models.Comment) (int64, error)
 	GetCommentByID(ctx context.Context, id int64) (models.Comment, error)
 	GetCommentsByParentID(ctx context.Context, postID int64) ([]models.Comment, error)
 	GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) ([]models.Comment, error)
-	DeleteComment(ctx context.Context, id int64) error
+	// GetThread returns the comment rootID and all replies below it, or every
+	// comment of the post when rootID is nil, at most maxDepth levels deep
+	// unless maxDepth is 0. Comments are ordered by depth, then by creation
+	// time, so parents always come before their replies. Only the first
+	// limit comments are returned unless limit is 0.
+	GetThread(ctx context.Context, postID int64, rootID *int64, maxDepth, limit int) ([]models.ThreadComment, error)
+	// UpdateComment and DeleteComment compare expectedVersion the same way as
+	// PostStorage.UpdatePost.
+	UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) error
+	DeleteComment(ctx context.Context, id int64, expectedVersion *int64) error
 	DeleteCommentsByPostID(ctx context.Context, id int64) error
+	LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) error
+	UnlockComment(ctx context.Context, id int64) error
+	// FindActiveLock returns the lock on the comment or on its nearest locked
+	// ancestor that has not expired at now.
+	FindActiveLock(ctx context.Context, id int64, now time.Time) (models.CommentLock, error)
+	// PinComment appends the comment to the post's pins unless the post already
+	// has maxPins pinned comments. Pinning a pinned comment is a no-op.
+	PinComment(ctx context.Context, postID, commentID int64, maxPins int) error
+	UnpinComment(ctx context.Context, postID, commentID int64) error
+	GetPinnedComments(ctx context.Context, postID int64) ([]models.Comment, error)
+}
+
+type NotificationStorage interface {
+	CreateNotification(ctx context.Context, recipient, notificationType string, postID, commentID int64) (int64, error)
+	GetNotificationByID(ctx context.Context, id int64) (models.Notification, error)
+	GetNotificationsByRecipient(ctx context.Context, recipient string, unreadOnly bool, first *int32, after *int64) ([]models.Notification, error)
+	MarkNotificationsRead(ctx context.Context, recipient string, ids []int64) (int64, error)
+}
+
+// WebhookStorage is the durable outbox for webhook deliveries.
+type WebhookStorage interface {
+	EnqueueDelivery(ctx context.Context, event, endpoint string, payload []byte) (int64, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries that are due at
+	// now and postpones them by lease, so that concurrent dispatchers do not
+	// pick up the same delivery twice.
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	MarkDeliverySucceeded(ctx context.Context, id int64) error
+	// MarkDeliveryFailed records a failed attempt. A nil nextAttemptAt marks the
+	// delivery as permanently failed.
+	MarkDeliveryFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error
+	GetDeliveries(ctx context.Context, status *string, limit *int32, offset *int32) ([]models.WebhookDelivery, error)
+}
+
+type IdempotencyStorage interface {
+	// ReserveKey stores a new in-flight key unless an unexpired one already
+	// exists for the scope, in which case the existing key is returned and
+	// created is false.
+	ReserveKey(ctx context.Context, scope, key, requestHash string, expiresAt time.Time) (record models.IdempotencyKey, created bool, err error)
+	// CompleteKey records the resource created under an in-flight key and
+	// keeps the key until expiresAt.
+	CompleteKey(ctx context.Context, scope, key string, resourceID int64, expiresAt time.Time) error
+	ReleaseKey(ctx context.Context, scope, key string) error
+	DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error)
 }
@@ -0,0 +1,532 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCommentRoundTrip(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	rootID, err := st.Comment.CreateComment(ctx, "Root", "alice", postID, nil, nil)
+	assert.NoError(t, err)
+
+	replyID, err := st.Comment.CreateComment(ctx, "Reply", "bob", postID, &rootID, &rootID)
+	assert.NoError(t, err)
+
+	nestedID := newComment(t, st, postID, &replyID)
+
+	root, err := st.Comment.GetCommentByID(ctx, rootID)
+	assert.NoError(t, err)
+	assert.Equal(t, rootID, root.ID)
+	assert.Equal(t, postID, root.PostID)
+	assert.Nil(t, root.ParentID)
+	assert.Nil(t, root.ReplyToID)
+	assert.Equal(t, 0, root.Depth)
+	assert.Equal(t, "alice", root.Author)
+	assert.Equal(t, "Root", root.Content)
+	assert.Equal(t, constants.CommentVisible, root.Status)
+	assert.False(t, root.Pinned)
+	assert.False(t, root.CreatedAt.IsZero())
+	assert.Equal(t, int64(1), root.Version)
+
+	reply, err := st.Comment.GetCommentByID(ctx, replyID)
+	assert.NoError(t, err)
+	assert.Equal(t, &rootID, reply.ParentID)
+	assert.Equal(t, &rootID, reply.ReplyToID)
+	assert.Equal(t, 1, reply.Depth)
+
+	nested, err := st.Comment.GetCommentByID(ctx, nestedID)
+	assert.NoError(t, err)
+	assert.Equal(t, &replyID, nested.ParentID)
+	assert.Equal(t, 2, nested.Depth)
+}
+
+func testImportComment(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	createdAt := time.Date(2020, 5, 17, 8, 30, 0, 123456000, time.UTC)
+
+	rootID, err := st.Comment.ImportComment(ctx, models.Comment{
+		ID:        1_000_000,
+		PostID:    postID,
+		Author:    "carol",
+		Content:   "Imported",
+		Status:    constants.CommentSpam,
+		CreatedAt: createdAt,
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, int64(1_000_000), rootID)
+
+	replyID, err := st.Comment.ImportComment(ctx, models.Comment{
+		PostID:    postID,
+		ParentID:  &rootID,
+		ReplyToID: &rootID,
+		Depth:     5,
+		Content:   "Imported reply",
+		Pinned:    true,
+		CreatedAt: createdAt.Add(time.Minute),
+		Version:   3,
+	})
+	assert.NoError(t, err)
+
+	root, err := st.Comment.GetCommentByID(ctx, rootID)
+	assert.NoError(t, err)
+	assert.Equal(t, "carol", root.Author)
+	assert.Equal(t, constants.CommentSpam, root.Status)
+	assert.True(t, createdAt.Equal(root.CreatedAt), "created at %s", root.CreatedAt)
+
+	reply, err := st.Comment.GetCommentByID(ctx, replyID)
+	assert.NoError(t, err)
+	assert.Equal(t, &rootID, reply.ParentID)
+	assert.Equal(t, &rootID, reply.ReplyToID)
+	assert.Equal(t, 1, reply.Depth)
+	assert.Equal(t, constants.CommentVisible, reply.Status)
+	assert.False(t, reply.Pinned)
+	assert.Equal(t, int64(1), reply.Version)
+}
+
+func testGetCommentsByPostID(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	postID := newPost(t, st)
+	otherPostID := newPost(t, st)
+
+	first := newComment(t, st, postID, nil)
+	second := newComment(t, st, postID, nil)
+	newComment(t, st, postID, &first)
+	newComment(t, st, otherPostID, nil)
+
+	imported, err := st.Comment.ImportComment(ctx, models.Comment{
+		PostID:    postID,
+		Content:   "Imported",
+		CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, second, 0))
+
+	// Replies are not listed, only the roots of the threads.
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{imported, first, second}, commentIDs(comments))
+
+	if assert.Len(t, comments, 3) {
+		assert.False(t, comments[1].Pinned)
+		assert.True(t, comments[2].Pinned)
+	}
+
+	comments, err = st.Comment.GetCommentsByPostID(ctx, 42, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func testCommentPages(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	var ids []int64
+	for range 5 {
+		ids = append(ids, newComment(t, st, postID, nil))
+	}
+
+	page := func(limit, offset *int32) []int64 {
+		t.Helper()
+
+		comments, err := st.Comment.GetCommentsByPostID(ctx, postID, limit, offset)
+		assert.NoError(t, err)
+
+		return commentIDs(comments)
+	}
+
+	assert.Equal(t, ids[:2], page(ptr(int32(2)), ptr(int32(0))))
+	assert.Equal(t, ids[2:4], page(ptr(int32(2)), ptr(int32(2))))
+	assert.Equal(t, ids[4:], page(ptr(int32(2)), ptr(int32(4))))
+	assert.Empty(t, page(ptr(int32(2)), ptr(int32(5))))
+	assert.Empty(t, page(ptr(int32(2)), ptr(int32(50))))
+	assert.Empty(t, page(ptr(int32(0)), ptr(int32(0))))
+	assert.Equal(t, ids, page(ptr(int32(50)), ptr(int32(0))))
+
+	// Paging needs both.
+	assert.Equal(t, ids, page(ptr(int32(2)), nil))
+	assert.Equal(t, ids, page(nil, ptr(int32(2))))
+}
+
+func testGetCommentsByParentID(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	rootID := newComment(t, st, postID, nil)
+	first := newComment(t, st, postID, &rootID)
+	second := newComment(t, st, postID, &rootID)
+	nested := newComment(t, st, postID, &first)
+
+	imported, err := st.Comment.ImportComment(ctx, models.Comment{
+		PostID:    postID,
+		ParentID:  &rootID,
+		Content:   "Imported",
+		CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+
+	children, err := st.Comment.GetCommentsByParentID(ctx, rootID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{imported, first, second}, commentIDs(children))
+
+	children, err = st.Comment.GetCommentsByParentID(ctx, first)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{nested}, commentIDs(children))
+
+	children, err = st.Comment.GetCommentsByParentID(ctx, nested)
+	assert.NoError(t, err)
+	assert.Empty(t, children)
+}
+
+func testGetThread(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	postID := newPost(t, st)
+	otherPostID := newPost(t, st)
+
+	first := newComment(t, st, postID, nil)
+	reply := newComment(t, st, postID, &first)
+	otherReply := newComment(t, st, postID, &first)
+	nested := newComment(t, st, postID, &reply)
+	second := newComment(t, st, postID, nil)
+	secondReply := newComment(t, st, postID, &second)
+	otherRoot := newComment(t, st, otherPostID, nil)
+
+	imported, err := st.Comment.ImportComment(ctx, models.Comment{
+		PostID:    postID,
+		ParentID:  &second,
+		Content:   "Imported",
+		CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+
+	thread := func(rootID *int64, maxDepth int) []models.ThreadComment {
+		t.Helper()
+
+		thread, err := st.Comment.GetThread(ctx, postID, rootID, maxDepth, 0)
+		assert.NoError(t, err)
+
+		return thread
+	}
+
+	// Level by level, each level in creation order.
+	all := thread(nil, 0)
+	assert.Equal(t, []int64{first, second, imported, reply, otherReply, secondReply, nested}, threadIDs(all))
+
+	paths := make(map[int64][]int64)
+	depths := make(map[int64]int)
+	for _, comment := range all {
+		paths[comment.Comment.ID] = comment.Path
+		depths[comment.Comment.ID] = comment.Depth
+	}
+
+	assert.Equal(t, []int64{first}, paths[first])
+	assert.Equal(t, []int64{second, imported}, paths[imported])
+	assert.Equal(t, []int64{first, reply, nested}, paths[nested])
+	assert.Equal(t, 0, depths[second])
+	assert.Equal(t, 1, depths[imported])
+	assert.Equal(t, 2, depths[nested])
+
+	if assert.NotEmpty(t, all) {
+		assert.Equal(t, "Comment", all[0].Comment.Content)
+		assert.Equal(t, postID, all[0].Comment.PostID)
+	}
+
+	assert.Equal(t, []int64{first, second, imported, reply, otherReply, secondReply}, threadIDs(thread(nil, 1)))
+
+	// Depth and path count from the requested root.
+	sub := thread(&reply, 0)
+	assert.Equal(t, []int64{reply, nested}, threadIDs(sub))
+
+	if assert.Len(t, sub, 2) {
+		assert.Equal(t, 0, sub[0].Depth)
+		assert.Equal(t, []int64{reply}, sub[0].Path)
+		assert.Equal(t, 1, sub[1].Depth)
+		assert.Equal(t, []int64{reply, nested}, sub[1].Path)
+		assert.Equal(t, 2, sub[1].Comment.Depth)
+	}
+
+	assert.Equal(t, []int64{first, reply, otherReply}, threadIDs(thread(&first, 1)))
+
+	_, err = st.Comment.GetThread(ctx, postID, &otherRoot, 0, 0)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	_, err = st.Comment.GetThread(ctx, postID, ptr(int64(42)), 0, 0)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	// A limit keeps the first comments, so every parent is still listed
+	// before its replies.
+	limited, err := st.Comment.GetThread(ctx, postID, nil, 0, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{first, second, imported, reply}, threadIDs(limited))
+
+	limited, err = st.Comment.GetThread(ctx, postID, &reply, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{reply}, threadIDs(limited))
+
+	empty, err := st.Comment.GetThread(ctx, 42, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func testCommentVersions(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+	id := newComment(t, st, postID, nil)
+
+	stale := int64(1)
+	assert.NoError(t, st.Comment.UpdateComment(ctx, id, "Edited", &stale))
+	assert.ErrorIs(t, st.Comment.UpdateComment(ctx, id, "Stale", &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, st.Comment.DeleteComment(ctx, id, &stale), storageErrors.ErrVersionConflict)
+	assert.NoError(t, st.Comment.UpdateComment(ctx, id, "Edited again", nil))
+
+	comment, err := st.Comment.GetCommentByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited again", comment.Content)
+	assert.Equal(t, int64(3), comment.Version)
+
+	assert.NoError(t, st.Comment.DeleteComment(ctx, id, &comment.Version))
+
+	_, err = st.Comment.GetCommentByID(ctx, id)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+}
+
+func testCommentNotFound(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+	missing := int64(42)
+
+	_, err := st.Comment.GetCommentByID(ctx, missing)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	_, err = st.Comment.CreateComment(ctx, "Orphan", "bob", postID, &missing, nil)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	assert.ErrorIs(t, st.Comment.UpdateComment(ctx, missing, "Content", nil), storageErrors.ErrCommentNotFound)
+	assert.ErrorIs(t, st.Comment.DeleteComment(ctx, missing, ptr(int64(1))), storageErrors.ErrCommentNotFound)
+	assert.ErrorIs(t, st.Comment.LockComment(ctx, missing, "reason", "mod", nil), storageErrors.ErrCommentNotFound)
+	assert.ErrorIs(t, st.Comment.UnlockComment(ctx, missing), storageErrors.ErrLockNotFound)
+	assert.ErrorIs(t, st.Comment.PinComment(ctx, postID, missing, 0), storageErrors.ErrCommentNotFound)
+	assert.ErrorIs(t, st.Comment.UnpinComment(ctx, postID, missing), storageErrors.ErrPinNotFound)
+
+	_, err = st.Comment.FindActiveLock(ctx, missing, time.Now())
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+
+	// Without a version deleting is idempotent.
+	assert.NoError(t, st.Comment.DeleteComment(ctx, missing, nil))
+}
+
+func testParentOnOtherPost(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+	otherPostID := newPost(t, st)
+
+	parentID, err := st.Comment.CreateComment(ctx, "Parent", "alice", otherPostID, nil, nil)
+	assert.NoError(t, err)
+
+	_, err = st.Comment.CreateComment(ctx, "Reply", "bob", postID, &parentID, nil)
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	_, err = st.Comment.ImportComment(ctx, models.Comment{PostID: postID, ParentID: &parentID, Content: "Reply"})
+	assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func testDeleteCommentCascades(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	rootID := newComment(t, st, postID, nil)
+	childID := newComment(t, st, postID, &rootID)
+	nestedID := newComment(t, st, postID, &childID)
+	otherRootID := newComment(t, st, postID, nil)
+
+	// A reply flattened into another thread still points at childID.
+	replyID, err := st.Comment.CreateComment(ctx, "Reply", "bob", postID, &otherRootID, &childID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, st.Comment.LockComment(ctx, childID, "reason", "mod", nil))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, nestedID, 0))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, otherRootID, 0))
+
+	assert.NoError(t, st.Comment.DeleteComment(ctx, rootID, nil))
+
+	for _, id := range []int64{rootID, childID, nestedID} {
+		_, err := st.Comment.GetCommentByID(ctx, id)
+		assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+	}
+
+	reply, err := st.Comment.GetCommentByID(ctx, replyID)
+	assert.NoError(t, err)
+	assert.Equal(t, &otherRootID, reply.ParentID)
+	assert.Nil(t, reply.ReplyToID)
+
+	assert.ErrorIs(t, st.Comment.UnlockComment(ctx, childID), storageErrors.ErrLockNotFound)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{otherRootID}, commentIDs(pinned))
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{otherRootID}, commentIDs(comments))
+
+	children, err := st.Comment.GetCommentsByParentID(ctx, rootID)
+	assert.NoError(t, err)
+	assert.Empty(t, children)
+}
+
+func testDeleteCommentsByPostID(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	postID := newPost(t, st)
+	otherPostID := newPost(t, st)
+
+	rootID := newComment(t, st, postID, nil)
+	replyID := newComment(t, st, postID, &rootID)
+	otherID := newComment(t, st, otherPostID, nil)
+
+	assert.NoError(t, st.Comment.LockComment(ctx, rootID, "reason", "mod", nil))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, rootID, 1))
+	assert.NoError(t, st.Comment.PinComment(ctx, otherPostID, otherID, 1))
+
+	assert.NoError(t, st.Comment.DeleteCommentsByPostID(ctx, postID))
+
+	for _, id := range []int64{rootID, replyID} {
+		_, err := st.Comment.GetCommentByID(ctx, id)
+		assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+	}
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Empty(t, pinned)
+
+	assert.ErrorIs(t, st.Comment.UnlockComment(ctx, rootID), storageErrors.ErrLockNotFound)
+
+	// The pin limit counts the remaining pins only.
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, newComment(t, st, postID, nil), 1))
+
+	comments, err = st.Comment.GetCommentsByPostID(ctx, otherPostID, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{otherID}, commentIDs(comments))
+
+	pinned, err = st.Comment.GetPinnedComments(ctx, otherPostID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{otherID}, commentIDs(pinned))
+
+	assert.NoError(t, st.Comment.DeleteCommentsByPostID(ctx, 42))
+}
+
+func testLocks(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	rootID := newComment(t, st, postID, nil)
+	childID := newComment(t, st, postID, &rootID)
+	nestedID := newComment(t, st, postID, &childID)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expiresAt := now.Add(time.Hour)
+
+	_, err := st.Comment.FindActiveLock(ctx, nestedID, now)
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+
+	assert.NoError(t, st.Comment.LockComment(ctx, rootID, "root", "mod", nil))
+	assert.NoError(t, st.Comment.LockComment(ctx, childID, "first", "mod", nil))
+	assert.NoError(t, st.Comment.LockComment(ctx, childID, "child", "admin", &expiresAt))
+
+	// The nearest lock wins while it lasts.
+	lock, err := st.Comment.FindActiveLock(ctx, nestedID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, childID, lock.CommentID)
+	assert.Equal(t, "child", lock.Reason)
+	assert.Equal(t, "admin", lock.LockedBy)
+	assert.False(t, lock.CreatedAt.IsZero())
+	if assert.NotNil(t, lock.ExpiresAt) {
+		assert.True(t, expiresAt.Equal(*lock.ExpiresAt), "expires at %s", lock.ExpiresAt)
+	}
+
+	lock, err = st.Comment.FindActiveLock(ctx, nestedID, expiresAt)
+	assert.NoError(t, err)
+	assert.Equal(t, rootID, lock.CommentID)
+	assert.Nil(t, lock.ExpiresAt)
+
+	assert.NoError(t, st.Comment.UnlockComment(ctx, rootID))
+	assert.ErrorIs(t, st.Comment.UnlockComment(ctx, rootID), storageErrors.ErrLockNotFound)
+
+	_, err = st.Comment.FindActiveLock(ctx, nestedID, expiresAt)
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+
+	_, err = st.Comment.FindActiveLock(ctx, rootID, now)
+	assert.ErrorIs(t, err, storageErrors.ErrLockNotFound)
+}
+
+func testPins(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	postID := newPost(t, st)
+	otherPostID := newPost(t, st)
+
+	first := newComment(t, st, postID, nil)
+	second := newComment(t, st, postID, nil)
+	third := newComment(t, st, postID, nil)
+	otherPostComment := newComment(t, st, otherPostID, nil)
+
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, second, 2))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, first, 2))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, first, 2))
+	assert.ErrorIs(t, st.Comment.PinComment(ctx, postID, third, 2), storageErrors.ErrPinLimitReached)
+	assert.ErrorIs(t, st.Comment.PinComment(ctx, postID, otherPostComment, 2), storageErrors.ErrCommentNotFound)
+	assert.ErrorIs(t, st.Comment.UnpinComment(ctx, otherPostID, first), storageErrors.ErrPinNotFound)
+	assert.ErrorIs(t, st.Comment.UnpinComment(ctx, postID, third), storageErrors.ErrPinNotFound)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{second, first}, commentIDs(pinned))
+
+	for _, comment := range pinned {
+		assert.True(t, comment.Pinned)
+	}
+
+	comment, err := st.Comment.GetCommentByID(ctx, first)
+	assert.NoError(t, err)
+	assert.True(t, comment.Pinned)
+
+	assert.NoError(t, st.Comment.UnpinComment(ctx, postID, second))
+
+	comment, err = st.Comment.GetCommentByID(ctx, second)
+	assert.NoError(t, err)
+	assert.False(t, comment.Pinned)
+
+	// Pins are appended, and zero means no limit.
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, third, 0))
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, second, 0))
+
+	pinned, err = st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{first, third, second}, commentIDs(pinned))
+
+	pinned, err = st.Comment.GetPinnedComments(ctx, otherPostID)
+	assert.NoError(t, err)
+	assert.Empty(t, pinned)
+}
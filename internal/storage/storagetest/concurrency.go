@@ -0,0 +1,173 @@
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+const workers = 16
+
+// parallel runs fn on workers goroutines at once and returns their errors.
+func parallel(fn func(i int) error) []error {
+	errs := make([]error, workers)
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for i := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+			errs[i] = fn(i)
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	return errs
+}
+
+func testConcurrentCreates(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	ids := make([]int64, workers)
+
+	errs := parallel(func(i int) error {
+		var err error
+		ids[i], err = st.Comment.CreateComment(ctx, "Comment", "bob", postID, nil, nil)
+		return err
+	})
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, ids, commentIDs(comments))
+}
+
+func testConcurrentVersionedUpdates(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	errs := parallel(func(i int) error {
+		return st.Post.UpdatePost(ctx, postID, "Edited", "Content", ptr(int64(1)))
+	})
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, storageErrors.ErrVersionConflict)
+	}
+	assert.Equal(t, 1, succeeded)
+
+	post, err := st.Post.GetPostByID(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), post.Version)
+}
+
+func testConcurrentPins(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	postID := newPost(t, st)
+
+	const maxPins = 3
+
+	ids := make([]int64, workers)
+	for i := range ids {
+		ids[i] = newComment(t, st, postID, nil)
+	}
+
+	errs := parallel(func(i int) error {
+		return st.Comment.PinComment(ctx, postID, ids[i], maxPins)
+	})
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, storageErrors.ErrPinLimitReached)
+	}
+	assert.Equal(t, maxPins, succeeded)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Len(t, pinned, maxPins)
+}
+
+func testConcurrentClaims(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	const deliveries = 40
+
+	for range deliveries {
+		enqueue(t, st, "event")
+	}
+
+	now := time.Now().UTC().Add(time.Hour)
+
+	var mu sync.Mutex
+	claims := make(map[int64]int)
+
+	errs := parallel(func(i int) error {
+		for {
+			claimed, err := st.Webhook.ClaimDueDeliveries(ctx, now, time.Hour, 3)
+			if err != nil || len(claimed) == 0 {
+				return err
+			}
+
+			mu.Lock()
+			for _, delivery := range claimed {
+				claims[delivery.ID]++
+			}
+			mu.Unlock()
+		}
+	})
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, claims, deliveries)
+	for id, count := range claims {
+		assert.Equal(t, 1, count, "delivery %d", id)
+	}
+}
+
+func testConcurrentReservations(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	created := make([]bool, workers)
+
+	errs := parallel(func(i int) error {
+		var err error
+		_, created[i], err = st.Idempotency.ReserveKey(ctx, "alice", "key", "hash", expiresAt)
+		return err
+	})
+
+	reserved := 0
+	for i, err := range errs {
+		assert.NoError(t, err)
+		if created[i] {
+			reserved++
+		}
+	}
+	assert.Equal(t, 1, reserved)
+}
@@ -0,0 +1,84 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func testIdempotencyKeys(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	expiresAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+
+	record, created, err := st.Idempotency.ReserveKey(ctx, "alice", "key", "hash", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "alice", record.Scope)
+	assert.Equal(t, "key", record.Key)
+	assert.Equal(t, "hash", record.RequestHash)
+	assert.Zero(t, record.ResourceID)
+	assert.True(t, expiresAt.Equal(record.ExpiresAt), "expires at %s", record.ExpiresAt)
+
+	// Keys are scoped.
+	_, created, err = st.Idempotency.ReserveKey(ctx, "bob", "key", "hash", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	record, created, err = st.Idempotency.ReserveKey(ctx, "alice", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "hash", record.RequestHash)
+
+	// Completed keys are kept on release, in-flight ones are dropped.
+	keptUntil := expiresAt.Add(time.Hour)
+	assert.NoError(t, st.Idempotency.CompleteKey(ctx, "alice", "key", 42, keptUntil))
+	assert.NoError(t, st.Idempotency.ReleaseKey(ctx, "alice", "key"))
+	assert.NoError(t, st.Idempotency.ReleaseKey(ctx, "bob", "key"))
+	assert.NoError(t, st.Idempotency.ReleaseKey(ctx, "carol", "key"))
+
+	record, created, err = st.Idempotency.ReserveKey(ctx, "alice", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, int64(42), record.ResourceID)
+	assert.True(t, keptUntil.Equal(record.ExpiresAt), "expires at %s", record.ExpiresAt)
+
+	_, created, err = st.Idempotency.ReserveKey(ctx, "bob", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	// An expired key is replaced.
+	expired := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+
+	_, created, err = st.Idempotency.ReserveKey(ctx, "carol", "key", "hash", expired)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	record, created, err = st.Idempotency.ReserveKey(ctx, "carol", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "other", record.RequestHash)
+
+	deleted, err := st.Idempotency.DeleteExpiredKeys(ctx, expiresAt.Add(-time.Second))
+	assert.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	deleted, err = st.Idempotency.DeleteExpiredKeys(ctx, expiresAt)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	_, created, err = st.Idempotency.ReserveKey(ctx, "alice", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	deleted, err = st.Idempotency.DeleteExpiredKeys(ctx, keptUntil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	_, created, err = st.Idempotency.ReserveKey(ctx, "alice", "key", "other", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+}
@@ -0,0 +1,92 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNotifications(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	postID := newPost(t, st)
+	commentID := newComment(t, st, postID, nil)
+	otherCommentID := newComment(t, st, postID, nil)
+
+	first, err := st.Notification.CreateNotification(ctx, "alice", constants.NotificationReply, postID, commentID)
+	assert.NoError(t, err)
+
+	second, err := st.Notification.CreateNotification(ctx, "alice", constants.NotificationMention, postID, otherCommentID)
+	assert.NoError(t, err)
+
+	bobs, err := st.Notification.CreateNotification(ctx, "bob", constants.NotificationMention, postID, otherCommentID)
+	assert.NoError(t, err)
+
+	notification, err := st.Notification.GetNotificationByID(ctx, first)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", notification.Recipient)
+	assert.Equal(t, constants.NotificationReply, notification.Type)
+	assert.Equal(t, postID, notification.PostID)
+	assert.Equal(t, commentID, notification.CommentID)
+	assert.False(t, notification.CreatedAt.IsZero())
+	assert.Nil(t, notification.ReadAt)
+
+	_, err = st.Notification.GetNotificationByID(ctx, 42)
+	assert.ErrorIs(t, err, storageErrors.ErrNotificationNotFound)
+
+	list := func(unreadOnly bool, limit *int32, after *int64) []int64 {
+		t.Helper()
+
+		notifications, err := st.Notification.GetNotificationsByRecipient(ctx, "alice", unreadOnly, limit, after)
+		assert.NoError(t, err)
+
+		return notificationIDs(notifications)
+	}
+
+	// Newest first, after is an exclusive cursor.
+	assert.Equal(t, []int64{second, first}, list(false, nil, nil))
+	assert.Equal(t, []int64{second}, list(false, ptr(int32(1)), nil))
+	assert.Equal(t, []int64{first}, list(false, ptr(int32(1)), &second))
+	assert.Empty(t, list(false, nil, &first))
+	assert.Empty(t, list(false, ptr(int32(0)), nil))
+
+	// Only the recipient's unread notifications change.
+	marked, err := st.Notification.MarkNotificationsRead(ctx, "alice", []int64{first, bobs})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), marked)
+
+	marked, err = st.Notification.MarkNotificationsRead(ctx, "alice", []int64{first})
+	assert.NoError(t, err)
+	assert.Zero(t, marked)
+
+	notification, err = st.Notification.GetNotificationByID(ctx, first)
+	assert.NoError(t, err)
+	assert.NotNil(t, notification.ReadAt)
+
+	assert.Equal(t, []int64{second}, list(true, nil, nil))
+
+	marked, err = st.Notification.MarkNotificationsRead(ctx, "alice", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), marked)
+
+	assert.Empty(t, list(true, nil, nil))
+
+	unread, err := st.Notification.GetNotificationsByRecipient(ctx, "bob", true, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{bobs}, notificationIDs(unread))
+}
+
+func notificationIDs(notifications []models.Notification) []int64 {
+	ids := make([]int64, 0, len(notifications))
+
+	for _, notification := range notifications {
+		ids = append(ids, notification.ID)
+	}
+
+	return ids
+}
@@ -0,0 +1,255 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPostRoundTrip(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	publishedID, err := st.Post.CreatePost(ctx, "Published", "Content", "alice", constants.PostPublished, true)
+	assert.NoError(t, err)
+
+	draftID, err := st.Post.CreatePost(ctx, "Draft", "Draft content", "bob", constants.PostDraft, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, publishedID, draftID)
+
+	post, err := st.Post.GetPostByID(ctx, publishedID)
+	assert.NoError(t, err)
+	assert.Equal(t, publishedID, post.ID)
+	assert.Equal(t, "Published", post.Title)
+	assert.Equal(t, "Content", post.Content)
+	assert.Equal(t, "alice", post.Author)
+	assert.Equal(t, constants.PostPublished, post.Status)
+	assert.True(t, post.CommentsDisabled)
+	assert.NotNil(t, post.PublishAt)
+	assert.False(t, post.CreatedAt.IsZero())
+	assert.Equal(t, int64(1), post.Version)
+
+	post, err = st.Post.GetPostByID(ctx, draftID)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.PostDraft, post.Status)
+	assert.False(t, post.CommentsDisabled)
+	assert.Nil(t, post.PublishAt)
+}
+
+func testImportPost(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	createdAt := time.Date(2020, 5, 17, 8, 30, 0, 123456000, time.UTC)
+	publishAt := createdAt.Add(24 * time.Hour)
+
+	id, err := st.Post.ImportPost(ctx, models.Post{
+		ID:        1_000_000,
+		Title:     "Imported",
+		Content:   "Content",
+		Author:    "carol",
+		Status:    constants.PostScheduled,
+		PublishAt: &publishAt,
+		CreatedAt: createdAt,
+		Version:   7,
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, int64(1_000_000), id)
+
+	post, err := st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Imported", post.Title)
+	assert.Equal(t, "carol", post.Author)
+	assert.Equal(t, constants.PostScheduled, post.Status)
+	assert.True(t, createdAt.Equal(post.CreatedAt), "created at %s", post.CreatedAt)
+	if assert.NotNil(t, post.PublishAt) {
+		assert.True(t, publishAt.Equal(*post.PublishAt), "publish at %s", post.PublishAt)
+	}
+	assert.Equal(t, int64(1), post.Version)
+}
+
+func testGetAllPostsOrder(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	posts, err := st.Post.GetAllPosts(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+
+	first := newPost(t, st)
+	second := newPost(t, st)
+
+	imported, err := st.Post.ImportPost(ctx, models.Post{
+		Title:     "Imported",
+		Content:   "Content",
+		Status:    constants.PostPublished,
+		CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+
+	posts, err = st.Post.GetAllPosts(ctx)
+	assert.NoError(t, err)
+
+	ids := make([]int64, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+
+	assert.Equal(t, []int64{imported, first, second}, ids)
+}
+
+func testPostVersions(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	id := newPost(t, st)
+
+	stale := int64(1)
+	assert.NoError(t, st.Post.UpdatePost(ctx, id, "Edited", "Edited content", &stale))
+	assert.ErrorIs(t, st.Post.UpdatePost(ctx, id, "Stale", "Content", &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, st.Post.SetCommentsDisabled(ctx, id, true, &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, st.Post.SetPostStatus(ctx, id, constants.PostArchived, nil, &stale), storageErrors.ErrVersionConflict)
+	assert.ErrorIs(t, st.Post.DeletePost(ctx, id, &stale), storageErrors.ErrVersionConflict)
+
+	assert.NoError(t, st.Post.SetCommentsDisabled(ctx, id, true, ptr(int64(2))))
+	assert.NoError(t, st.Post.SetPostStatus(ctx, id, constants.PostArchived, nil, nil))
+
+	post, err := st.Post.GetPostByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited", post.Title)
+	assert.Equal(t, "Edited content", post.Content)
+	assert.True(t, post.CommentsDisabled)
+	assert.Equal(t, constants.PostArchived, post.Status)
+	assert.Equal(t, int64(4), post.Version)
+
+	assert.NoError(t, st.Post.DeletePost(ctx, id, &post.Version))
+
+	_, err = st.Post.GetPostByID(ctx, id)
+	assert.ErrorIs(t, err, storageErrors.ErrPostNotFound)
+}
+
+func testPostNotFound(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+	missing := int64(42)
+
+	_, err := st.Post.GetPostByID(ctx, missing)
+	assert.ErrorIs(t, err, storageErrors.ErrPostNotFound)
+
+	assert.ErrorIs(t, st.Post.UpdatePost(ctx, missing, "Title", "Content", nil), storageErrors.ErrPostNotFound)
+	assert.ErrorIs(t, st.Post.SetCommentsDisabled(ctx, missing, true, nil), storageErrors.ErrPostNotFound)
+	assert.ErrorIs(t, st.Post.SetPostStatus(ctx, missing, constants.PostArchived, nil, nil), storageErrors.ErrPostNotFound)
+	assert.ErrorIs(t, st.Post.DeletePost(ctx, missing, ptr(int64(1))), storageErrors.ErrPostNotFound)
+
+	// Without a version deleting is idempotent.
+	assert.NoError(t, st.Post.DeletePost(ctx, missing, nil))
+}
+
+func testDeletePostCascades(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	postID := newPost(t, st)
+	rootID := newComment(t, st, postID, nil)
+	replyID := newComment(t, st, postID, &rootID)
+
+	otherPostID := newPost(t, st)
+	otherID := newComment(t, st, otherPostID, nil)
+
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, rootID, 1))
+
+	notificationID, err := st.Notification.CreateNotification(ctx, "alice", constants.NotificationReply, postID, replyID)
+	assert.NoError(t, err)
+
+	otherNotificationID, err := st.Notification.CreateNotification(ctx, "alice", constants.NotificationReply, otherPostID, otherID)
+	assert.NoError(t, err)
+
+	// A rolled back delete keeps everything.
+	failure := errors.New("rollback")
+
+	err = st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		assert.NoError(t, tx.Post.DeletePost(ctx, postID, nil))
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	_, err = st.Comment.GetCommentByID(ctx, replyID)
+	assert.NoError(t, err)
+
+	_, err = st.Notification.GetNotificationByID(ctx, notificationID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, st.Post.DeletePost(ctx, postID, nil))
+
+	for _, id := range []int64{rootID, replyID} {
+		_, err := st.Comment.GetCommentByID(ctx, id)
+		assert.ErrorIs(t, err, storageErrors.ErrCommentNotFound)
+	}
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Empty(t, pinned)
+
+	_, err = st.Notification.GetNotificationByID(ctx, notificationID)
+	assert.ErrorIs(t, err, storageErrors.ErrNotificationNotFound)
+
+	// The other post keeps its comments and notifications.
+	_, err = st.Comment.GetCommentByID(ctx, otherID)
+	assert.NoError(t, err)
+
+	_, err = st.Notification.GetNotificationByID(ctx, otherNotificationID)
+	assert.NoError(t, err)
+}
+
+func testPublishDuePosts(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	later := now.Add(time.Hour)
+
+	due := newPost(t, st)
+	notDue := newPost(t, st)
+	draft := newPost(t, st)
+
+	assert.NoError(t, st.Post.SetPostStatus(ctx, due, constants.PostScheduled, &now, nil))
+	assert.NoError(t, st.Post.SetPostStatus(ctx, notDue, constants.PostScheduled, &later, nil))
+	assert.NoError(t, st.Post.SetPostStatus(ctx, draft, constants.PostDraft, &now, nil))
+
+	published, err := st.Post.PublishDuePosts(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{due}, published)
+
+	published, err = st.Post.PublishDuePosts(ctx, now)
+	assert.NoError(t, err)
+	assert.Empty(t, published)
+
+	post, err := st.Post.GetPostByID(ctx, due)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.PostPublished, post.Status)
+	assert.Equal(t, int64(3), post.Version)
+
+	post, err = st.Post.GetPostByID(ctx, notDue)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.PostScheduled, post.Status)
+
+	post, err = st.Post.GetPostByID(ctx, draft)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.PostDraft, post.Status)
+
+	// A nil publishAt keeps the stored one.
+	assert.NoError(t, st.Post.SetPostStatus(ctx, notDue, constants.PostArchived, nil, nil))
+
+	post, err = st.Post.GetPostByID(ctx, notDue)
+	assert.NoError(t, err)
+	if assert.NotNil(t, post.PublishAt) {
+		assert.True(t, later.Equal(*post.PublishAt), "publish at %s", post.PublishAt)
+	}
+
+	published, err = st.Post.PublishDuePosts(ctx, later)
+	assert.NoError(t, err)
+	assert.Empty(t, published)
+}
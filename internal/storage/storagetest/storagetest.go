@@ -0,0 +1,116 @@
+// Package storagetest checks implementations of storage.Storage against the
+// contract every backend has to follow.
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+// Factory returns an empty storage. It is called once per test, and the
+// storage is released through t.Cleanup.
+type Factory func(t *testing.T) *storage.Storage
+
+// Run runs the conformance suite against the storages made by newStorage.
+//
+// The suite pins down what the SQL schema enforces and the memory backend
+// has to reproduce: listings come in creation order, ties broken by ID;
+// pages apply only when both limit and offset are given; replies belong to
+// the post of their parent; deleting a comment deletes its replies, their
+// locks and pins, and detaches comments that replied to any of them;
+// deleting a post deletes its comments, pins and notifications along with
+// it.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, st *storage.Storage)
+	}{
+		{"PostRoundTrip", testPostRoundTrip},
+		{"ImportPost", testImportPost},
+		{"GetAllPostsOrder", testGetAllPostsOrder},
+		{"PostVersions", testPostVersions},
+		{"PostNotFound", testPostNotFound},
+		{"DeletePostCascades", testDeletePostCascades},
+		{"PublishDuePosts", testPublishDuePosts},
+		{"CommentRoundTrip", testCommentRoundTrip},
+		{"ImportComment", testImportComment},
+		{"GetCommentsByPostID", testGetCommentsByPostID},
+		{"CommentPages", testCommentPages},
+		{"GetCommentsByParentID", testGetCommentsByParentID},
+		{"GetThread", testGetThread},
+		{"CommentVersions", testCommentVersions},
+		{"CommentNotFound", testCommentNotFound},
+		{"ParentOnOtherPost", testParentOnOtherPost},
+		{"DeleteCommentCascades", testDeleteCommentCascades},
+		{"DeleteCommentsByPostID", testDeleteCommentsByPostID},
+		{"Locks", testLocks},
+		{"Pins", testPins},
+		{"Notifications", testNotifications},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"WebhookDeliveryPages", testWebhookDeliveryPages},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"TxCommit", testTxCommit},
+		{"TxRollback", testTxRollback},
+		{"ConcurrentCreates", testConcurrentCreates},
+		{"ConcurrentVersionedUpdates", testConcurrentVersionedUpdates},
+		{"ConcurrentPins", testConcurrentPins},
+		{"ConcurrentClaims", testConcurrentClaims},
+		{"ConcurrentReservations", testConcurrentReservations},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStorage(t))
+		})
+	}
+}
+
+func newPost(t *testing.T, st *storage.Storage) int64 {
+	t.Helper()
+
+	id, err := st.Post.CreatePost(context.Background(), "Title", "Content", "alice", constants.PostPublished, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func newComment(t *testing.T, st *storage.Storage, postID int64, parentID *int64) int64 {
+	t.Helper()
+
+	id, err := st.Comment.CreateComment(context.Background(), "Comment", "bob", postID, parentID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func commentIDs(comments []models.Comment) []int64 {
+	ids := make([]int64, 0, len(comments))
+
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+
+	return ids
+}
+
+func threadIDs(thread []models.ThreadComment) []int64 {
+	ids := make([]int64, 0, len(thread))
+
+	for _, comment := range thread {
+		ids = append(ids, comment.Comment.ID)
+	}
+
+	return ids
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,102 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTxCommit(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	var postID, commentID int64
+
+	err := st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		var err error
+
+		postID, err = tx.Post.CreatePost(ctx, "Post", "Content", "alice", constants.PostPublished, false)
+		if err != nil {
+			return err
+		}
+
+		commentID, err = tx.Comment.CreateComment(ctx, "Comment", "bob", postID, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		// Writes are visible inside the transaction, nested ones included.
+		comment, err := tx.Comment.GetCommentByID(ctx, commentID)
+		assert.NoError(t, err)
+		assert.Equal(t, postID, comment.PostID)
+
+		return tx.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+			return tx.Post.UpdatePost(ctx, postID, "Edited", "Content", nil)
+		})
+	})
+	assert.NoError(t, err)
+
+	post, err := st.Post.GetPostByID(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited", post.Title)
+
+	comments, err := st.Comment.GetCommentsByPostID(ctx, postID, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{commentID}, commentIDs(comments))
+}
+
+func testTxRollback(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	postID := newPost(t, st)
+	commentID := newComment(t, st, postID, nil)
+	assert.NoError(t, st.Comment.PinComment(ctx, postID, commentID, 0))
+
+	failure := errors.New("failure")
+	var createdPostID int64
+
+	err := st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		var err error
+
+		createdPostID, err = tx.Post.CreatePost(ctx, "Created", "Content", "alice", constants.PostPublished, false)
+		assert.NoError(t, err)
+
+		assert.NoError(t, tx.Post.UpdatePost(ctx, postID, "Edited", "Content", nil))
+
+		_, err = tx.Comment.CreateComment(ctx, "Reply", "bob", postID, &commentID, nil)
+		assert.NoError(t, err)
+
+		assert.NoError(t, tx.Comment.LockComment(ctx, commentID, "reason", "mod", nil))
+		assert.NoError(t, tx.Comment.DeleteCommentsByPostID(ctx, postID))
+		assert.NoError(t, tx.Post.DeletePost(ctx, postID, nil))
+
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	_, err = st.Post.GetPostByID(ctx, createdPostID)
+	assert.ErrorIs(t, err, storageErrors.ErrPostNotFound)
+
+	post, err := st.Post.GetPostByID(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Title", post.Title)
+	assert.Equal(t, int64(1), post.Version)
+
+	comment, err := st.Comment.GetCommentByID(ctx, commentID)
+	assert.NoError(t, err)
+	assert.True(t, comment.Pinned)
+
+	pinned, err := st.Comment.GetPinnedComments(ctx, postID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{commentID}, commentIDs(pinned))
+
+	replies, err := st.Comment.GetCommentsByParentID(ctx, commentID)
+	assert.NoError(t, err)
+	assert.Empty(t, replies)
+
+	assert.ErrorIs(t, st.Comment.UnlockComment(ctx, commentID), storageErrors.ErrLockNotFound)
+}
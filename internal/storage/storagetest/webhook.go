@@ -0,0 +1,134 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func testWebhookDeliveries(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	first := enqueue(t, st, constants.EventPostCreated)
+	second := enqueue(t, st, constants.EventPostUpdated)
+	third := enqueue(t, st, constants.EventPostDeleted)
+
+	// Claim from the future: the deliveries are due right away.
+	now := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	lease := time.Minute
+
+	claim := func(now time.Time, limit int) []models.WebhookDelivery {
+		t.Helper()
+
+		deliveries, err := st.Webhook.ClaimDueDeliveries(ctx, now, lease, limit)
+		assert.NoError(t, err)
+
+		return deliveries
+	}
+
+	claimed := claim(now, 2)
+	assert.Equal(t, []int64{first, second}, deliveryIDs(claimed))
+
+	if assert.Len(t, claimed, 2) {
+		assert.Equal(t, constants.EventPostCreated, claimed[0].Event)
+		assert.Equal(t, "https://example.com/hook", claimed[0].Endpoint)
+		assert.Equal(t, []byte(`{"event":"post.created"}`), claimed[0].Payload)
+		assert.Equal(t, constants.WebhookDeliveryPending, claimed[0].Status)
+		assert.Zero(t, claimed[0].Attempts)
+		assert.True(t, now.Add(lease).Equal(claimed[0].NextAttemptAt), "next attempt at %s", claimed[0].NextAttemptAt)
+	}
+
+	// Claimed deliveries are leased until now+lease.
+	assert.Equal(t, []int64{third}, deliveryIDs(claim(now, 10)))
+	assert.Empty(t, claim(now, 10))
+
+	retryAt := now.Add(time.Hour)
+
+	assert.NoError(t, st.Webhook.MarkDeliverySucceeded(ctx, first))
+	assert.NoError(t, st.Webhook.MarkDeliveryFailed(ctx, second, "timeout", &retryAt))
+	assert.NoError(t, st.Webhook.MarkDeliveryFailed(ctx, third, "gone", nil))
+	assert.NoError(t, st.Webhook.MarkDeliverySucceeded(ctx, 42))
+
+	assert.Empty(t, claim(now.Add(lease), 10))
+	assert.Equal(t, []int64{second}, deliveryIDs(claim(retryAt, 10)))
+
+	deliveries, err := st.Webhook.GetDeliveries(ctx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{third, second, first}, deliveryIDs(deliveries))
+
+	if assert.Len(t, deliveries, 3) {
+		failed, pending, delivered := deliveries[0], deliveries[1], deliveries[2]
+
+		assert.Equal(t, constants.WebhookDeliveryFailed, failed.Status)
+		assert.Equal(t, "gone", failed.LastError)
+		assert.Equal(t, 1, failed.Attempts)
+
+		assert.Equal(t, constants.WebhookDeliveryPending, pending.Status)
+		assert.Equal(t, "timeout", pending.LastError)
+		assert.Equal(t, 1, pending.Attempts)
+
+		assert.Equal(t, constants.WebhookDeliveryDelivered, delivered.Status)
+		assert.Empty(t, delivered.LastError)
+		assert.Equal(t, 1, delivered.Attempts)
+		assert.NotNil(t, delivered.DeliveredAt)
+	}
+}
+
+func testWebhookDeliveryPages(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	var ids []int64
+	for range 5 {
+		ids = append([]int64{enqueue(t, st, constants.EventCommentCreated)}, ids...)
+	}
+
+	assert.NoError(t, st.Webhook.MarkDeliverySucceeded(ctx, ids[1]))
+
+	list := func(status *string, limit, offset *int32) []int64 {
+		t.Helper()
+
+		deliveries, err := st.Webhook.GetDeliveries(ctx, status, limit, offset)
+		assert.NoError(t, err)
+
+		return deliveryIDs(deliveries)
+	}
+
+	// Newest first. Unlike comment pages, limit and offset apply alone.
+	assert.Equal(t, ids, list(nil, nil, nil))
+	assert.Equal(t, ids[:2], list(nil, ptr(int32(2)), nil))
+	assert.Equal(t, ids[2:], list(nil, nil, ptr(int32(2))))
+	assert.Equal(t, ids[4:], list(nil, ptr(int32(2)), ptr(int32(4))))
+	assert.Empty(t, list(nil, ptr(int32(2)), ptr(int32(5))))
+
+	pending := constants.WebhookDeliveryPending
+	assert.Equal(t, []int64{ids[0], ids[2]}, list(&pending, ptr(int32(2)), nil))
+
+	delivered := constants.WebhookDeliveryDelivered
+	assert.Equal(t, []int64{ids[1]}, list(&delivered, nil, nil))
+}
+
+func enqueue(t *testing.T, st *storage.Storage, event string) int64 {
+	t.Helper()
+
+	id, err := st.Webhook.EnqueueDelivery(context.Background(), event, "https://example.com/hook", []byte(`{"event":"`+event+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func deliveryIDs(deliveries []models.WebhookDelivery) []int64 {
+	ids := make([]int64, 0, len(deliveries))
+
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+
+	return ids
+}
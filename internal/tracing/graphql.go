@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Extension returns the gqlgen extension that opens a span for every
+// operation and, below it, for every field backed by a resolver.
+func Extension() graphql.HandlerExtension {
+	return operationTracer{}
+}
+
+type operationTracer struct{}
+
+var (
+	_ graphql.HandlerExtension     = operationTracer{}
+	_ graphql.OperationInterceptor = operationTracer{}
+	_ graphql.FieldInterceptor     = operationTracer{}
+)
+
+func (operationTracer) ExtensionName() string {
+	return "Tracing"
+}
+
+func (operationTracer) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (operationTracer) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	operationType := string(oc.Operation.Operation)
+
+	spanName := operationType
+	if oc.Operation.Name != "" {
+		spanName += " " + oc.Operation.Name
+	}
+
+	ctx, span := tracer().Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithTimestamp(oc.Stats.OperationStart),
+		trace.WithAttributes(
+			semconv.GraphQLOperationTypeKey.String(operationType),
+			semconv.GraphQLOperationName(oc.Operation.Name),
+		),
+	)
+
+	responses := next(ctx)
+
+	// A subscription span covers setting it up; events are sent long after.
+	if oc.Operation.Operation == ast.Subscription {
+		span.End()
+		return responses
+	}
+
+	return func(ctx context.Context) *graphql.Response {
+		response := responses(ctx)
+
+		if response != nil && len(response.Errors) > 0 {
+			span.SetStatus(codes.Error, response.Errors.Error())
+		}
+
+		span.End()
+
+		return response
+	}
+}
+
+func (operationTracer) InterceptField(ctx context.Context, next graphql.Resolver) (res any, err error) {
+	fc := graphql.GetFieldContext(ctx)
+	if !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := tracer().Start(ctx, fc.Object+"."+fc.Field.Name,
+		trace.WithAttributes(attribute.String("graphql.field.path", fc.Path().String())),
+	)
+	defer end(span, &err)
+
+	return next(ctx)
+}
@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentStorage returns st with a span for every post and comment
+// storage call, including calls made inside transactions.
+func InstrumentStorage(st *storage.Storage) *storage.Storage {
+	instrumented := instrument(*st)
+	return &instrumented
+}
+
+func instrument(st storage.Storage) storage.Storage {
+	instrumented := st
+	instrumented.Post = postStorage{st.Post}
+	instrumented.Comment = commentStorage{st.Comment}
+
+	if st.Transactor != nil {
+		instrumented.Transactor = transactor{st.Transactor}
+	}
+
+	return instrumented
+}
+
+func start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+type transactor struct {
+	next storage.Transactor
+}
+
+func (t transactor) WithTx(ctx context.Context, fn func(ctx context.Context, tx storage.Storage) error) (err error) {
+	ctx, span := start(ctx, "Storage.WithTx")
+	defer end(span, &err)
+
+	return t.next.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		return fn(ctx, instrument(tx))
+	})
+}
+
+type postStorage struct {
+	next storage.PostStorage
+}
+
+func (s postStorage) CreatePost(ctx context.Context, title, content, author, status string, commentsDisabled bool) (id int64, err error) {
+	ctx, span := start(ctx, "PostStorage.CreatePost")
+	defer end(span, &err)
+
+	return s.next.CreatePost(ctx, title, content, author, status, commentsDisabled)
+}
+
+func (s postStorage) ImportPost(ctx context.Context, post models.Post) (id int64, err error) {
+	ctx, span := start(ctx, "PostStorage.ImportPost")
+	defer end(span, &err)
+
+	return s.next.ImportPost(ctx, post)
+}
+
+func (s postStorage) GetPostByID(ctx context.Context, id int64) (post models.Post, err error) {
+	ctx, span := start(ctx, "PostStorage.GetPostByID", attribute.Int64("post.id", id))
+	defer end(span, &err)
+
+	return s.next.GetPostByID(ctx, id)
+}
+
+func (s postStorage) GetAllPosts(ctx context.Context) (posts []models.Post, err error) {
+	ctx, span := start(ctx, "PostStorage.GetAllPosts")
+	defer end(span, &err)
+
+	return s.next.GetAllPosts(ctx)
+}
+
+func (s postStorage) UpdatePost(ctx context.Context, id int64, title, content string, expectedVersion *int64) (err error) {
+	ctx, span := start(ctx, "PostStorage.UpdatePost", attribute.Int64("post.id", id))
+	defer end(span, &err)
+
+	return s.next.UpdatePost(ctx, id, title, content, expectedVersion)
+}
+
+func (s postStorage) SetCommentsDisabled(ctx context.Context, id int64, disabled bool, expectedVersion *int64) (err error) {
+	ctx, span := start(ctx, "PostStorage.SetCommentsDisabled", attribute.Int64("post.id", id))
+	defer end(span, &err)
+
+	return s.next.SetCommentsDisabled(ctx, id, disabled, expectedVersion)
+}
+
+func (s postStorage) SetPostStatus(ctx context.Context, id int64, status string, publishAt *time.Time, expectedVersion *int64) (err error) {
+	ctx, span := start(ctx, "PostStorage.SetPostStatus", attribute.Int64("post.id", id))
+	defer end(span, &err)
+
+	return s.next.SetPostStatus(ctx, id, status, publishAt, expectedVersion)
+}
+
+func (s postStorage) PublishDuePosts(ctx context.Context, now time.Time) (ids []int64, err error) {
+	ctx, span := start(ctx, "PostStorage.PublishDuePosts")
+	defer end(span, &err)
+
+	return s.next.PublishDuePosts(ctx, now)
+}
+
+func (s postStorage) DeletePost(ctx context.Context, id int64, expectedVersion *int64) (err error) {
+	ctx, span := start(ctx, "PostStorage.DeletePost", attribute.Int64("post.id", id))
+	defer end(span, &err)
+
+	return s.next.DeletePost(ctx, id, expectedVersion)
+}
+
+type commentStorage struct {
+	next storage.CommentStorage
+}
+
+func (s commentStorage) CreateComment(ctx context.Context, content, author string, postID int64, parentID, replyToID *int64) (id int64, err error) {
+	ctx, span := start(ctx, "CommentStorage.CreateComment", attribute.Int64("post.id", postID))
+	defer end(span, &err)
+
+	return s.next.CreateComment(ctx, content, author, postID, parentID, replyToID)
+}
+
+func (s commentStorage) ImportComment(ctx context.Context, comment models.Comment) (id int64, err error) {
+	ctx, span := start(ctx, "CommentStorage.ImportComment", attribute.Int64("post.id", comment.PostID))
+	defer end(span, &err)
+
+	return s.next.ImportComment(ctx, comment)
+}
+
+func (s commentStorage) GetCommentByID(ctx context.Context, id int64) (comment models.Comment, err error) {
+	ctx, span := start(ctx, "CommentStorage.GetCommentByID", attribute.Int64("comment.id", id))
+	defer end(span, &err)
+
+	return s.next.GetCommentByID(ctx, id)
+}
+
+func (s commentStorage) GetCommentsByParentID(ctx context.Context, parentID int64) (comments []models.Comment, err error) {
+	ctx, span := start(ctx, "CommentStorage.GetCommentsByParentID", attribute.Int64("comment.parent_id", parentID))
+	defer end(span, &err)
+
+	return s.next.GetCommentsByParentID(ctx, parentID)
+}
+
+func (s commentStorage) GetCommentsByPostID(ctx context.Context, postID int64, limit *int32, offset *int32) (comments []models.Comment, err error) {
+	ctx, span := start(ctx, "CommentStorage.GetCommentsByPostID", attribute.Int64("post.id", postID))
+	defer end(span, &err)
+
+	return s.next.GetCommentsByPostID(ctx, postID, limit, offset)
+}
+
+func (s commentStorage) GetThread(ctx context.Context, postID int64, rootID *int64, maxDepth, limit int) (thread []models.ThreadComment, err error) {
+	ctx, span := start(ctx, "CommentStorage.GetThread", attribute.Int64("post.id", postID))
+	defer end(span, &err)
+
+	return s.next.GetThread(ctx, postID, rootID, maxDepth, limit)
+}
+
+func (s commentStorage) UpdateComment(ctx context.Context, id int64, content string, expectedVersion *int64) (err error) {
+	ctx, span := start(ctx, "CommentStorage.UpdateComment", attribute.Int64("comment.id", id))
+	defer end(span, &err)
+
+	return s.next.UpdateComment(ctx, id, content, expectedVersion)
+}
+
+func (s commentStorage) DeleteComment(ctx context.Context, id int64, expectedVersion *int64) (err error) {
+	ctx, span := start(ctx, "CommentStorage.DeleteComment", attribute.Int64("comment.id", id))
+	defer end(span, &err)
+
+	return s.next.DeleteComment(ctx, id, expectedVersion)
+}
+
+func (s commentStorage) DeleteCommentsByPostID(ctx context.Context, postID int64) (err error) {
+	ctx, span := start(ctx, "CommentStorage.DeleteCommentsByPostID", attribute.Int64("post.id", postID))
+	defer end(span, &err)
+
+	return s.next.DeleteCommentsByPostID(ctx, postID)
+}
+
+func (s commentStorage) LockComment(ctx context.Context, id int64, reason, lockedBy string, expiresAt *time.Time) (err error) {
+	ctx, span := start(ctx, "CommentStorage.LockComment", attribute.Int64("comment.id", id))
+	defer end(span, &err)
+
+	return s.next.LockComment(ctx, id, reason, lockedBy, expiresAt)
+}
+
+func (s commentStorage) UnlockComment(ctx context.Context, id int64) (err error) {
+	ctx, span := start(ctx, "CommentStorage.UnlockComment", attribute.Int64("comment.id", id))
+	defer end(span, &err)
+
+	return s.next.UnlockComment(ctx, id)
+}
+
+func (s commentStorage) FindActiveLock(ctx context.Context, id int64, now time.Time) (lock models.CommentLock, err error) {
+	ctx, span := start(ctx, "CommentStorage.FindActiveLock", attribute.Int64("comment.id", id))
+	defer end(span, &err)
+
+	return s.next.FindActiveLock(ctx, id, now)
+}
+
+func (s commentStorage) PinComment(ctx context.Context, postID, commentID int64, maxPins int) (err error) {
+	ctx, span := start(ctx, "CommentStorage.PinComment", attribute.Int64("post.id", postID), attribute.Int64("comment.id", commentID))
+	defer end(span, &err)
+
+	return s.next.PinComment(ctx, postID, commentID, maxPins)
+}
+
+func (s commentStorage) UnpinComment(ctx context.Context, postID, commentID int64) (err error) {
+	ctx, span := start(ctx, "CommentStorage.UnpinComment", attribute.Int64("post.id", postID), attribute.Int64("comment.id", commentID))
+	defer end(span, &err)
+
+	return s.next.UnpinComment(ctx, postID, commentID)
+}
+
+func (s commentStorage) GetPinnedComments(ctx context.Context, postID int64) (comments []models.Comment, err error) {
+	ctx, span := start(ctx, "CommentStorage.GetPinnedComments", attribute.Int64("post.id", postID))
+	defer end(span, &err)
+
+	return s.next.GetPinnedComments(ctx, postID)
+}
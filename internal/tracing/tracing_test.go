@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/graphql"
+	"github.com/Pacahar/graphql-comments/internal/graphql/generated"
+	"github.com/Pacahar/graphql-comments/internal/notification"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/Pacahar/graphql-comments/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPostQuerySpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, err := Setup(context.Background(), config.Tracing{Exporter: constants.TracingOff}, io.Discard)
+	assert.NoError(t, err)
+
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	st = InstrumentStorage(st)
+
+	postID, err := st.Post.CreatePost(context.Background(), "T", "C", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	_, err = st.Comment.CreateComment(context.Background(), "root", "bob", postID, nil, nil)
+	assert.NoError(t, err)
+
+	recorder.Reset()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: &graphql.Resolver{
+		Storage:  st,
+		Logger:   logger,
+		Broker:   notification.NewBroker(),
+		Webhooks: webhook.NewDispatcher(config.Webhooks{}, st.Webhook, logger),
+	}}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(Extension())
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query": "query GetPost { post(id: \"1\") { id comments { id } } }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	rec := httptest.NewRecorder()
+	Middleware(auth.Middleware(srv)).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	operation := spans["query GetPost"]
+	if !assert.NotNil(t, operation) {
+		return
+	}
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", operation.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", operation.Parent().SpanID().String())
+
+	field := spans["Query.post"]
+	if !assert.NotNil(t, field) {
+		return
+	}
+	assert.Equal(t, operation.SpanContext().SpanID(), field.Parent().SpanID())
+
+	for _, name := range []string{"PostStorage.GetPostByID", "CommentStorage.GetCommentsByPostID"} {
+		call := spans[name]
+		if assert.NotNil(t, call, name) {
+			assert.Equal(t, field.SpanContext().SpanID(), call.Parent().SpanID(), name)
+		}
+	}
+}
+
+func TestTransactionSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	st = InstrumentStorage(st)
+
+	err = st.WithTx(context.Background(), func(ctx context.Context, tx storage.Storage) error {
+		_, err := tx.Post.CreatePost(ctx, "T", "C", "alice", constants.PostPublished, false)
+		return err
+	})
+	assert.NoError(t, err)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	transaction, call := spans["Storage.WithTx"], spans["PostStorage.CreatePost"]
+	if assert.NotNil(t, transaction) && assert.NotNil(t, call) {
+		assert.Equal(t, transaction.SpanContext().SpanID(), call.Parent().SpanID())
+	}
+}
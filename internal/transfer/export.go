@@ -0,0 +1,113 @@
+// Package transfer moves posts and comment threads between storages as
+// NDJSON: one Record per line, every post followed by its comments, parents
+// before their replies.
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+const (
+	RecordPost    = "post"
+	RecordComment = "comment"
+)
+
+type Record struct {
+	Type    string          `json:"type"`
+	Post    *models.Post    `json:"post,omitempty"`
+	Comment *models.Comment `json:"comment,omitempty"`
+}
+
+type ExportReport struct {
+	Posts    int
+	Comments int
+}
+
+// Export writes every post and comment in st to w.
+func Export(ctx context.Context, st *storage.Storage, w io.Writer) (ExportReport, error) {
+	const op = "transfer.Export"
+
+	var report ExportReport
+
+	posts, err := st.Post.GetAllPosts(ctx)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].ID < posts[j].ID
+	})
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+
+	for _, post := range posts {
+		if err := enc.Encode(Record{Type: RecordPost, Post: &post}); err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+		report.Posts++
+
+		comments, err := PostComments(ctx, st.Comment, post.ID)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, comment := range comments {
+			if err := enc.Encode(Record{Type: RecordComment, Comment: &comment}); err != nil {
+				return report, fmt.Errorf("%s: %w", op, err)
+			}
+			report.Comments++
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+// PostComments returns all comments of the post in breadth first order, so
+// every comment comes after its parent. Siblings are ordered by ID.
+func PostComments(ctx context.Context, comments storage.CommentStorage, postID int64) ([]models.Comment, error) {
+	all, err := comments.GetCommentsByPostID(ctx, postID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make([]models.Comment, 0, len(all))
+
+	for _, comment := range all {
+		if comment.ParentID == nil {
+			queue = append(queue, comment)
+		}
+	}
+
+	sortByID(queue)
+
+	for i := 0; i < len(queue); i++ {
+		replies, err := comments.GetCommentsByParentID(ctx, queue[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		sortByID(replies)
+		queue = append(queue, replies...)
+	}
+
+	return queue, nil
+}
+
+func sortByID(comments []models.Comment) {
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].ID < comments[j].ID
+	})
+}
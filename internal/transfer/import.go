@@ -0,0 +1,404 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+
+	DefaultBatchSize = 500
+)
+
+type ImportOptions struct {
+	// DryRun reports what the import would do without writing anything.
+	DryRun bool
+	// OnConflict decides what happens to records that already exist in the
+	// target storage: ConflictSkip keeps the stored version, ConflictOverwrite
+	// replaces its content.
+	OnConflict string
+	// BatchSize is the number of records written per transaction.
+	BatchSize int
+}
+
+type ImportReport struct {
+	PostsCreated        int
+	PostsSkipped        int
+	PostsOverwritten    int
+	CommentsCreated     int
+	CommentsSkipped     int
+	CommentsOverwritten int
+}
+
+// A post already exists when a stored post has the same author, title and
+// creation time, a comment when its post has a comment with the same parent,
+// author and creation time. That makes importing the same dump twice a
+// no-op with ConflictSkip.
+type postKey struct {
+	author    string
+	title     string
+	createdAt time.Time
+}
+
+type commentKey struct {
+	parentID  int64
+	author    string
+	createdAt time.Time
+}
+
+type line struct {
+	number int
+	record Record
+}
+
+type importer struct {
+	st     *storage.Storage
+	opts   ImportOptions
+	report ImportReport
+	// unit names what line.number counts in error messages.
+	unit string
+
+	// IDs in the dump mapped to IDs in st.
+	posts    map[int64]int64
+	comments map[int64]int64
+
+	existingPosts    map[postKey]int64
+	existingComments map[int64]map[commentKey]int64
+
+	// nextDryRunID stands in for IDs the storage would assign.
+	nextDryRunID int64
+}
+
+// Import reads records written by Export from r and stores them in st with
+// new IDs, rewriting post and parent references accordingly. Records are
+// written in transactions of opts.BatchSize; on error the batches committed
+// so far are kept and the report covers them.
+func Import(ctx context.Context, st *storage.Storage, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	const op = "transfer.Import"
+
+	imp, err := newImporter(ctx, st, opts, "line")
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	reader := bufio.NewReader(r)
+	batch := make([]line, 0, imp.opts.BatchSize)
+	number := 0
+
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return imp.report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if len(raw) > 0 {
+			number++
+
+			var record Record
+			if jsonErr := json.Unmarshal(raw, &record); jsonErr != nil {
+				return imp.report, fmt.Errorf("%s: line %d: %w", op, number, jsonErr)
+			}
+
+			batch = append(batch, line{number: number, record: record})
+		}
+
+		if len(batch) == imp.opts.BatchSize || (errors.Is(err, io.EOF) && len(batch) > 0) {
+			if err := imp.flush(ctx, batch); err != nil {
+				return imp.report, fmt.Errorf("%s: %w", op, err)
+			}
+			batch = batch[:0]
+		}
+
+		if errors.Is(err, io.EOF) {
+			return imp.report, nil
+		}
+	}
+}
+
+// ImportRecords is Import for records that are already in memory, used by
+// importers of foreign formats. Records must be ordered like Export writes
+// them: every post and parent comment before the comments referring to it.
+func ImportRecords(ctx context.Context, st *storage.Storage, records []Record, opts ImportOptions) (ImportReport, error) {
+	const op = "transfer.ImportRecords"
+
+	imp, err := newImporter(ctx, st, opts, "record")
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	batch := make([]line, 0, imp.opts.BatchSize)
+
+	for i, record := range records {
+		batch = append(batch, line{number: i + 1, record: record})
+
+		if len(batch) == imp.opts.BatchSize || i == len(records)-1 {
+			if err := imp.flush(ctx, batch); err != nil {
+				return imp.report, fmt.Errorf("%s: %w", op, err)
+			}
+			batch = batch[:0]
+		}
+	}
+
+	return imp.report, nil
+}
+
+func newImporter(ctx context.Context, st *storage.Storage, opts ImportOptions, unit string) (*importer, error) {
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictSkip
+	}
+
+	if opts.OnConflict != ConflictSkip && opts.OnConflict != ConflictOverwrite {
+		return nil, fmt.Errorf("unknown conflict policy %q", opts.OnConflict)
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	imp := &importer{
+		st:               st,
+		opts:             opts,
+		unit:             unit,
+		posts:            make(map[int64]int64),
+		comments:         make(map[int64]int64),
+		existingComments: make(map[int64]map[commentKey]int64),
+		nextDryRunID:     -1,
+	}
+
+	if err := imp.loadExistingPosts(ctx); err != nil {
+		return nil, err
+	}
+
+	return imp, nil
+}
+
+func (imp *importer) flush(ctx context.Context, batch []line) error {
+	if imp.opts.DryRun {
+		return imp.apply(ctx, *imp.st, batch)
+	}
+
+	report := imp.report
+
+	err := imp.st.WithTx(ctx, func(ctx context.Context, tx storage.Storage) error {
+		return imp.apply(ctx, tx, batch)
+	})
+
+	if err != nil {
+		// The batch was rolled back, so its records must not be counted.
+		imp.report = report
+	}
+
+	return err
+}
+
+func (imp *importer) apply(ctx context.Context, tx storage.Storage, batch []line) error {
+	for _, l := range batch {
+		var err error
+
+		switch l.record.Type {
+		case RecordPost:
+			err = imp.importPost(ctx, tx, l.record.Post)
+		case RecordComment:
+			err = imp.importComment(ctx, tx, l.record.Comment)
+		default:
+			err = fmt.Errorf("unknown record type %q", l.record.Type)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s %d: %w", imp.unit, l.number, err)
+		}
+	}
+
+	return nil
+}
+
+func (imp *importer) importPost(ctx context.Context, tx storage.Storage, post *models.Post) error {
+	if post == nil {
+		return fmt.Errorf("post record without post")
+	}
+
+	key := postKey{author: post.Author, title: post.Title, createdAt: normalizeTime(post.CreatedAt)}
+
+	if id, exists := imp.existingPosts[key]; exists {
+		imp.posts[post.ID] = id
+
+		if imp.opts.OnConflict == ConflictSkip {
+			imp.report.PostsSkipped++
+			return nil
+		}
+
+		if !imp.opts.DryRun {
+			if err := tx.Post.UpdatePost(ctx, id, post.Title, post.Content, nil); err != nil {
+				return err
+			}
+
+			if err := tx.Post.SetPostStatus(ctx, id, post.Status, post.PublishAt, nil); err != nil {
+				return err
+			}
+
+			if err := tx.Post.SetCommentsDisabled(ctx, id, post.CommentsDisabled, nil); err != nil {
+				return err
+			}
+		}
+
+		imp.report.PostsOverwritten++
+		return nil
+	}
+
+	id := imp.dryRunID()
+
+	if !imp.opts.DryRun {
+		var err error
+		id, err = tx.Post.ImportPost(ctx, *post)
+		if err != nil {
+			return err
+		}
+	}
+
+	imp.posts[post.ID] = id
+	imp.existingPosts[key] = id
+	imp.existingComments[id] = make(map[commentKey]int64)
+	imp.report.PostsCreated++
+
+	return nil
+}
+
+func (imp *importer) importComment(ctx context.Context, tx storage.Storage, comment *models.Comment) error {
+	if comment == nil {
+		return fmt.Errorf("comment record without comment")
+	}
+
+	postID, exists := imp.posts[comment.PostID]
+	if !exists {
+		return fmt.Errorf("comment %d refers to post %d that is not in the dump before it", comment.ID, comment.PostID)
+	}
+
+	imported := *comment
+	imported.PostID = postID
+
+	var parentID int64
+
+	if comment.ParentID != nil {
+		id, exists := imp.comments[*comment.ParentID]
+		if !exists {
+			return fmt.Errorf("comment %d refers to parent %d that is not in the dump before it", comment.ID, *comment.ParentID)
+		}
+		parentID = id
+		imported.ParentID = &parentID
+	}
+
+	// The comment replied to may have been dropped from the dump, which only
+	// loses the reply marker.
+	imported.ReplyToID = nil
+	if comment.ReplyToID != nil {
+		if id, exists := imp.comments[*comment.ReplyToID]; exists {
+			imported.ReplyToID = &id
+		}
+	}
+
+	existing, err := imp.existingPostComments(ctx, tx, postID)
+	if err != nil {
+		return err
+	}
+
+	key := commentKey{parentID: parentID, author: comment.Author, createdAt: normalizeTime(comment.CreatedAt)}
+
+	if id, exists := existing[key]; exists {
+		imp.comments[comment.ID] = id
+
+		if imp.opts.OnConflict == ConflictSkip {
+			imp.report.CommentsSkipped++
+			return nil
+		}
+
+		if !imp.opts.DryRun {
+			if err := tx.Comment.UpdateComment(ctx, id, comment.Content, nil); err != nil {
+				return err
+			}
+		}
+
+		imp.report.CommentsOverwritten++
+		return nil
+	}
+
+	id := imp.dryRunID()
+
+	if !imp.opts.DryRun {
+		id, err = tx.Comment.ImportComment(ctx, imported)
+		if err != nil {
+			return err
+		}
+	}
+
+	imp.comments[comment.ID] = id
+	existing[key] = id
+	imp.report.CommentsCreated++
+
+	return nil
+}
+
+func (imp *importer) loadExistingPosts(ctx context.Context) error {
+	posts, err := imp.st.Post.GetAllPosts(ctx)
+	if err != nil {
+		return err
+	}
+
+	imp.existingPosts = make(map[postKey]int64, len(posts))
+
+	for _, post := range posts {
+		imp.existingPosts[postKey{author: post.Author, title: post.Title, createdAt: normalizeTime(post.CreatedAt)}] = post.ID
+	}
+
+	return nil
+}
+
+// existingPostComments indexes the stored comments of a post the first time
+// one of its comments is imported.
+func (imp *importer) existingPostComments(ctx context.Context, tx storage.Storage, postID int64) (map[commentKey]int64, error) {
+	if existing, loaded := imp.existingComments[postID]; loaded {
+		return existing, nil
+	}
+
+	comments, err := PostComments(ctx, tx.Comment, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[commentKey]int64, len(comments))
+
+	for _, comment := range comments {
+		var parentID int64
+		if comment.ParentID != nil {
+			parentID = *comment.ParentID
+		}
+
+		existing[commentKey{parentID: parentID, author: comment.Author, createdAt: normalizeTime(comment.CreatedAt)}] = comment.ID
+	}
+
+	imp.existingComments[postID] = existing
+
+	return existing, nil
+}
+
+func (imp *importer) dryRunID() int64 {
+	id := imp.nextDryRunID
+	imp.nextDryRunID--
+
+	return id
+}
+
+// normalizeTime drops what Postgres does not store, so times read back from
+// either backend compare equal to the ones in the dump.
+func normalizeTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
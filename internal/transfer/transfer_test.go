@@ -0,0 +1,161 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func seed(t *testing.T, st *storage.Storage) {
+	ctx := context.Background()
+
+	// Burn an ID so that imported IDs differ from the dumped ones.
+	_, err := st.Post.CreatePost(ctx, "Gone", "Content", "", constants.PostPublished, false)
+	assert.NoError(t, err)
+	assert.NoError(t, st.Post.DeletePost(ctx, 1, nil))
+
+	postID, err := st.Post.CreatePost(ctx, "Post", "Content", "alice", constants.PostPublished, false)
+	assert.NoError(t, err)
+
+	rootID, err := st.Comment.CreateComment(ctx, "Root", "alice", postID, nil, nil)
+	assert.NoError(t, err)
+
+	childID, err := st.Comment.CreateComment(ctx, "Child", "bob", postID, &rootID, nil)
+	assert.NoError(t, err)
+
+	_, err = st.Comment.CreateComment(ctx, "Grandchild", "carol", postID, &childID, &childID)
+	assert.NoError(t, err)
+
+	_, err = st.Post.CreatePost(ctx, "Draft", "Content", "bob", constants.PostDraft, true)
+	assert.NoError(t, err)
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	source, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+	seed(t, source)
+
+	var dump bytes.Buffer
+	exported, err := Export(ctx, source, &dump)
+	assert.NoError(t, err)
+	assert.Equal(t, ExportReport{Posts: 2, Comments: 3}, exported)
+	assert.Equal(t, 5, strings.Count(dump.String(), "\n"))
+
+	target, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	report, err := Import(ctx, target, bytes.NewReader(dump.Bytes()), ImportOptions{BatchSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, ImportReport{PostsCreated: 2, CommentsCreated: 3}, report)
+
+	posts, err := target.Post.GetAllPosts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+
+	var post, draft models.Post
+	for _, p := range posts {
+		if p.Title == "Post" {
+			post = p
+		} else {
+			draft = p
+		}
+	}
+
+	sourcePost, err := source.Post.GetPostByID(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), post.ID)
+	assert.True(t, sourcePost.CreatedAt.Equal(post.CreatedAt))
+	assert.Equal(t, constants.PostDraft, draft.Status)
+	assert.True(t, draft.CommentsDisabled)
+
+	comments, err := PostComments(ctx, target.Comment, post.ID)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 3)
+	assert.Nil(t, comments[0].ParentID)
+	assert.Equal(t, comments[0].ID, *comments[1].ParentID)
+	assert.Equal(t, comments[1].ID, *comments[2].ParentID)
+	assert.Equal(t, comments[1].ID, *comments[2].ReplyToID)
+	assert.Equal(t, 2, comments[2].Depth)
+
+	// Importing the same dump again only finds conflicts.
+	report, err = Import(ctx, target, bytes.NewReader(dump.Bytes()), ImportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, ImportReport{PostsSkipped: 2, CommentsSkipped: 3}, report)
+}
+
+func TestImportOverwriteAndDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	source, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+	seed(t, source)
+
+	target, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	var dump bytes.Buffer
+	_, err = Export(ctx, source, &dump)
+	assert.NoError(t, err)
+
+	_, err = Import(ctx, target, bytes.NewReader(dump.Bytes()), ImportOptions{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, source.Post.UpdatePost(ctx, 2, "Post", "Edited", nil))
+	assert.NoError(t, source.Comment.UpdateComment(ctx, 1, "Edited root", nil))
+
+	dump.Reset()
+	_, err = Export(ctx, source, &dump)
+	assert.NoError(t, err)
+
+	report, err := Import(ctx, target, bytes.NewReader(dump.Bytes()), ImportOptions{DryRun: true, OnConflict: ConflictOverwrite})
+	assert.NoError(t, err)
+	assert.Equal(t, ImportReport{PostsOverwritten: 2, CommentsOverwritten: 3}, report)
+
+	post, err := target.Post.GetPostByID(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Content", post.Content)
+
+	_, err = Import(ctx, target, bytes.NewReader(dump.Bytes()), ImportOptions{OnConflict: ConflictOverwrite})
+	assert.NoError(t, err)
+
+	post, err = target.Post.GetPostByID(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited", post.Content)
+
+	comment, err := target.Comment.GetCommentByID(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Edited root", comment.Content)
+}
+
+func TestImportRollsBackFailedBatch(t *testing.T) {
+	ctx := context.Background()
+
+	target, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Format(time.RFC3339)
+	dump := `{"type":"post","post":{"id":7,"title":"Post","content":"Content","status":"PUBLISHED","created_at":"` + createdAt + `"}}
+{"type":"comment","comment":{"id":1,"post_id":7,"content":"Root","created_at":"` + createdAt + `"}}
+{"type":"post","post":{"id":8,"title":"Second","content":"Content","status":"PUBLISHED","created_at":"` + createdAt + `"}}
+{"type":"comment","comment":{"id":2,"post_id":8,"parent_id":99,"content":"Orphan","created_at":"` + createdAt + `"}}
+`
+
+	report, err := Import(ctx, target, strings.NewReader(dump), ImportOptions{BatchSize: 2})
+	assert.ErrorContains(t, err, "line 4")
+	assert.Equal(t, ImportReport{PostsCreated: 1, CommentsCreated: 1}, report)
+
+	posts, err := target.Post.GetAllPosts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+	assert.Equal(t, "Post", posts[0].Title)
+}
@@ -0,0 +1,198 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+)
+
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+type Envelope struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// Dispatcher writes events to the webhook outbox and delivers them to the
+// configured endpoints, retrying failed deliveries with exponential backoff.
+type Dispatcher struct {
+	cfg     config.Webhooks
+	storage storage.WebhookStorage
+	client  *http.Client
+	logger  *slog.Logger
+}
+
+func NewDispatcher(cfg config.Webhooks, storage storage.WebhookStorage, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		cfg:     cfg,
+		storage: storage,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		logger:  logger,
+	}
+}
+
+// Sign returns the value of SignatureHeader for body: the hex encoded
+// HMAC-SHA256 of the raw request body, prefixed with "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Emit enqueues a delivery of event to every endpoint subscribed to it in
+// outbox. Passing the webhook storage of the transaction that made the
+// change stores the event if and only if the change commits.
+func (d *Dispatcher) Emit(ctx context.Context, outbox storage.WebhookStorage, event string, data any) error {
+	const op = "webhook.Emit"
+
+	payload, err := json.Marshal(Envelope{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, endpoint := range d.cfg.Endpoints {
+		if len(endpoint.Events) > 0 && !slices.Contains(endpoint.Events, event) {
+			continue
+		}
+
+		if _, err := outbox.EnqueueDelivery(ctx, event, endpoint.URL, payload); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// Run delivers due webhooks every PollInterval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.processDue(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) processDue(ctx context.Context) {
+	// The batch is sent one delivery after another, so the lease has to
+	// outlast all of them. Otherwise another instance claims the tail of the
+	// batch again and sends it twice.
+	lease := time.Duration(d.cfg.BatchSize)*d.cfg.Timeout + d.cfg.PollInterval
+
+	deliveries, err := d.storage.ClaimDueDeliveries(ctx, time.Now(), lease, d.cfg.BatchSize)
+
+	if err != nil {
+		d.logger.Error("failed to claim webhook deliveries", slog.String("err", err.Error()))
+		return
+	}
+
+	for _, delivery := range deliveries {
+		d.deliver(ctx, delivery)
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) {
+	log := d.logger.With(
+		slog.Int64("delivery", delivery.ID),
+		slog.String("event", delivery.Event),
+		slog.String("endpoint", delivery.Endpoint),
+	)
+
+	err := d.send(ctx, delivery)
+
+	if err == nil {
+		if err := d.storage.MarkDeliverySucceeded(ctx, delivery.ID); err != nil {
+			log.Error("failed to mark webhook delivered", slog.String("err", err.Error()))
+		}
+		log.Debug("webhook delivered")
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+
+	var nextAttemptAt *time.Time
+	if attempts < d.cfg.MaxAttempts {
+		next := time.Now().Add(d.backoff(attempts))
+		nextAttemptAt = &next
+	}
+
+	if err := d.storage.MarkDeliveryFailed(ctx, delivery.ID, err.Error(), nextAttemptAt); err != nil {
+		log.Error("failed to record webhook failure", slog.String("err", err.Error()))
+	}
+
+	log.Warn("webhook delivery failed", slog.String("err", err.Error()), slog.Int("attempts", attempts))
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery models.WebhookDelivery) error {
+	idx := slices.IndexFunc(d.cfg.Endpoints, func(endpoint config.WebhookEndpoint) bool {
+		return endpoint.URL == delivery.Endpoint
+	})
+
+	if idx < 0 {
+		return fmt.Errorf("endpoint is no longer configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Endpoints[idx].Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.cfg.InitialBackoff
+
+	for i := 1; i < attempts && backoff < d.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, d.cfg.MaxBackoff)
+}
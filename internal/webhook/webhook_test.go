@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/config"
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDispatcher(t *testing.T, url string, maxAttempts int) (*Dispatcher, *memory.WebhookMemoryStorage) {
+	storage, err := memory.NewWebhookMemoryStorage()
+	assert.NoError(t, err)
+
+	cfg := config.Webhooks{
+		Endpoints: []config.WebhookEndpoint{
+			{URL: url, Secret: "secret", Events: []string{constants.EventCommentCreated}},
+		},
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		PollInterval:   time.Millisecond,
+		Timeout:        time.Second,
+		BatchSize:      10,
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return NewDispatcher(cfg, storage, logger), storage
+}
+
+func TestDeliveryIsSignedAndRetried(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	var received Envelope
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		assert.Equal(t, Sign("secret", body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, constants.EventCommentCreated, r.Header.Get(EventHeader))
+
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dispatcher, storage := setupDispatcher(t, server.URL, 5)
+
+	assert.NoError(t, dispatcher.Emit(ctx, storage, constants.EventCommentCreated, map[string]int{"id": 1}))
+	assert.NoError(t, dispatcher.Emit(ctx, storage, constants.EventPostCreated, map[string]int{"id": 1}))
+
+	dispatcher.processDue(ctx)
+	time.Sleep(2 * time.Millisecond)
+	dispatcher.processDue(ctx)
+
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, constants.EventCommentCreated, received.Event)
+
+	deliveries, err := storage.GetDeliveries(ctx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, constants.WebhookDeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+}
+
+func TestDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	dispatcher, storage := setupDispatcher(t, server.URL, 2)
+
+	assert.NoError(t, dispatcher.Emit(ctx, storage, constants.EventCommentCreated, nil))
+
+	for i := 0; i < 3; i++ {
+		dispatcher.processDue(ctx)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	deliveries, err := storage.GetDeliveries(ctx, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, constants.WebhookDeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, "unexpected status 502", deliveries[0].LastError)
+}
+
+func TestBackoffIsExponentialAndCapped(t *testing.T) {
+	dispatcher := &Dispatcher{cfg: config.Webhooks{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}}
+
+	assert.Equal(t, time.Second, dispatcher.backoff(1))
+	assert.Equal(t, 2*time.Second, dispatcher.backoff(2))
+	assert.Equal(t, 8*time.Second, dispatcher.backoff(4))
+	assert.Equal(t, 10*time.Second, dispatcher.backoff(10))
+}
@@ -0,0 +1,68 @@
+package wxr
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/logging"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	storageErrors "github.com/Pacahar/graphql-comments/internal/storage/errors"
+)
+
+// Handler serves the WXR export to admins. Repeated post query parameters
+// limit it to those posts.
+func Handler(st *storage.Storage, admins []string, opts ExportOptions, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context(), log)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !auth.IsAdmin(r.Context(), admins) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		opts := opts
+		opts.PostIDs = nil
+
+		for _, value := range r.URL.Query()["post"] {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid post id", http.StatusBadRequest)
+				return
+			}
+
+			opts.PostIDs = append(opts.PostIDs, id)
+		}
+
+		// Buffer the document so a failure halfway can still be reported
+		// with a proper status.
+		var buf bytes.Buffer
+
+		report, err := Export(r.Context(), st, &buf, opts)
+		if err != nil {
+			if errors.Is(err, storageErrors.ErrPostNotFound) {
+				http.Error(w, "post not found", http.StatusNotFound)
+				return
+			}
+
+			log.Error("failed to export wxr", slog.String("err", err.Error()))
+			http.Error(w, "failed to export", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("wxr export served", slog.Int("posts", report.Posts), slog.Int("comments", report.Comments))
+
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="export.wxr"`)
+		w.Write(buf.Bytes())
+	})
+}
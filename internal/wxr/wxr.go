@@ -0,0 +1,263 @@
+// Package wxr exports posts and their comment trees as WordPress eXtended
+// RSS, the format read by the WordPress importer.
+package wxr
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/transfer"
+)
+
+const (
+	Version = "1.2"
+
+	// dateLayout is how WordPress stores dates.
+	dateLayout = "2006-01-02 15:04:05"
+)
+
+type ExportOptions struct {
+	// Title and Link describe the site in the channel header.
+	Title string
+	Link  string
+	// Location is the site time zone, used for the local post_date and
+	// comment_date fields. The _gmt fields are always UTC. Defaults to UTC.
+	Location *time.Location
+	// PostIDs limits the export to these posts. Empty exports every post.
+	PostIDs []int64
+}
+
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+type rss struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Excerpt string   `xml:"xmlns:excerpt,attr"`
+	Content string   `xml:"xmlns:content,attr"`
+	WFW     string   `xml:"xmlns:wfw,attr"`
+	DC      string   `xml:"xmlns:dc,attr"`
+	WP      string   `xml:"xmlns:wp,attr"`
+	Channel channel  `xml:"channel"`
+}
+
+type channel struct {
+	Title      string `xml:"title"`
+	Link       string `xml:"link"`
+	Language   string `xml:"language"`
+	WXRVersion string `xml:"wp:wxr_version"`
+	Items      []item `xml:"item"`
+}
+
+type item struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link,omitempty"`
+	Creator       cdata     `xml:"dc:creator"`
+	Content       cdata     `xml:"content:encoded"`
+	Excerpt       cdata     `xml:"excerpt:encoded"`
+	PostID        int64     `xml:"wp:post_id"`
+	PostDate      string    `xml:"wp:post_date"`
+	PostDateGMT   string    `xml:"wp:post_date_gmt"`
+	CommentStatus string    `xml:"wp:comment_status"`
+	PingStatus    string    `xml:"wp:ping_status"`
+	Status        string    `xml:"wp:status"`
+	PostParent    int64     `xml:"wp:post_parent"`
+	PostType      string    `xml:"wp:post_type"`
+	Comments      []comment `xml:"wp:comment"`
+}
+
+type comment struct {
+	ID          int64  `xml:"wp:comment_id"`
+	Author      cdata  `xml:"wp:comment_author"`
+	AuthorEmail string `xml:"wp:comment_author_email"`
+	Date        string `xml:"wp:comment_date"`
+	DateGMT     string `xml:"wp:comment_date_gmt"`
+	Content     cdata  `xml:"wp:comment_content"`
+	Approved    string `xml:"wp:comment_approved"`
+	Type        string `xml:"wp:comment_type"`
+	Parent      int64  `xml:"wp:comment_parent"`
+	UserID      int64  `xml:"wp:comment_user_id"`
+}
+
+// Export writes the posts in st, each with all of its comments, to w as a
+// WXR document. Comment IDs and parents are the storage IDs, so threads
+// keep their shape in WordPress.
+func Export(ctx context.Context, st *storage.Storage, w io.Writer, opts ExportOptions) (transfer.ExportReport, error) {
+	const op = "wxr.Export"
+
+	var report transfer.ExportReport
+
+	location := opts.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	posts, err := exportedPosts(ctx, st.Post, opts.PostIDs)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	doc := rss{
+		Version: "2.0",
+		Excerpt: "http://wordpress.org/export/" + Version + "/excerpt/",
+		Content: "http://purl.org/rss/1.0/modules/content/",
+		WFW:     "http://wellformedweb.org/CommentAPI/",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		WP:      "http://wordpress.org/export/" + Version + "/",
+		Channel: channel{
+			Title:      opts.Title,
+			Link:       opts.Link,
+			Language:   "en",
+			WXRVersion: Version,
+			Items:      make([]item, 0, len(posts)),
+		},
+	}
+
+	for _, post := range posts {
+		comments, err := transfer.PostComments(ctx, st.Comment, post.ID)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		doc.Channel.Items = append(doc.Channel.Items, toItem(post, comments, opts.Link, location))
+		report.Posts++
+		report.Comments += len(comments)
+	}
+
+	buf := bufio.NewWriter(w)
+
+	if _, err := buf.WriteString(xml.Header); err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "\t")
+
+	if err := enc.Encode(doc); err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := buf.WriteByte('\n'); err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+func exportedPosts(ctx context.Context, posts storage.PostStorage, ids []int64) ([]models.Post, error) {
+	if len(ids) == 0 {
+		all, err := posts.GetAllPosts(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Slice(all, func(i, j int) bool {
+			return all[i].ID < all[j].ID
+		})
+
+		return all, nil
+	}
+
+	selected := make([]models.Post, 0, len(ids))
+
+	for _, id := range ids {
+		post, err := posts.GetPostByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("post %d: %w", id, err)
+		}
+
+		selected = append(selected, post)
+	}
+
+	return selected, nil
+}
+
+func toItem(post models.Post, comments []models.Comment, siteLink string, location *time.Location) item {
+	// WordPress dates a scheduled post by the time it goes live.
+	date := post.CreatedAt
+	if post.Status == constants.PostScheduled && post.PublishAt != nil {
+		date = *post.PublishAt
+	}
+
+	commentStatus := "open"
+	if post.CommentsDisabled {
+		commentStatus = "closed"
+	}
+
+	it := item{
+		Title:         post.Title,
+		Creator:       cdata{post.Author},
+		Content:       cdata{post.Content},
+		PostID:        post.ID,
+		PostDate:      date.In(location).Format(dateLayout),
+		PostDateGMT:   date.UTC().Format(dateLayout),
+		CommentStatus: commentStatus,
+		PingStatus:    "closed",
+		Status:        postStatus(post.Status),
+		PostType:      "post",
+		Comments:      make([]comment, 0, len(comments)),
+	}
+
+	if siteLink != "" {
+		it.Link = strings.TrimRight(siteLink, "/") + "/?p=" + strconv.FormatInt(post.ID, 10)
+	}
+
+	for _, c := range comments {
+		var parent int64
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+
+		it.Comments = append(it.Comments, comment{
+			ID:       c.ID,
+			Author:   cdata{c.Author},
+			Date:     c.CreatedAt.In(location).Format(dateLayout),
+			DateGMT:  c.CreatedAt.UTC().Format(dateLayout),
+			Content:  cdata{c.Content},
+			Approved: commentApproved(c.Status),
+			Type:     "comment",
+			Parent:   parent,
+		})
+	}
+
+	return it
+}
+
+func postStatus(status string) string {
+	switch status {
+	case constants.PostDraft:
+		return "draft"
+	case constants.PostScheduled:
+		return "future"
+	case constants.PostArchived:
+		return "private"
+	default:
+		return "publish"
+	}
+}
+
+func commentApproved(status string) string {
+	switch status {
+	case constants.CommentSpam:
+		return "spam"
+	case constants.CommentDeleted:
+		return "trash"
+	default:
+		return "1"
+	}
+}
@@ -0,0 +1,211 @@
+package wxr
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pacahar/graphql-comments/internal/auth"
+	"github.com/Pacahar/graphql-comments/internal/constants"
+	"github.com/Pacahar/graphql-comments/internal/models"
+	"github.com/Pacahar/graphql-comments/internal/storage"
+	"github.com/Pacahar/graphql-comments/internal/storage/memory"
+	"github.com/Pacahar/graphql-comments/internal/transfer"
+	"github.com/stretchr/testify/assert"
+)
+
+// The read side matches wp elements by local name, as the namespace URL
+// changes between WXR versions. content:encoded needs its namespace to tell
+// it from excerpt:encoded.
+type readItem struct {
+	Title         string `xml:"title"`
+	Creator       string `xml:"creator"`
+	Content       string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostID        int64  `xml:"post_id"`
+	PostDateGMT   string `xml:"post_date_gmt"`
+	CommentStatus string `xml:"comment_status"`
+	Status        string `xml:"status"`
+	Comments      []struct {
+		ID       int64  `xml:"comment_id"`
+		Author   string `xml:"comment_author"`
+		DateGMT  string `xml:"comment_date_gmt"`
+		Content  string `xml:"comment_content"`
+		Approved string `xml:"comment_approved"`
+		Parent   int64  `xml:"comment_parent"`
+	} `xml:"comment"`
+}
+
+// readWXR turns an exported document back into transfer records, so the
+// round trip goes through the same importer as NDJSON dumps.
+func readWXR(t *testing.T, r io.Reader) []transfer.Record {
+	var doc struct {
+		Items []readItem `xml:"channel>item"`
+	}
+	assert.NoError(t, xml.NewDecoder(r).Decode(&doc))
+
+	statuses := map[string]string{"publish": constants.PostPublished, "draft": constants.PostDraft, "future": constants.PostScheduled, "private": constants.PostArchived}
+	approved := map[string]string{"1": constants.CommentVisible, "trash": constants.CommentDeleted, "spam": constants.CommentSpam}
+
+	var records []transfer.Record
+
+	for _, it := range doc.Items {
+		records = append(records, transfer.Record{Type: transfer.RecordPost, Post: &models.Post{
+			ID:               it.PostID,
+			Title:            it.Title,
+			Content:          it.Content,
+			Author:           it.Creator,
+			Status:           statuses[it.Status],
+			CommentsDisabled: it.CommentStatus == "closed",
+			CreatedAt:        parseGMT(t, it.PostDateGMT),
+		}})
+
+		for _, c := range it.Comments {
+			comment := &models.Comment{
+				ID:        c.ID,
+				PostID:    it.PostID,
+				Author:    c.Author,
+				Content:   c.Content,
+				Status:    approved[c.Approved],
+				CreatedAt: parseGMT(t, c.DateGMT),
+			}
+
+			if c.Parent != 0 {
+				parent := c.Parent
+				comment.ParentID = &parent
+			}
+
+			records = append(records, transfer.Record{Type: transfer.RecordComment, Comment: comment})
+		}
+	}
+
+	return records
+}
+
+func parseGMT(t *testing.T, value string) time.Time {
+	parsed, err := time.Parse(dateLayout, value)
+	assert.NoError(t, err)
+
+	return parsed
+}
+
+func seed(t *testing.T) *storage.Storage {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 3, 1, 22, 30, 0, 0, time.UTC)
+
+	st, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	postID, err := st.Post.ImportPost(ctx, models.Post{
+		Title: "Hello & welcome", Content: "<p>Body with ]]> inside</p>", Author: "alice",
+		Status: constants.PostPublished, CommentsDisabled: true, CreatedAt: createdAt,
+	})
+	assert.NoError(t, err)
+
+	rootID, err := st.Comment.ImportComment(ctx, models.Comment{PostID: postID, Author: "bob", Content: "Root", CreatedAt: createdAt.Add(time.Hour)})
+	assert.NoError(t, err)
+
+	childID, err := st.Comment.ImportComment(ctx, models.Comment{PostID: postID, ParentID: &rootID, Author: "carol", Content: "Child", CreatedAt: createdAt.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+
+	_, err = st.Comment.ImportComment(ctx, models.Comment{PostID: postID, ParentID: &childID, Author: "dave", Content: "Spam", Status: constants.CommentSpam, CreatedAt: createdAt.Add(3 * time.Hour)})
+	assert.NoError(t, err)
+
+	_, err = st.Post.ImportPost(ctx, models.Post{Title: "Draft", Content: "Later", Author: "bob", Status: constants.PostDraft, CreatedAt: createdAt})
+	assert.NoError(t, err)
+
+	return st
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := seed(t)
+
+	moscow := time.FixedZone("MSK", 3*60*60)
+
+	var doc bytes.Buffer
+	report, err := Export(ctx, source, &doc, ExportOptions{Title: "Blog", Link: "https://blog.example.com/", Location: moscow})
+	assert.NoError(t, err)
+	assert.Equal(t, transfer.ExportReport{Posts: 2, Comments: 3}, report)
+
+	out := doc.String()
+	assert.Contains(t, out, "<wp:post_date>2024-03-02 01:30:00</wp:post_date>")
+	assert.Contains(t, out, "<wp:post_date_gmt>2024-03-01 22:30:00</wp:post_date_gmt>")
+	assert.Contains(t, out, "<wp:comment_date_gmt>2024-03-01 23:30:00</wp:comment_date_gmt>")
+	assert.Contains(t, out, "<link>https://blog.example.com/?p=1</link>")
+	assert.Contains(t, out, "<wp:comment_approved>spam</wp:comment_approved>")
+
+	target, err := memory.NewMemoryStorage()
+	assert.NoError(t, err)
+
+	imported, err := transfer.ImportRecords(ctx, target, readWXR(t, &doc), transfer.ImportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, transfer.ImportReport{PostsCreated: 2, CommentsCreated: 3}, imported)
+
+	for _, id := range []int64{1, 2} {
+		want, err := source.Post.GetPostByID(ctx, id)
+		assert.NoError(t, err)
+
+		got, err := target.Post.GetPostByID(ctx, id)
+		assert.NoError(t, err)
+
+		assert.Equal(t, want.Title, got.Title)
+		assert.Equal(t, want.Content, got.Content)
+		assert.Equal(t, want.Author, got.Author)
+		assert.Equal(t, want.Status, got.Status)
+		assert.Equal(t, want.CommentsDisabled, got.CommentsDisabled)
+		assert.True(t, want.CreatedAt.Equal(got.CreatedAt))
+
+		wantComments, err := transfer.PostComments(ctx, source.Comment, id)
+		assert.NoError(t, err)
+
+		gotComments, err := transfer.PostComments(ctx, target.Comment, id)
+		assert.NoError(t, err)
+		assert.Len(t, gotComments, len(wantComments))
+
+		for i := range wantComments {
+			assert.Equal(t, wantComments[i].ParentID, gotComments[i].ParentID)
+			assert.Equal(t, wantComments[i].Depth, gotComments[i].Depth)
+			assert.Equal(t, wantComments[i].Author, gotComments[i].Author)
+			assert.Equal(t, wantComments[i].Content, gotComments[i].Content)
+			assert.Equal(t, wantComments[i].Status, gotComments[i].Status)
+			assert.True(t, wantComments[i].CreatedAt.Equal(gotComments[i].CreatedAt))
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	st := seed(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := auth.Middleware(Handler(st, []string{"admin"}, ExportOptions{Title: "Blog"}, logger))
+
+	request := func(user, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/export.wxr"+query, nil)
+		if user != "" {
+			req.Header.Set(auth.UserHeader, user)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, request("", "").Code)
+	assert.Equal(t, http.StatusForbidden, request("alice", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request("admin", "?post=abc").Code)
+	assert.Equal(t, http.StatusNotFound, request("admin", "?post=42").Code)
+
+	rec := request("admin", "?post=2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/rss+xml; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, 1, strings.Count(rec.Body.String(), "<item>"))
+	assert.Contains(t, rec.Body.String(), "<title>Draft</title>")
+	assert.Contains(t, rec.Body.String(), "<wp:status>draft</wp:status>")
+}